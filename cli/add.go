@@ -1,9 +1,11 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/99designs/aws-vault/prompt"
 	"github.com/99designs/aws-vault/vault"
@@ -12,10 +14,12 @@ import (
 )
 
 type AddCommandInput struct {
-	ProfileName string
-	Keyring     *vault.CredentialKeyring
-	FromEnv     bool
-	AddConfig   bool
+	ProfileName    string
+	Keyring        *vault.CredentialKeyring
+	FromEnv        bool
+	AllowTemporary bool
+	AddConfig      bool
+	Force          bool
 }
 
 func ConfigureAddCommand(app *kingpin.Application) {
@@ -29,63 +33,88 @@ func ConfigureAddCommand(app *kingpin.Application) {
 	cmd.Flag("env", "Read the credentials from the environment").
 		BoolVar(&input.FromEnv)
 
+	cmd.Flag("allow-temporary", "With --env, store temporary credentials that have an AWS_SESSION_TOKEN").
+		BoolVar(&input.AllowTemporary)
+
 	cmd.Flag("add-config", "Add a profile to ~/.aws/config if one doesn't exist").
 		Default("true").
 		BoolVar(&input.AddConfig)
 
+	cmd.Flag("force", "Store the credentials even if the profile assumes a role with role_arn or credential_source").
+		BoolVar(&input.Force)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
-		AddCommand(app, input)
-		return nil
+		return actionFailed(AddCommand(input), "")
 	})
 }
 
-func AddCommand(app *kingpin.Application, input AddCommandInput) {
-	var accessKeyId, secretKey string
+func AddCommand(input AddCommandInput) error {
+	var accessKeyId, secretKey, sessionToken string
+	var expiration time.Time
 
 	p, _ := awsConfigFile.ProfileSection(input.ProfileName)
 	if p.SourceProfile != "" {
-		app.Fatalf("Your profile has a source_profile of %s, adding credentials to %s won't have any effect",
+		return fmt.Errorf("Your profile has a source_profile of %s, adding credentials to %s won't have any effect",
 			p.SourceProfile, input.ProfileName)
-		return
 	}
 	if p.ParentProfile != "" {
-		app.Fatalf("Your profile has a parent_profile of %s, adding credentials to %s won't have any effect",
+		return fmt.Errorf("Your profile has a parent_profile of %s, adding credentials to %s won't have any effect",
 			p.ParentProfile, input.ProfileName)
-		return
+	}
+	if !input.Force {
+		for _, section := range includedProfileSections(input.ProfileName) {
+			from := ""
+			if section.Name != input.ProfileName {
+				from = fmt.Sprintf(" through include_profile %s", section.Name)
+			}
+			if section.RoleARN != "" {
+				return fmt.Errorf("Your profile has a role_arn of %s%s, so credentials are normally added to the profile the role is assumed from, not %s. Use --force to add them anyway",
+					section.RoleARN, from, input.ProfileName)
+			}
+			if section.CredentialSource != "" {
+				return fmt.Errorf("Credentials added to %s would be used instead of its credential_source of %s%s. Use --force to add them anyway",
+					input.ProfileName, section.CredentialSource, from)
+			}
+		}
 	}
 
 	if input.FromEnv {
 		if accessKeyId = os.Getenv("AWS_ACCESS_KEY_ID"); accessKeyId == "" {
-			app.Fatalf("Missing value for AWS_ACCESS_KEY_ID")
-			return
+			return errors.New("Missing value for AWS_ACCESS_KEY_ID")
 		}
 		if secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY"); secretKey == "" {
-			app.Fatalf("Missing value for AWS_SECRET_ACCESS_KEY")
-			return
+			return errors.New("Missing value for AWS_SECRET_ACCESS_KEY")
+		}
+		sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		if sessionToken != "" && !input.AllowTemporary {
+			return errors.New("AWS_SESSION_TOKEN is set, so these are temporary credentials that will expire. Use --allow-temporary to store them anyway")
+		}
+		if exp := os.Getenv("AWS_SESSION_EXPIRATION"); sessionToken != "" && exp != "" {
+			var err error
+			if expiration, err = time.Parse(time.RFC3339, exp); err != nil {
+				return fmt.Errorf("Invalid value for AWS_SESSION_EXPIRATION: %v", err)
+			}
 		}
 	} else {
 		var err error
 		if accessKeyId, err = prompt.TerminalPrompt("Enter Access Key ID: "); err != nil {
-			app.Fatalf(err.Error())
-			return
+			return err
 		}
 		if secretKey, err = prompt.TerminalPrompt("Enter Secret Access Key: "); err != nil {
-			app.Fatalf(err.Error())
-			return
+			return err
 		}
 	}
 
-	creds := credentials.Value{AccessKeyID: accessKeyId, SecretAccessKey: secretKey}
+	creds := credentials.Value{AccessKeyID: accessKeyId, SecretAccessKey: secretKey, SessionToken: sessionToken}
 
-	if err := input.Keyring.Set(input.ProfileName, creds); err != nil {
-		app.Fatalf(err.Error())
-		return
+	if err := input.Keyring.SetWithExpiration(input.ProfileName, creds, expiration); err != nil {
+		return err
 	}
 
 	fmt.Printf("Added credentials to profile %q in vault\n", input.ProfileName)
 
-	sessions := input.Keyring.Sessions()
+	sessions := profileSessions(input.Keyring, input.ProfileName)
 
 	if n, _ := sessions.Delete(input.ProfileName); n > 0 {
 		fmt.Printf("Deleted %d existing sessions.\n", n)
@@ -98,8 +127,25 @@ func AddCommand(app *kingpin.Application, input AddCommandInput) {
 			}
 			log.Printf("Adding profile %s to config at %s", input.ProfileName, awsConfigFile.Path)
 			if err := awsConfigFile.Add(newProfileSection); err != nil {
-				app.Fatalf("Error adding profile: %#v", err)
+				return fmt.Errorf("Error adding profile: %w", err)
 			}
 		}
 	}
+	return nil
+}
+
+// includedProfileSections returns the section of the profile followed by the sections it includes with
+// include_profile, in the order they're included
+func includedProfileSections(profileName string) (sections []vault.ProfileSection) {
+	seen := map[string]bool{}
+	for name := profileName; name != "" && !seen[name]; {
+		seen[name] = true
+		section, ok := awsConfigFile.ProfileSection(name)
+		if !ok {
+			break
+		}
+		sections = append(sections, section)
+		name = section.IncludeProfile
+	}
+	return sections
 }
@@ -4,7 +4,12 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
+	"testing"
+	"time"
 
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -34,3 +39,117 @@ func ExampleAddCommand() {
 	// Output:
 	// Added credentials to profile "foo" in vault
 }
+
+// loadAddTestConfig loads config as the AWS config file for AddCommand
+func loadAddTestConfig(t *testing.T, config string) {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString(config); err != nil {
+		t.Fatal(err)
+	}
+	if awsConfigFile, err = vault.LoadConfig(f.Name()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// setenv sets environment variables for the rest of the test
+func setenv(env map[string]string) func() {
+	for k, v := range env {
+		os.Setenv(k, v)
+	}
+	return func() {
+		for k := range env {
+			os.Unsetenv(k)
+		}
+	}
+}
+
+func TestAddCommandRefusesTemporaryCredentialsFromEnv(t *testing.T) {
+	loadAddTestConfig(t, "")
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":      "ASIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":  "secret",
+		"AWS_SESSION_TOKEN":      "token",
+		"AWS_SESSION_EXPIRATION": "2030-01-02T15:04:05Z",
+	})()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err := AddCommand(AddCommandInput{ProfileName: "foo", Keyring: k, FromEnv: true})
+	if err == nil || !strings.Contains(err.Error(), "--allow-temporary") {
+		t.Fatalf("Expected temporary credentials to need --allow-temporary, got %v", err)
+	}
+	if ok, _ := k.Has("foo"); ok {
+		t.Fatal("Expected the temporary credentials not to be stored")
+	}
+
+	if err = AddCommand(AddCommandInput{ProfileName: "foo", Keyring: k, FromEnv: true, AllowTemporary: true}); err != nil {
+		t.Fatal(err)
+	}
+	val, expiration, err := k.GetWithExpiration("foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.SessionToken != "token" || !expiration.Equal(time.Date(2030, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Fatalf("Expected the session token and expiration to be stored, got %q, %s", val.SessionToken, expiration)
+	}
+}
+
+func TestAddCommandRejectsAnInvalidSessionExpiration(t *testing.T) {
+	loadAddTestConfig(t, "")
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":      "ASIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY":  "secret",
+		"AWS_SESSION_TOKEN":      "token",
+		"AWS_SESSION_EXPIRATION": "tomorrow",
+	})()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err := AddCommand(AddCommandInput{ProfileName: "foo", Keyring: k, FromEnv: true, AllowTemporary: true})
+	if err == nil || !strings.Contains(err.Error(), "AWS_SESSION_EXPIRATION") {
+		t.Fatalf("Expected an error for AWS_SESSION_EXPIRATION, got %v", err)
+	}
+}
+
+func TestAddCommandNeedsForceForRoleProfiles(t *testing.T) {
+	loadAddTestConfig(t, `[profile role]
+role_arn = arn:aws:iam::123456789012:role/admin
+
+[profile includes-role]
+include_profile = role
+
+[profile includes-instance]
+include_profile = instance
+
+[profile instance]
+credential_source = Ec2InstanceMetadata
+`)
+	defer setenv(map[string]string{
+		"AWS_ACCESS_KEY_ID":     "AKIAEXAMPLE",
+		"AWS_SECRET_ACCESS_KEY": "secret",
+	})()
+
+	for _, tc := range []struct {
+		profile  string
+		expected string
+	}{
+		{"role", "role_arn of arn:aws:iam::123456789012:role/admin,"},
+		{"includes-role", "role_arn of arn:aws:iam::123456789012:role/admin through include_profile role"},
+		{"includes-instance", "credential_source of Ec2InstanceMetadata through include_profile instance"},
+	} {
+		k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+		err := AddCommand(AddCommandInput{ProfileName: tc.profile, Keyring: k, FromEnv: true})
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Fatalf("%s: expected an error with %q, got %v", tc.profile, tc.expected, err)
+		}
+
+		if err = AddCommand(AddCommandInput{ProfileName: tc.profile, Keyring: k, FromEnv: true, Force: true}); err != nil {
+			t.Fatalf("%s: %v", tc.profile, err)
+		}
+		if ok, _ := k.Has(tc.profile); !ok {
+			t.Fatalf("%s: expected the credentials to be stored with --force", tc.profile)
+		}
+	}
+}
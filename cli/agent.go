@@ -0,0 +1,137 @@
+package cli
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/99designs/aws-vault/server"
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mitchellh/go-homedir"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const defaultAgentSocket = "~/.awsvault/agent.sock"
+
+type AgentCommandInput struct {
+	SocketPath string
+	Keyring    *vault.CredentialKeyring
+	Config     vault.Config
+}
+
+type AgentCredentialsCommandInput struct {
+	ProfileName string
+	SocketPath  string
+	Token       string
+}
+
+func ConfigureAgentCommand(app *kingpin.Application) {
+	input := AgentCommandInput{}
+
+	cmd := app.Command("agent", "Run an agent that serves credentials for any profile on a unix socket")
+
+	cmd.Flag("socket", "Path of the unix socket to listen on").
+		Default(defaultAgentSocket).
+		Envar("AWS_VAULT_AGENT_SOCK").
+		StringVar(&input.SocketPath)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(AgentCommand(input), "agent")
+	})
+}
+
+func ConfigureAgentCredentialsCommand(app *kingpin.Application) {
+	input := AgentCredentialsCommandInput{}
+
+	cmd := app.Command("agent-credentials", "Get credentials from a running agent, in the AWS credential helper format")
+
+	cmd.Flag("socket", "Path of the agent's unix socket").
+		Default(defaultAgentSocket).
+		Envar("AWS_VAULT_AGENT_SOCK").
+		StringVar(&input.SocketPath)
+
+	cmd.Flag("token", "The agent's token").
+		Envar("AWS_VAULT_AGENT_TOKEN").
+		Required().
+		StringVar(&input.Token)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		return actionFailed(AgentCredentialsCommand(input), "agent-credentials")
+	})
+}
+
+func AgentCommand(input AgentCommandInput) error {
+	socketPath, err := homedir.Expand(input.SocketPath)
+	if err != nil {
+		return err
+	}
+
+	b := make([]byte, 16)
+	if _, err = rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	// credentials are kept for the lifetime of the agent, and refreshed when they expire
+	credsByProfile := map[string]*credentials.Credentials{}
+
+	credsFunc := func(profileName string) (*credentials.Credentials, error) {
+		if creds, ok := credsByProfile[profileName]; ok {
+			return creds, nil
+		}
+
+		configLoader.BaseConfig = input.Config
+		configLoader.ActiveProfile = profileName
+		config, err := configLoader.LoadFromProfile(profileName)
+		if err != nil {
+			return nil, err
+		}
+
+		creds, err := vault.NewTempCredentials(config, input.Keyring)
+		if err != nil {
+			return nil, fmt.Errorf("Error getting temporary credentials: %w", err)
+		}
+
+		credsByProfile[profileName] = creds
+		return creds, nil
+	}
+
+	fmt.Printf("export AWS_VAULT_AGENT_SOCK=%s\n", socketPath)
+	fmt.Printf("export AWS_VAULT_AGENT_TOKEN=%s\n", token)
+
+	return server.StartAgent(socketPath, token, credsFunc)
+}
+
+func AgentCredentialsCommand(input AgentCredentialsCommandInput) error {
+	socketPath, err := homedir.Expand(input.SocketPath)
+	if err != nil {
+		return err
+	}
+
+	creds, err := server.GetAgentCredentials(socketPath, input.Token, input.ProfileName)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	b, err := marshalJSON(&AwsCredentialHelperData{
+		Version:         1,
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+		Expiration:      creds.Expiration,
+	})
+	if err != nil {
+		return fmt.Errorf("Error creating credential json: %w", err)
+	}
+
+	fmt.Print(string(b))
+	return nil
+}
@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"text/tabwriter"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// allBackends is every backend aws-vault knows about, in the order keyring tries them
+var allBackends = []string{
+	string(keyring.WinCredBackend),
+	string(keyring.KeychainBackend),
+	string(keyring.SecretServiceBackend),
+	string(keyring.KWalletBackend),
+	string(keyring.PassBackend),
+	string(keyring.FileBackend),
+	vault.HashiCorpVaultBackend,
+}
+
+// BackendStatus is whether a backend can be used, and why not if it can't
+type BackendStatus struct {
+	Name      string
+	Available bool
+	Default   bool
+	Reason    string
+}
+
+func ConfigureBackendsCommand(app *kingpin.Application) {
+	cmd := app.Command("backends", "Show which secret backends are available")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		return actionFailed(BackendsCommand(os.Stdout), "backends")
+	})
+}
+
+func BackendsCommand(w io.Writer) error {
+	statuses := ProbeBackends()
+
+	tw := tabwriter.NewWriter(w, 16, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "Backend\tAvailable\tNotes\t")
+	fmt.Fprintln(tw, "=======\t=========\t=====\t")
+	for _, s := range statuses {
+		available := "no"
+		if s.Available {
+			available = "yes"
+		}
+		notes := s.Reason
+		if s.Default {
+			notes = "default"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t\n", s.Name, available, notes)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, s := range statuses {
+		if s.Default {
+			return nil
+		}
+	}
+	if primary := backendOrder()[0]; primary != "" {
+		return fmt.Errorf("Backend %q isn't available", primary)
+	}
+	return keyring.ErrNoAvailImpl
+}
+
+// ProbeBackends tries to open each backend. The default is the first one chosen with --backend,
+// otherwise the first that's available
+func ProbeBackends() []BackendStatus {
+	primary := backendOrder()[0]
+	compiledIn := map[string]bool{}
+	for _, b := range keyring.AvailableBackends() {
+		compiledIn[string(b)] = true
+	}
+
+	var statuses []BackendStatus
+	hasDefault := false
+	for _, name := range allBackends {
+		s := BackendStatus{Name: name}
+
+		switch {
+		case name == vault.HashiCorpVaultBackend:
+			if GlobalFlags.VaultAddr == "" {
+				s.Reason = "needs the server address, set --vault-addr or VAULT_ADDR"
+			} else {
+				s.Available = true
+			}
+		case !compiledIn[name]:
+			s.Reason = unsupportedBackendReason(name)
+		default:
+			if _, err := keyring.Open(keyringConfig([]keyring.BackendType{keyring.BackendType(name)})); err != nil {
+				s.Reason = failedBackendReason(name)
+			} else {
+				s.Available = true
+			}
+		}
+
+		if s.Available && !hasDefault && (primary == "" || primary == name) {
+			s.Default = true
+			hasDefault = true
+		}
+		statuses = append(statuses, s)
+	}
+
+	return statuses
+}
+
+// unsupportedBackendReason explains why keyring didn't register a backend
+func unsupportedBackendReason(name string) string {
+	switch keyring.BackendType(name) {
+	case keyring.WinCredBackend:
+		return "only on Windows"
+	case keyring.KeychainBackend:
+		if runtime.GOOS == "darwin" {
+			return "this build of aws-vault doesn't include it, it needs cgo"
+		}
+		return "only on macOS"
+	case keyring.SecretServiceBackend, keyring.KWalletBackend:
+		if runtime.GOOS != "linux" {
+			return "only on Linux"
+		}
+		if name == string(keyring.KWalletBackend) && os.Getenv("DISABLE_KWALLET") == "1" {
+			return "disabled with DISABLE_KWALLET"
+		}
+		return "no D-Bus session bus, check DBUS_SESSION_BUS_ADDRESS"
+	}
+	return "not supported on this platform"
+}
+
+// failedBackendReason explains why a registered backend couldn't be opened, as keyring doesn't return the error
+func failedBackendReason(name string) string {
+	switch keyring.BackendType(name) {
+	case keyring.SecretServiceBackend:
+		return "couldn't open a collection, is a Secret Service like gnome-keyring running?"
+	case keyring.KWalletBackend:
+		return "couldn't open the wallet, is kwalletd running?"
+	case keyring.PassBackend:
+		passCmd := GlobalFlags.PassCmd
+		if passCmd == "" {
+			passCmd = "pass"
+		}
+		if _, err := exec.LookPath(passCmd); err != nil {
+			return fmt.Sprintf("%s isn't installed or isn't on the PATH", passCmd)
+		}
+	}
+	return "couldn't be opened, run with --debug for details"
+}
@@ -0,0 +1,20 @@
+package cli
+
+import (
+	"testing"
+)
+
+func TestProbeBackendsFileIsAlwaysAvailable(t *testing.T) {
+	defer func(backend string) { GlobalFlags.Backend = backend }(GlobalFlags.Backend)
+	GlobalFlags.Backend = "file"
+
+	for _, s := range ProbeBackends() {
+		if s.Name == "file" {
+			if !s.Available || !s.Default {
+				t.Fatalf("Expected the file backend to be available and the default, got %+v", s)
+			}
+			return
+		}
+	}
+	t.Fatal("The file backend wasn't probed")
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ConfigLintCommandInput struct{}
+
+type ConfigShowCommandInput struct {
+	ProfileName string
+}
+
+// configCommand returns the parent command for the config subcommands
+func configCommand(app *kingpin.Application) *kingpin.CmdClause {
+	if cmd := app.GetCommand("config"); cmd != nil {
+		return cmd
+	}
+	return app.Command("config", "Inspect the AWS config file")
+}
+
+func ConfigureConfigLintCommand(app *kingpin.Application) {
+	input := ConfigLintCommandInput{}
+
+	cmd := configCommand(app).Command("lint", "Check all profiles in the AWS config file for problems, without calling AWS")
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		return actionFailed(ConfigLintCommand(os.Stdout, input), "config lint")
+	})
+}
+
+func ConfigLintCommand(w io.Writer, input ConfigLintCommandInput) error {
+	problems := awsConfigFile.Lint()
+	for _, problem := range problems {
+		fmt.Fprintln(w, problem.String())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d problem(s) found in %s", len(problems), awsConfigFile.Path)
+	}
+
+	fmt.Fprintf(w, "No problems found in %s\n", awsConfigFile.Path)
+	return nil
+}
+
+func ConfigureConfigShowCommand(app *kingpin.Application) {
+	input := ConfigShowCommandInput{}
+
+	cmd := configCommand(app).Command("show", "Print the config resolved for a profile and its source profiles, without calling AWS")
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		return actionFailed(ConfigShowCommand(os.Stdout, input), "config show")
+	})
+}
+
+func ConfigShowCommand(w io.Writer, input ConfigShowCommandInput) error {
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 1, ' ', 0)
+	for c := config; c != nil; c = c.SourceProfile {
+		if c != config {
+			fmt.Fprintln(tw)
+		}
+		for _, kv := range configValues(c) {
+			fmt.Fprintf(tw, "%s:\t%s\n", kv[0], kv[1])
+		}
+	}
+	return tw.Flush()
+}
+
+// configValues returns the settings in config that are set, named like the config file keys
+func configValues(config *vault.Config) [][2]string {
+	values := [][2]string{{"profile", config.ProfileName}}
+	add := func(key, value string) {
+		if value != "" {
+			values = append(values, [2]string{key, value})
+		}
+	}
+	addDuration := func(key string, d time.Duration) {
+		if d != 0 {
+			add(key, d.String())
+		}
+	}
+
+	add("source_profile", config.SourceProfileName)
+	if config.StrictSourceProfile {
+		add("strict_source_profile", strconv.FormatBool(config.StrictSourceProfile))
+	}
+	add("region", config.Region)
+	add("console_region", config.ConsoleRegion)
+	add("mfa_serial", config.MfaSerial)
+	add("mfa_prompt", config.MfaPromptMethod)
+	add("mfa_token_cmd", config.MfaTokenCmd)
+	if config.NoCacheWithMfa {
+		add("no_cache_with_mfa", strconv.FormatBool(config.NoCacheWithMfa))
+	}
+	if config.VerifyMfaSession {
+		add("verify_mfa_session", strconv.FormatBool(config.VerifyMfaSession))
+	}
+	add("get_session_token", config.GetSessionToken)
+	if len(config.ChainedRoleARNs) > 0 {
+		add("role_arns", strings.Join(append(config.ChainedRoleARNs[:len(config.ChainedRoleARNs):len(config.ChainedRoleARNs)], config.RoleARN), ","))
+	}
+	add("role_arn", config.RoleARN)
+	add("assume_role_mfa", config.AssumeRoleMfa)
+	add("role_session_name", config.RoleSessionName)
+	add("external_id", config.ExternalID)
+	if config.AssumeRoleDurationAuto {
+		add("assume_role_duration", "auto")
+	} else {
+		addDuration("assume_role_duration", config.AssumeRoleDuration)
+	}
+	addDuration("session_token_duration", config.GetSessionTokenDuration)
+	addDuration("chained_session_token_duration", config.ChainedGetSessionTokenDuration)
+	addDuration("federation_token_duration", config.GetFederationTokenDuration)
+	addDuration("allow_expired_grace", config.AllowExpiredGrace)
+	add("session_cache_id", config.SessionCacheID)
+	addDuration("http_dial_timeout", config.HTTPDialTimeout)
+	addDuration("http_tls_handshake_timeout", config.HTTPTLSHandshakeTimeout)
+	addDuration("http_keepalive", config.HTTPKeepAlive)
+	add("federation_policy", config.FederationPolicy)
+	add("credential_process", config.CredentialProcess)
+	addDuration("credential_process_cache_ttl", config.CredentialProcessCacheTTL)
+	add("credential_source", config.CredentialSource)
+	add("ec2_metadata_service_endpoint", config.Ec2MetadataEndpoint)
+	addDuration("ec2_metadata_token_ttl", config.Ec2MetadataTokenTTL)
+	if config.Ec2MetadataV1Disabled {
+		add("ec2_metadata_v1_disabled", strconv.FormatBool(config.Ec2MetadataV1Disabled))
+	}
+	add("saml_provider_arn", config.SamlProviderARN)
+	add("saml_assertion_cmd", config.SamlAssertionCmd)
+	add("saml_assertion_file", config.SamlAssertionFile)
+	add("web_identity_token_file", config.WebIdentityTokenFile)
+	add("sso_start_url", config.SSOStartURL)
+	add("sso_region", config.SSORegion)
+	add("sso_account_id", config.SSOAccountID)
+	add("sso_role_name", config.SSORoleName)
+	add("on_refresh_cmd", config.OnRefreshCmd)
+	add("on_rotate_cmd", config.OnRotateCmd)
+
+	return values
+}
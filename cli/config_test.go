@@ -0,0 +1,64 @@
+package cli
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func ExampleConfigShowCommand() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`[default]
+region = us-east-1
+
+[profile read-only]
+mfa_serial = arn:aws:iam::123456789012:mfa/jonsmith
+
+[profile target]
+source_profile = read-only
+role_arn = arn:aws:iam::123456789012:role/target
+duration_seconds = 7200
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	awsConfigFile, err = vault.LoadConfig(f.Name())
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyringImpl = keyring.NewArrayKeyring(nil)
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureConfigShowCommand(app)
+	kingpin.MustParse(app.Parse([]string{"config", "show", "target"}))
+
+	// Output:
+	// profile:                        target
+	// source_profile:                 read-only
+	// region:                         us-east-1
+	// role_arn:                       arn:aws:iam::123456789012:role/target
+	// assume_role_duration:           2h0m0s
+	// session_token_duration:         1h0m0s
+	// chained_session_token_duration: 8h0m0s
+	// federation_token_duration:      1h0m0s
+	//
+	// profile:                        read-only
+	// region:                         us-east-1
+	// mfa_serial:                     arn:aws:iam::123456789012:mfa/jonsmith
+	// assume_role_duration:           1h0m0s
+	// session_token_duration:         1h0m0s
+	// chained_session_token_duration: 8h0m0s
+	// federation_token_duration:      1h0m0s
+}
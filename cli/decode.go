@@ -0,0 +1,155 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type DecodeCommandInput struct {
+	ProfileName string
+	Keyring     *vault.CredentialKeyring
+	Config      vault.Config
+	Format      string
+}
+
+// SessionInfo is the non-secret metadata of the credentials for a profile
+type SessionInfo struct {
+	Profile     string `json:"Profile"`
+	Type        string `json:"Type"`
+	AccessKeyID string `json:"AccessKeyId"`
+	Expiration  string `json:"Expiration,omitempty"`
+	Account     string `json:"Account"`
+	Arn         string `json:"Arn"`
+	RoleArn     string `json:"RoleArn,omitempty"`
+	SessionName string `json:"SessionName,omitempty"`
+}
+
+func ConfigureDecodeCommand(app *kingpin.Application) {
+	input := DecodeCommandInput{}
+
+	cmd := app.Command("decode", "Show what the credentials for a profile are, without showing the secrets")
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Flag("format", "Output format [text, json]").
+		Default("text").
+		EnumVar(&input.Format, "text", "json")
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(DecodeCommand(input), "decode")
+	})
+}
+
+func DecodeCommand(input DecodeCommandInput) error {
+	configLoader.BaseConfig = input.Config
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	var val credentials.Value
+	var expiration time.Time
+	var resp *sts.GetCallerIdentityOutput
+	ctx, cancel := credentialsContext()
+	defer cancel()
+	err = vault.WithTempCredentials(config, input.Keyring, func(creds *vault.ContextCredentials) error {
+		if val, err = getCredentials(ctx, creds); err != nil {
+			return err
+		}
+		if expiration, err = creds.ExpiresAt(); err != nil {
+			expiration = time.Time{}
+		}
+		sess, err := vault.NewProfileSession(creds.Credentials, config)
+		if err != nil {
+			return err
+		}
+		resp, err = sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+		return timeoutError(ctx, err)
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity for %s: %w", input.ProfileName, err)
+	}
+
+	info := describeSession(val.AccessKeyID, aws.StringValue(resp.Arn))
+	info.Profile = input.ProfileName
+	info.Account = aws.StringValue(resp.Account)
+	if !expiration.IsZero() {
+		info.Expiration = expiration.Format(time.RFC3339)
+	}
+
+	if input.Format == "json" {
+		b, err := marshalJSON(&info)
+		if err != nil {
+			return fmt.Errorf("Error creating session json: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("Profile:       %s\n", info.Profile)
+	fmt.Printf("Type:          %s\n", info.Type)
+	fmt.Printf("Access key:    %s\n", info.AccessKeyID)
+	if info.Expiration != "" {
+		fmt.Printf("Expiration:    %s (in %s)\n", info.Expiration, time.Until(expiration).Round(time.Second))
+	}
+	fmt.Printf("Account:       %s\n", info.Account)
+	fmt.Printf("Arn:           %s\n", info.Arn)
+	if info.RoleArn != "" {
+		fmt.Printf("Role:          %s\n", info.RoleArn)
+		fmt.Printf("Session name:  %s\n", info.SessionName)
+	}
+	return nil
+}
+
+// describeSession works out what kind of credentials the access key is from the caller's ARN. An
+// assumed-role ARN doesn't include the role's path, so RoleArn may differ from the role_arn assumed
+func describeSession(accessKeyID, callerArn string) SessionInfo {
+	info := SessionInfo{
+		AccessKeyID: vault.FormatKeyForDisplay(accessKeyID),
+		Arn:         callerArn,
+	}
+
+	temporary := strings.HasPrefix(accessKeyID, "ASIA")
+	a, err := arn.Parse(callerArn)
+	if err != nil {
+		info.Type = "unknown"
+		return info
+	}
+
+	parts := strings.Split(a.Resource, "/")
+	switch {
+	case a.Service == "sts" && parts[0] == "assumed-role" && len(parts) == 3:
+		info.Type = "role session (AssumeRole)"
+		info.RoleArn = arn.ARN{Partition: a.Partition, Service: "iam", AccountID: a.AccountID, Resource: "role/" + parts[1]}.String()
+		info.SessionName = parts[2]
+	case a.Service == "sts" && parts[0] == "federated-user":
+		info.Type = "federation token (GetFederationToken)"
+	case parts[0] == "root" && temporary:
+		info.Type = "root session token (GetSessionToken)"
+	case parts[0] == "root":
+		info.Type = "root account credentials"
+	case temporary:
+		info.Type = "session token (GetSessionToken)"
+	default:
+		info.Type = "IAM user credentials"
+	}
+	return info
+}
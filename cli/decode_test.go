@@ -0,0 +1,27 @@
+package cli
+
+import "testing"
+
+func TestDescribeSession(t *testing.T) {
+	tests := []struct {
+		accessKeyID, arn string
+		expectedType     string
+		expectedRole     string
+	}{
+		{"ASIAEXAMPLE1234", "arn:aws:sts::123456789012:assumed-role/Admin/alice", "role session (AssumeRole)", "arn:aws:iam::123456789012:role/Admin"},
+		{"ASIAEXAMPLE1234", "arn:aws:iam::123456789012:user/alice", "session token (GetSessionToken)", ""},
+		{"AKIAEXAMPLE1234", "arn:aws:iam::123456789012:user/alice", "IAM user credentials", ""},
+		{"ASIAEXAMPLE1234", "arn:aws:sts::123456789012:federated-user/alice", "federation token (GetFederationToken)", ""},
+		{"ASIAEXAMPLE1234", "arn:aws:iam::123456789012:root", "root session token (GetSessionToken)", ""},
+	}
+
+	for _, tt := range tests {
+		info := describeSession(tt.accessKeyID, tt.arn)
+		if info.Type != tt.expectedType || info.RoleArn != tt.expectedRole {
+			t.Errorf("%s: expected %q and role %q, got %q and role %q", tt.arn, tt.expectedType, tt.expectedRole, info.Type, info.RoleArn)
+		}
+		if info.AccessKeyID != "****************1234" {
+			t.Errorf("Expected the access key to be masked, got %s", info.AccessKeyID)
+		}
+	}
+}
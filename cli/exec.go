@@ -1,13 +1,17 @@
 package cli
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
@@ -15,6 +19,8 @@ import (
 	"github.com/99designs/aws-vault/server"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
@@ -24,12 +30,34 @@ type ExecCommandInput struct {
 	Args             []string
 	Keyring          keyring.Keyring
 	StartServer      bool
+	EcsServer        bool
+	EcsServerAddr    string
+	EcsTokenFile     bool
 	CredentialHelper bool
 	Config           vault.Config
 	SessionDuration  time.Duration
+	SessionTTL       time.Duration
+	AssumeRoleTTL    time.Duration
 	NoSession        bool
+	MinDuration      time.Duration
+	NoInject         bool
+	CacheOnly        bool
+	Refresh          bool
+	Validate         bool
+	Watch            bool
+	RunAs            string
+	EnvAllowlist     []string
+	Federated        bool
+	PolicyFile       string
+	SessionName      string
+	EnvFile          bool
+	PrintEnv         bool
+	ShowExpiry       bool
 }
 
+// defaultAllowedEnv are passed to the command when an env allowlist is used, unless excluded
+var defaultAllowedEnv = []string{"PATH", "HOME", "TERM"}
+
 // AwsCredentialHelperData is metadata for AWS CLI credential process
 // See https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
 type AwsCredentialHelperData struct {
@@ -49,6 +77,15 @@ func ConfigureExecCommand(app *kingpin.Application) {
 		Short('d').
 		DurationVar(&input.SessionDuration)
 
+	cmd.Flag("session-ttl", "Duration of the GetSessionToken session, overriding --duration and the config").
+		DurationVar(&input.SessionTTL)
+
+	cmd.Flag("assume-role-ttl", "Duration of the assume-role session, overriding --duration and the config").
+		DurationVar(&input.AssumeRoleTTL)
+
+	cmd.Flag("min-duration", "Fail unless the credentials are valid for at least this long, refreshing cached sessions that expire sooner").
+		DurationVar(&input.MinDuration)
+
 	cmd.Flag("no-session", "Don't create a session with GetSessionToken").
 		Short('n').
 		BoolVar(&input.NoSession)
@@ -57,18 +94,77 @@ func ConfigureExecCommand(app *kingpin.Application) {
 		Short('t').
 		StringVar(&input.Config.MfaToken)
 
+	cmd.Flag("no-mfa", "Don't use MFA, even if mfa_serial is set, for roles and sessions whose policies don't require it").
+		BoolVar(&input.Config.NoMfa)
+
 	cmd.Flag("json", "AWS credential helper. Ref: https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes").
 		Short('j').
 		BoolVar(&input.CredentialHelper)
 
+	cmd.Flag("watch", "With --json, keep running and print the credentials as a line of JSON again each time they're refreshed before expiring").
+		BoolVar(&input.Watch)
+
 	cmd.Flag("server", "Run the server in the background for credentials").
 		Short('s').
 		BoolVar(&input.StartServer)
 
-	cmd.Arg("profile", "Name of the profile").
-		Required().
-		HintAction(awsConfigFile.ProfileNames).
-		StringVar(&input.ProfileName)
+	cmd.Flag("ecs-server", "Run an ECS credentials server on a random local port for the command, which refreshes the credentials whenever they expire. Doesn't need root").
+		BoolVar(&input.EcsServer)
+
+	cmd.Flag("ecs-server-addr", "Loopback address for --ecs-server to listen on, such as 127.0.0.1:9911, instead of a random port").
+		PlaceHolder("ADDR").
+		StringVar(&input.EcsServerAddr)
+
+	cmd.Flag("ecs-token-file", "With --ecs-server, pass the authorization token in a file named by AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE, rather than in AWS_CONTAINER_AUTHORIZATION_TOKEN").
+		BoolVar(&input.EcsTokenFile)
+
+	cmd.Flag("source-fd", "Read the source credentials as credential_process JSON from this file descriptor instead of the keyring").
+		PlaceHolder("FD").
+		IntVar(&input.Config.SourceFD)
+
+	cmd.Flag("credential-process-ttl", "Cache credential_process output that has no Expiration for this long. Defaults to not caching it").
+		DurationVar(&input.Config.CredentialProcessCacheTTL)
+
+	cmd.Flag("cache-only", "Only use cached credentials, failing rather than calling STS or prompting for MFA").
+		BoolVar(&input.CacheOnly)
+
+	cmd.Flag("refresh", "Ignore cached credentials, creating and caching new ones").
+		BoolVar(&input.Refresh)
+
+	cmd.Flag("validate", "Check the stored credentials work with GetCallerIdentity before using them").
+		BoolVar(&input.Validate)
+
+	cmd.Flag("no-inject", "Resolve and cache credentials, but run the command with an unmodified environment").
+		BoolVar(&input.NoInject)
+
+	cmd.Flag("env", "Only pass these environment variables to the command, along with PATH, HOME, TERM and the AWS variables set by aws-vault. Can be repeated or comma-separated, prefix with - to exclude a default").
+		PlaceHolder("NAME").
+		StringsVar(&input.EnvAllowlist)
+
+	cmd.Flag("env-file", "Write the AWS variables to a temporary env file for the command, such as docker run --env-file \"$AWS_VAULT_ENV_FILE\", instead of setting them in its environment").
+		BoolVar(&input.EnvFile)
+
+	cmd.Flag("show-expiry", "Print when the credentials expire to stderr before running the command").
+		BoolVar(&input.ShowExpiry)
+
+	cmd.Flag("print-env", "Print the environment variables the command would get, with secrets masked, and what they replace, without running it").
+		BoolVar(&input.PrintEnv)
+
+	cmd.Flag("run-as", "Run the command as this OS user, with the credentials but without access to the keyring. Usually requires root. Not supported on Windows").
+		PlaceHolder("USER").
+		StringVar(&input.RunAs)
+
+	cmd.Flag("session-name", "RoleSessionName for the role assumed by the profile in this run, overriding role_session_name. The session isn't cached").
+		StringVar(&input.SessionName)
+
+	cmd.Flag("federated", "Use GetFederationToken for the IAM user's credentials, so they can be scoped down with --policy or federation_policy").
+		BoolVar(&input.Federated)
+
+	cmd.Flag("policy", "With --federated, a JSON file of the IAM policy that scopes down the credentials, overriding federation_policy").
+		PlaceHolder("FILE").
+		StringVar(&input.PolicyFile)
+
+	profileArg(cmd, &input.ProfileName)
 
 	cmd.Arg("cmd", "Command to execute, defaults to $SHELL").
 		Default(os.Getenv("SHELL")).
@@ -78,12 +174,27 @@ func ConfigureExecCommand(app *kingpin.Application) {
 		StringsVar(&input.Args)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
+		// with a profile from the project file, "exec -- cmd" parses cmd as the profile
+		if cmdline, ok := projectCommand(c.Elements, input.ProfileName, awsConfigFile); ok {
+			input.ProfileName = currentProjectFile().Profile
+			input.Command = cmdline[0]
+			input.Args = cmdline[1:]
+		}
 		input.Keyring = keyringImpl
 		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
 		input.Config.GetSessionTokenDuration = input.SessionDuration
 		input.Config.AssumeRoleDuration = input.SessionDuration
-		app.FatalIfError(ExecCommand(input), "exec")
-		return nil
+		if input.SessionTTL != 0 {
+			input.Config.GetSessionTokenDuration = input.SessionTTL
+		}
+		if input.AssumeRoleTTL != 0 {
+			input.Config.AssumeRoleDuration = input.AssumeRoleTTL
+		}
+		input.Config.GetFederationTokenDuration = input.SessionDuration
+		if input.PolicyFile != "" {
+			input.Config.FederationPolicy = "file://" + input.PolicyFile
+		}
+		return actionFailed(ExecCommand(input), "exec")
 	})
 }
 
@@ -92,35 +203,159 @@ func ExecCommand(input ExecCommandInput) error {
 		return fmt.Errorf("aws-vault sessions should be nested with care, unset $AWS_VAULT to force")
 	}
 
+	if input.NoInject && (input.StartServer || input.EcsServer || input.CredentialHelper) {
+		return fmt.Errorf("--no-inject can't be used with --server, --ecs-server or --json")
+	}
+
+	if input.EcsServer && (input.StartServer || input.CredentialHelper) {
+		return fmt.Errorf("--ecs-server can't be used with --server or --json")
+	}
+
+	if (input.EcsServerAddr != "" || input.EcsTokenFile) && !input.EcsServer {
+		return fmt.Errorf("--ecs-server-addr and --ecs-token-file can only be used with --ecs-server")
+	}
+
+	if input.EcsTokenFile && input.RunAs != "" {
+		return fmt.Errorf("--ecs-token-file can't be used with --run-as, as the other user can't read the token file")
+	}
+
+	if input.RunAs != "" && (input.NoInject || input.CredentialHelper) {
+		return fmt.Errorf("--run-as can't be used with --no-inject or --json")
+	}
+
+	if input.EnvFile && (input.NoInject || input.CredentialHelper || input.StartServer || input.EcsServer || input.RunAs != "") {
+		return fmt.Errorf("--env-file can't be used with --no-inject, --json, --server, --ecs-server or --run-as")
+	}
+
+	if input.PrintEnv && (input.NoInject || input.CredentialHelper || input.StartServer || input.EcsServer || input.EnvFile) {
+		return fmt.Errorf("--print-env can't be used with --no-inject, --json, --server, --ecs-server or --env-file")
+	}
+
+	if input.Watch && !input.CredentialHelper {
+		return fmt.Errorf("--watch can only be used with --json")
+	}
+
+	if input.Watch && GlobalFlags.Pretty {
+		return fmt.Errorf("--watch can't be used with --pretty, as it prints a line of JSON each time")
+	}
+
+	if input.Refresh && input.CacheOnly {
+		return fmt.Errorf("--refresh can't be used with --cache-only")
+	}
+
+	if input.Config.NoMfa && input.Config.MfaToken != "" {
+		return fmt.Errorf("--no-mfa can't be used with --mfa-token")
+	}
+
+	if input.PolicyFile != "" && !input.Federated {
+		return fmt.Errorf("--policy can only be used with --federated")
+	}
+
+	if input.Federated && (input.NoSession || input.MinDuration > 0) {
+		return fmt.Errorf("--federated can't be used with --no-session or --min-duration")
+	}
+
 	vault.UseSession = !input.NoSession
+	vault.CacheOnly = input.CacheOnly
+	vault.Refresh = input.Refresh
+	vault.ValidateStoredCredentials = input.Validate
 	setEnv := true
 
+	// credentials from a file descriptor shouldn't lead to sessions being cached in the keyring
+	if input.Config.SourceFD != 0 {
+		vault.UseSessionCache = false
+	}
+
 	configLoader.BaseConfig = input.Config
 	configLoader.ActiveProfile = input.ProfileName
 	config, err := configLoader.LoadFromProfile(input.ProfileName)
 	if err != nil {
 		return err
 	}
+	if err = config.ValidateDurations(); err != nil {
+		return &vault.ConfigError{Err: err}
+	}
+	if err = overrideRoleSessionName(config, input.SessionName); err != nil {
+		return err
+	}
 
 	credKeyring := &vault.CredentialKeyring{Keyring: input.Keyring}
-	creds, err := vault.NewTempCredentials(config, credKeyring)
+	ctx, cancel := credentialsContext()
+	defer cancel()
+
+	var creds *vault.ContextCredentials
+	if input.Federated {
+		// GetFederationToken is only available to IAM users, so it can't follow a role
+		if config.RoleARN != "" {
+			return fmt.Errorf("--federated needs a profile with IAM user credentials, but %s assumes a role", input.ProfileName)
+		}
+		// without a policy the credentials would have all of the IAM user's permissions
+		if config.FederationPolicy == "" {
+			return fmt.Errorf("--federated needs a policy to scope down the credentials, set --policy or federation_policy for %s", input.ProfileName)
+		}
+		creds, err = vault.NewFederationTokenCredentialsWithContext(input.ProfileName, credKeyring, config)
+	} else if input.MinDuration > 0 {
+		creds, err = vault.NewTempCredentialsWithMinDuration(ctx, config, credKeyring, input.MinDuration)
+	} else {
+		creds, err = vault.NewTempCredentialsWithContext(config, credKeyring)
+	}
 	if err != nil {
-		return fmt.Errorf("Error getting temporary credentials: %w", err)
+		return fmt.Errorf("Error getting temporary credentials: %w", timeoutError(ctx, err))
 	}
 
-	val, err := creds.Get()
+	val, err := getCredentials(ctx, creds)
 	if err != nil {
+		if input.Config.NoMfa && isAccessDenied(err) {
+			return &vault.MfaError{Err: fmt.Errorf("Failed to get credentials for %s without MFA, it may be required, try again without --no-mfa: %w", input.ProfileName, err)}
+		}
 		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
 	}
 
+	// later refreshes, such as by the server, can use the credentials just cached
+	vault.Refresh = false
+
+	if input.ShowExpiry {
+		printExpiry(os.Stderr, creds.Credentials)
+	}
+
+	if input.NoInject {
+		log.Printf("Resolved credentials for %s, running the command with an unmodified environment", input.ProfileName)
+		env := environ(os.Environ())
+		env.Unset("AWS_VAULT_FILE_PASSPHRASE")
+		path, err := lookPathForProfile(input.Command, env, input.ProfileName)
+		if err != nil {
+			return err
+		}
+		if err = execSyscall(path, input.Command, input.Args, env); err != nil {
+			return fmt.Errorf("Error execing process: %w", err)
+		}
+		return nil
+	}
+
 	if input.StartServer {
-		if err := server.StartCredentialsServer(creds); err != nil {
+		if err := server.StartCredentialsServer(creds.Credentials); err != nil {
 			return fmt.Errorf("Failed to start credential server: %w", err)
 		}
 		setEnv = false
 	}
 
-	if input.CredentialHelper {
+	var ecsServer *server.EcsServer
+	if input.EcsServer {
+		if ecsServer, err = server.StartEcsCredentialsServer(creds.Credentials, input.EcsServerAddr); err != nil {
+			return fmt.Errorf("Failed to start ECS credentials server: %w", err)
+		}
+		defer ecsServer.Close()
+		if input.EcsTokenFile {
+			if _, err = ecsServer.WriteTokenFile(); err != nil {
+				return fmt.Errorf("Failed to write the ECS credentials server's token file: %w", err)
+			}
+		}
+		setEnv = false
+	}
+
+	if input.CredentialHelper && input.Watch {
+		return watchCredentials(os.Stdout, creds.Credentials, val)
+	} else if input.CredentialHelper {
 		credentialData := AwsCredentialHelperData{
 			Version:         1,
 			AccessKeyID:     val.AccessKeyID,
@@ -132,9 +367,11 @@ func ExecCommand(input ExecCommandInput) error {
 			if err != nil {
 				return fmt.Errorf("Error getting credential expiration: %w", err)
 			}
-			credentialData.Expiration = credsExprest.Format("2006-01-02T15:04:05Z")
+			if !credsExprest.IsZero() {
+				credentialData.Expiration = credsExprest.Format("2006-01-02T15:04:05Z")
+			}
 		}
-		json, err := json.Marshal(&credentialData)
+		json, err := marshalJSON(&credentialData)
 		if err != nil {
 			return fmt.Errorf("Error creating credential json: %w", err)
 		}
@@ -142,8 +379,14 @@ func ExecCommand(input ExecCommandInput) error {
 	} else {
 
 		env := environ(os.Environ())
+		if len(input.EnvAllowlist) > 0 {
+			env = env.Allow(allowedEnvKeys(input.EnvAllowlist))
+		}
 		env.Set("AWS_VAULT", input.ProfileName)
 
+		// the command doesn't need to unlock the keyring, so the passphrase isn't passed on
+		env.Unset("AWS_VAULT_FILE_PASSPHRASE")
+
 		env.Unset("AWS_ACCESS_KEY_ID")
 		env.Unset("AWS_SECRET_ACCESS_KEY")
 		env.Unset("AWS_CREDENTIAL_FILE")
@@ -156,27 +399,63 @@ func ExecCommand(input ExecCommandInput) error {
 			env.Set("AWS_REGION", config.Region)
 		}
 
+		// with --env-file the credentials are written to the file rather than the environment
+		credEnv := &env
+		var fileEnv environ
+		if input.EnvFile {
+			fileEnv = environ{"AWS_VAULT=" + input.ProfileName}
+			if config.Region != "" {
+				fileEnv.Set("AWS_DEFAULT_REGION", config.Region)
+				fileEnv.Set("AWS_REGION", config.Region)
+			}
+			credEnv = &fileEnv
+		}
+
 		if setEnv {
 			log.Println("Setting subprocess env: AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY")
-			env.Set("AWS_ACCESS_KEY_ID", val.AccessKeyID)
-			env.Set("AWS_SECRET_ACCESS_KEY", val.SecretAccessKey)
+			credEnv.Set("AWS_ACCESS_KEY_ID", val.AccessKeyID)
+			credEnv.Set("AWS_SECRET_ACCESS_KEY", val.SecretAccessKey)
 
 			if val.SessionToken != "" {
 				log.Println("Setting subprocess env: AWS_SESSION_TOKEN, AWS_SECURITY_TOKEN")
-				env.Set("AWS_SESSION_TOKEN", val.SessionToken)
-				env.Set("AWS_SECURITY_TOKEN", val.SessionToken)
+				credEnv.Set("AWS_SESSION_TOKEN", val.SessionToken)
+				credEnv.Set("AWS_SECURITY_TOKEN", val.SessionToken)
 				expiration, err := creds.ExpiresAt()
 				if err == nil {
 					log.Println("Setting subprocess env: AWS_SESSION_EXPIRATION")
-					env.Set("AWS_SESSION_EXPIRATION", expiration.Format(time.RFC3339))
+					credEnv.Set("AWS_SESSION_EXPIRATION", expiration.Format(time.RFC3339))
 				}
 			}
 		}
 
-		if input.StartServer {
-			err = execCmd(input.Command, input.Args, env)
+		if ecsServer != nil {
+			log.Println("Setting subprocess env: AWS_CONTAINER_CREDENTIALS_FULL_URI")
+			env.Unset("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI")
+			env.Set("AWS_CONTAINER_CREDENTIALS_FULL_URI", ecsServer.URL)
+			setEcsServerToken(&env, ecsServer)
+		}
+
+		if input.PrintEnv {
+			printEnvDiff(os.Stdout, environ(os.Environ()), env)
+			return nil
+		}
+
+		// the command is found with the PATH it's run with, which can differ from aws-vault's
+		path, err := lookPathForProfile(input.Command, env, input.ProfileName)
+		if err != nil {
+			return err
+		}
+
+		if input.EnvFile {
+			err = execCmdWithEnvFile(path, input.Command, input.Args, env, fileEnv)
+		} else if input.RunAs != "" {
+			err = execCmdAsUser(path, input.Command, input.Args, env, input.RunAs)
+		} else if ecsServer != nil {
+			err = execCmdWithEcsServer(path, input.Command, input.Args, env, ecsServer)
+		} else if input.StartServer {
+			err = execCmd(path, input.Command, input.Args, env)
 		} else {
-			err = execSyscall(input.Command, input.Args, env)
+			err = execSyscall(path, input.Command, input.Args, env)
 		}
 
 		if err != nil {
@@ -187,6 +466,40 @@ func ExecCommand(input ExecCommandInput) error {
 	return nil
 }
 
+// printExpiry writes a line saying when creds expire, for the user rather than the command
+func printExpiry(w io.Writer, creds *credentials.Credentials) {
+	expiration, err := creds.ExpiresAt()
+	if err != nil || expiration.IsZero() {
+		fmt.Fprintln(w, "Credentials don't expire")
+		return
+	}
+	fmt.Fprintf(w, "Credentials valid until %s (%s)\n", expiration.Local().Format(time.RFC3339), time.Until(expiration).Round(time.Minute))
+}
+
+// isAccessDenied returns true if STS refused the request, which is how it fails when MFA is required
+func isAccessDenied(err error) bool {
+	var awsErr awserr.Error
+	return errors.As(err, &awsErr) && awsErr.Code() == "AccessDenied"
+}
+
+// overrideRoleSessionName sets the RoleSessionName of the profile's role for a single run, so the
+// session isn't cached for later runs to reuse
+func overrideRoleSessionName(config *vault.Config, name string) error {
+	if name == "" {
+		return nil
+	}
+	if config.RoleARN == "" {
+		return &vault.ConfigError{Err: fmt.Errorf("--session-name needs a profile with a role_arn, but %s doesn't assume a role", config.ProfileName)}
+	}
+	if err := vault.ValidateRoleSessionName(name); err != nil {
+		return &vault.ConfigError{Err: fmt.Errorf("--session-name: %w", err)}
+	}
+	log.Printf("Using role session name %q for %s", name, config.ProfileName)
+	config.RoleSessionName = name
+	config.NoRoleSessionCache = true
+	return nil
+}
+
 // environ is a slice of strings representing the environment, in the form "key=value".
 type environ []string
 
@@ -207,18 +520,259 @@ func (e *environ) Set(key, val string) {
 	*e = append(*e, key+"="+val)
 }
 
-func execCmd(command string, args []string, env []string) error {
-	cmd := exec.Command(command, args...)
+// Allow returns only the environment variables with the given keys
+func (e environ) Allow(keys map[string]bool) environ {
+	var allowed environ
+	for _, kv := range e {
+		if keys[strings.SplitN(kv, "=", 2)[0]] {
+			allowed = append(allowed, kv)
+		}
+	}
+	return allowed
+}
+
+// secretEnvKeys are hidden by printEnvDiff. Only the end of an access key id is shown, like elsewhere in
+// aws-vault, as it identifies the key without being secret on its own
+var secretEnvKeys = map[string]bool{
+	"AWS_ACCESS_KEY_ID":                 true,
+	"AWS_SECRET_ACCESS_KEY":             true,
+	"AWS_SESSION_TOKEN":                 true,
+	"AWS_SECURITY_TOKEN":                true,
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN": true,
+	"AWS_VAULT_FILE_PASSPHRASE":         true,
+}
+
+// Map returns the environment variables by key
+func (e environ) Map() map[string]string {
+	m := map[string]string{}
+	for _, kv := range e {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			m[parts[0]] = parts[1]
+		}
+	}
+	return m
+}
+
+// printEnvDiff prints the variables that are set (+), replaced (~) or unset (-) going from before to after.
+// Only AWS variables are listed as unset, as --env drops everything else not allowed
+func printEnvDiff(w io.Writer, before, after environ) {
+	beforeVars, afterVars := before.Map(), after.Map()
+	mask := func(key, val string) string {
+		switch {
+		case !secretEnvKeys[key]:
+			return val
+		case key == "AWS_ACCESS_KEY_ID" && len(val) >= 4:
+			return vault.FormatKeyForDisplay(val)
+		default:
+			return "(hidden)"
+		}
+	}
+
+	var keys []string
+	for k := range afterVars {
+		keys = append(keys, k)
+	}
+	for k := range beforeVars {
+		if _, ok := afterVars[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	dropped := 0
+	for _, k := range keys {
+		old, wasSet := beforeVars[k]
+		val, isSet := afterVars[k]
+		switch {
+		case isSet && !wasSet:
+			fmt.Fprintf(w, "+ %s=%s\n", k, mask(k, val))
+		case isSet && old != val:
+			fmt.Fprintf(w, "~ %s=%s (was %s)\n", k, mask(k, val), mask(k, old))
+		case !isSet && strings.HasPrefix(k, "AWS_"):
+			fmt.Fprintf(w, "- %s (was %s)\n", k, mask(k, old))
+		case !isSet:
+			dropped++
+		}
+	}
+	if dropped > 0 {
+		fmt.Fprintf(w, "%d other variables aren't passed on because of --env\n", dropped)
+	}
+}
+
+// allowedEnvKeys parses --env values into the set of allowed keys, including the defaults
+func allowedEnvKeys(values []string) map[string]bool {
+	keys := map[string]bool{}
+	for _, k := range defaultAllowedEnv {
+		keys[k] = true
+	}
+	for _, v := range values {
+		for _, k := range strings.Split(v, ",") {
+			k = strings.TrimSpace(k)
+			if strings.HasPrefix(k, "-") {
+				delete(keys, strings.TrimPrefix(k, "-"))
+			} else if k != "" {
+				keys[k] = true
+			}
+		}
+	}
+	return keys
+}
+
+// lookPath finds the executable for command in the PATH of env, the environment it will be run
+// with. aws-vault's own PATH is used if env doesn't have one
+func lookPath(command string, env environ) (string, error) {
+	pathEnv, ok := env.Map()["PATH"]
+	if !ok || strings.ContainsAny(command, `/`+string(os.PathSeparator)) {
+		return exec.LookPath(command)
+	}
+
+	for _, dir := range filepath.SplitList(pathEnv) {
+		if dir == "" {
+			// an empty entry is the current directory
+			dir = "."
+		}
+		// joined with a separator, LookPath only checks the file is executable rather than searching
+		if path, err := exec.LookPath(dir + string(os.PathSeparator) + command); err == nil {
+			return path, nil
+		}
+	}
+	return "", &exec.Error{Name: command, Err: exec.ErrNotFound}
+}
+
+// lookPathForProfile is lookPath with an error for the user that names the profile the command was run with
+func lookPathForProfile(command string, env environ, profileName string) (string, error) {
+	path, err := lookPath(command, env)
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", fmt.Errorf("Command %q wasn't found for profile %s, check it's installed and in the PATH: %w", command, profileName, exec.ErrNotFound)
+	} else if err != nil {
+		return "", fmt.Errorf("Can't run %q with profile %s: %w", command, profileName, err)
+	}
+	return path, nil
+}
+
+// newCmd returns a command running the executable at path, with command as its name in the arguments
+func newCmd(path string, command string, args []string) *exec.Cmd {
+	return &exec.Cmd{Path: path, Args: append([]string{command}, args...)}
+}
+
+func execCmd(path string, command string, args []string, env []string) error {
+	cmd := newCmd(path, command, args)
+	cmd.Env = env
+	return runCmd(cmd)
+}
+
+// execCmdAsUser runs the command as another OS user. The user's HOME, USER and LOGNAME are set so
+// the command doesn't try to use files belonging to the user running aws-vault
+func execCmdAsUser(path string, command string, args []string, env environ, userName string) error {
+	cmd := newCmd(path, command, args)
+	homeDir, err := runAsUser(cmd, userName)
+	if err != nil {
+		return fmt.Errorf("Can't run the command as %s: %w", userName, err)
+	}
+
+	log.Printf("Running the command as user %s", userName)
+	env.Set("HOME", homeDir)
+	env.Set("USER", userName)
+	env.Set("LOGNAME", userName)
+	cmd.Env = env
+	return runCmd(cmd)
+}
+
+// execCmdWithEnvFile runs the command with fileEnv written to a temporary env file, named by
+// AWS_VAULT_ENV_FILE, so the credentials don't show up in docker inspect or the process arguments.
+// The file is removed when the command exits
+func execCmdWithEnvFile(path string, command string, args []string, env environ, fileEnv environ) error {
+	envFilePath, err := writeEnvFile(fileEnv)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(envFilePath)
+
+	log.Printf("Setting subprocess env: AWS_VAULT_ENV_FILE=%s", envFilePath)
+	env.Set("AWS_VAULT_ENV_FILE", envFilePath)
+	cmd := newCmd(path, command, args)
+	cmd.Env = env
+
+	status, err := waitForCmd(cmd)
+	if err != nil {
+		return err
+	}
+	os.Remove(envFilePath)
+	os.Exit(status)
+	return nil
+}
+
+// execCmdWithEcsServer runs the command, stopping the ECS credentials server when it exits so that
+// its token file is removed
+func execCmdWithEcsServer(path string, command string, args []string, env environ, ecsServer *server.EcsServer) error {
+	cmd := newCmd(path, command, args)
+	cmd.Env = env
+
+	status, err := waitForCmd(cmd)
+	if err != nil {
+		return err
+	}
+	ecsServer.Close()
+	os.Exit(status)
+	return nil
+}
+
+// setEcsServerToken passes the ECS credentials server's token to the command, in its token file if
+// it has one. The other variable is unset so that a token from aws-vault's own environment isn't used
+func setEcsServerToken(env *environ, ecsServer *server.EcsServer) {
+	if ecsServer.TokenFile != "" {
+		log.Printf("Setting subprocess env: AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=%s", ecsServer.TokenFile)
+		env.Unset("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+		env.Set("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE", ecsServer.TokenFile)
+		return
+	}
+	log.Println("Setting subprocess env: AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	env.Unset("AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE")
+	env.Set("AWS_CONTAINER_AUTHORIZATION_TOKEN", ecsServer.Token)
+}
+
+// writeEnvFile writes env to a new file that only the current user can read, one KEY=value per
+// line as docker's --env-file expects
+func writeEnvFile(env environ) (string, error) {
+	f, err := ioutil.TempFile("", "aws-vault-env")
+	if err != nil {
+		return "", err
+	}
+	for _, kv := range env {
+		if _, err = fmt.Fprintln(f, kv); err != nil {
+			f.Close()
+			os.Remove(f.Name())
+			return "", err
+		}
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// runCmd runs cmd connected to the terminal, forwarding signals to it, and exits with its exit status
+func runCmd(cmd *exec.Cmd) error {
+	status, err := waitForCmd(cmd)
+	if err != nil {
+		return err
+	}
+	os.Exit(status)
+	return nil
+}
+
+// waitForCmd runs cmd connected to the terminal, forwarding signals to it, and returns its exit status
+func waitForCmd(cmd *exec.Cmd) (int, error) {
 	cmd.Stdin = os.Stdin
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env = env
 
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan)
 
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("Failed to start command: %v", err)
+		return 0, fmt.Errorf("Failed to start command: %v", err)
 	}
 
 	go func() {
@@ -229,32 +783,29 @@ func execCmd(command string, args []string, env []string) error {
 	}()
 
 	if err := cmd.Wait(); err != nil {
-		cmd.Process.Signal(os.Kill)
-		return fmt.Errorf("Failed to wait for command termination: %v", err)
+		// a command that ran and exited non-zero isn't an error, its exit status is passed on
+		if _, ok := err.(*exec.ExitError); !ok {
+			cmd.Process.Signal(os.Kill)
+			return 0, fmt.Errorf("Failed to wait for command termination: %v", err)
+		}
 	}
 
 	waitStatus := cmd.ProcessState.Sys().(syscall.WaitStatus)
-	os.Exit(waitStatus.ExitStatus())
-	return nil
+	return waitStatus.ExitStatus(), nil
 }
 
 func supportsExecSyscall() bool {
 	return runtime.GOOS == "linux" || runtime.GOOS == "darwin" || runtime.GOOS == "freebsd"
 }
 
-func execSyscall(command string, args []string, env []string) error {
+func execSyscall(path string, command string, args []string, env []string) error {
 	if !supportsExecSyscall() {
-		return execCmd(command, args, env)
-	}
-
-	argv0, err := exec.LookPath(command)
-	if err != nil {
-		return err
+		return execCmd(path, command, args, env)
 	}
 
 	argv := make([]string, 0, 1+len(args))
 	argv = append(argv, command)
 	argv = append(argv, args...)
 
-	return syscall.Exec(argv0, argv, env)
+	return syscall.Exec(path, argv, env)
 }
@@ -1,10 +1,21 @@
 package cli
 
 import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/99designs/aws-vault/server"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
 )
 
 func ExampleExecCommand() {
@@ -23,3 +34,213 @@ func ExampleExecCommand() {
 	// Output:
 	// ABC
 }
+
+func TestEnvironAllow(t *testing.T) {
+	env := environ{"PATH=/bin", "HOME=/home/llama", "TERM=xterm", "FOO=1", "BAR=2"}
+
+	allowed := env.Allow(allowedEnvKeys([]string{"FOO,-TERM"}))
+
+	expected := environ{"PATH=/bin", "HOME=/home/llama", "FOO=1"}
+	if !reflect.DeepEqual(allowed, expected) {
+		t.Fatalf("Expected %v, got %v", expected, allowed)
+	}
+}
+
+func ExampleExecCommand_fileBackendPassphraseIsntPassedOn() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	os.Setenv("AWS_VAULT_FILE_PASSPHRASE", "password")
+	defer os.Unsetenv("AWS_VAULT_FILE_PASSPHRASE")
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExecCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"exec", "--no-session", "llamas", "--", "sh", "-c", "echo passphrase=$AWS_VAULT_FILE_PASSPHRASE",
+	}))
+
+	// Output:
+	// passphrase=
+}
+
+func TestExecFederatedNeedsIAMUserCredentials(t *testing.T) {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString("[profile role]\nrole_arn = arn:aws:iam::123456789012:role/target\n[profile user]\n"); err != nil {
+		t.Fatal(err)
+	}
+	configFile, err := vault.LoadConfig(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader = &vault.ConfigLoader{File: configFile}
+
+	err = ExecCommand(ExecCommandInput{
+		ProfileName: "role",
+		Command:     "true",
+		Keyring:     keyring.NewArrayKeyring(nil),
+		Federated:   true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "assumes a role") {
+		t.Fatalf("Expected an error about the role, got %v", err)
+	}
+
+	err = ExecCommand(ExecCommandInput{
+		ProfileName: "user",
+		Command:     "true",
+		Keyring:     keyring.NewArrayKeyring(nil),
+		Federated:   true,
+	})
+	if err == nil || !strings.Contains(err.Error(), "--federated needs a policy") {
+		t.Fatalf("Expected an error about the missing policy, got %v", err)
+	}
+
+	err = ExecCommand(ExecCommandInput{ProfileName: "role", Command: "true", PolicyFile: "policy.json"})
+	if err == nil || !strings.Contains(err.Error(), "--policy can only be used with --federated") {
+		t.Fatalf("Expected an error about --policy, got %v", err)
+	}
+}
+
+func TestWriteEnvFile(t *testing.T) {
+	path, err := writeEnvFile(environ{"AWS_ACCESS_KEY_ID=ASIAEXAMPLE", "AWS_SESSION_EXPIRATION=2020-01-01T00:00:00Z"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(path)
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "AWS_ACCESS_KEY_ID=ASIAEXAMPLE\nAWS_SESSION_EXPIRATION=2020-01-01T00:00:00Z\n"; string(b) != expected {
+		t.Fatalf("Expected %q, got %q", expected, string(b))
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runtime.GOOS != "windows" && fi.Mode().Perm() != 0600 {
+		t.Fatalf("Expected the env file to only be readable by the user, got %v", fi.Mode().Perm())
+	}
+}
+
+func TestPrintEnvDiff(t *testing.T) {
+	before := environ{"AWS_PROFILE=work", "AWS_REGION=us-east-1", "HOME=/home/alice", "EDITOR=vi"}
+	after := environ{"AWS_VAULT=work", "AWS_REGION=eu-west-1", "HOME=/home/alice", "AWS_SECRET_ACCESS_KEY=secretsecret1234",
+		"AWS_ACCESS_KEY_ID=AKIAEXAMPLEWXYZ", "AWS_VAULT_FILE_PASSPHRASE=correct horse"}
+
+	var b bytes.Buffer
+	printEnvDiff(&b, before, after)
+
+	expected := `+ AWS_ACCESS_KEY_ID=****************WXYZ
+- AWS_PROFILE (was work)
+~ AWS_REGION=eu-west-1 (was us-east-1)
++ AWS_SECRET_ACCESS_KEY=(hidden)
++ AWS_VAULT=work
++ AWS_VAULT_FILE_PASSPHRASE=(hidden)
+1 other variables aren't passed on because of --env
+`
+	if b.String() != expected {
+		t.Fatalf("Expected:\n%s\ngot:\n%s", expected, b.String())
+	}
+}
+
+func TestPrintExpiry(t *testing.T) {
+	var b bytes.Buffer
+	printExpiry(&b, credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""))
+	if b.String() != "Credentials don't expire\n" {
+		t.Fatalf("Unexpected output %q", b.String())
+	}
+}
+
+func TestLookPathForProfileNotFound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	_, err = lookPathForProfile("aws-vault-missing-command", environ{"PATH=" + dir}, "llamas")
+	if err == nil {
+		t.Fatal("Expected an error for a missing command")
+	}
+	for _, s := range []string{`"aws-vault-missing-command"`, "profile llamas", "PATH"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Expected the error to contain %s, got %q", s, err)
+		}
+	}
+}
+
+func TestLookPathUsesTheCommandsPath(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "aws-vault-test-command")
+	if err = ioutil.WriteFile(script, []byte("#!/bin/sh\n"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the PATH the command is run with has the directory in it, not aws-vault's
+	path, err := lookPathForProfile("aws-vault-test-command", environ{"PATH=/nonexistent" + string(os.PathListSeparator) + dir}, "llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path != script {
+		t.Fatalf("Expected %s, got %s", script, path)
+	}
+}
+
+func TestSetEcsServerToken(t *testing.T) {
+	ecsServer, err := server.StartEcsCredentialsServer(credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ecsServer.Close()
+
+	env := environ{"AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE=/tmp/stale"}
+	setEcsServerToken(&env, ecsServer)
+	if m := env.Map(); m["AWS_CONTAINER_AUTHORIZATION_TOKEN"] != ecsServer.Token || m["AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"] != "" {
+		t.Fatalf("Expected only the token in the environment, got %v", env)
+	}
+
+	path, err := ecsServer.WriteTokenFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	env = environ{"AWS_CONTAINER_AUTHORIZATION_TOKEN=stale"}
+	setEcsServerToken(&env, ecsServer)
+	if m := env.Map(); m["AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE"] != path || m["AWS_CONTAINER_AUTHORIZATION_TOKEN"] != "" {
+		t.Fatalf("Expected only the token file in the environment, got %v", env)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != ecsServer.Token {
+		t.Fatalf("Expected the token file to contain the token, got %q", b)
+	}
+
+	ecsServer.Close()
+	if _, err = os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected the token file to be removed when the server is closed, got %v", err)
+	}
+}
+
+func TestEcsServerNeedsALoopbackAddress(t *testing.T) {
+	if _, err := server.StartEcsCredentialsServer(credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""), "0.0.0.0:0"); err == nil {
+		t.Fatal("Expected an error for an address that isn't loopback")
+	}
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// Exit codes for each class of failure, so scripts can tell them apart
+const (
+	ExitCodeError              = 1
+	ExitCodeMfa                = 2
+	ExitCodeCredentialsMissing = 3
+	ExitCodeConfig             = 4
+	ExitCodeAwsAPI             = 5
+	ExitCodeTimeout            = 6
+)
+
+// ExitCode returns the exit code for the class of failure that caused err
+func ExitCode(err error) int {
+	var mfaErr *vault.MfaError
+	var configErr *vault.ConfigError
+	var awsErr awserr.Error
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return ExitCodeTimeout
+	case errors.As(err, &mfaErr):
+		return ExitCodeMfa
+	case errors.Is(err, vault.ErrCredentialsMissing), errors.Is(err, vault.ErrNoCachedCredentials), errors.Is(err, keyring.ErrKeyNotFound):
+		return ExitCodeCredentialsMissing
+	case errors.As(err, &configErr):
+		return ExitCodeConfig
+	case errors.As(err, &awsErr):
+		// STS rejects an invalid MFA code with AccessDenied
+		if strings.Contains(awsErr.Message(), "MultiFactorAuthentication") {
+			return ExitCodeMfa
+		}
+		return ExitCodeAwsAPI
+	default:
+		return ExitCodeError
+	}
+}
+
+// actionError is an error from running a command, as opposed to one from parsing the command line
+type actionError struct {
+	prefix string
+	err    error
+}
+
+func (e *actionError) Error() string {
+	if e.prefix == "" {
+		return e.err.Error()
+	}
+	return e.prefix + ": " + e.err.Error()
+}
+
+func (e *actionError) Unwrap() error {
+	return e.err
+}
+
+// actionFailed prefixes err with what failed, so it's reported without kingpin's usage hint. It
+// returns nil if err is nil
+func actionFailed(err error, prefix string) error {
+	if err == nil {
+		return nil
+	}
+	return &actionError{prefix: prefix, err: err}
+}
+
+// ExitIfError reports err and exits with the code for the class of failure. Errors parsing the
+// command line are reported with a hint to use --help, like kingpin.MustParse
+func ExitIfError(app *kingpin.Application, err error, exit func(int)) {
+	if err == nil {
+		return
+	}
+	var actionErr *actionError
+	if errors.As(err, &actionErr) {
+		app.Errorf("%s", err)
+	} else {
+		app.Errorf("%s, try --help", err)
+	}
+	exit(ExitCode(err))
+}
@@ -0,0 +1,61 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func ExampleExitCode() {
+	fmt.Println(ExitCode(errors.New("something went wrong")))
+	fmt.Println(ExitCode(&vault.MfaError{Err: errors.New("EOF")}))
+	fmt.Println(ExitCode(fmt.Errorf("exec: %w", awserr.New("AccessDenied", "MultiFactorAuthentication failed with invalid MFA one time pass code.", nil))))
+	fmt.Println(ExitCode(fmt.Errorf("profile llamas: %w", vault.ErrCredentialsMissing)))
+	fmt.Println(ExitCode(&vault.ConfigError{Err: errors.New("Loop detected in config file for profile 'llamas'")}))
+	fmt.Println(ExitCode(awserr.New("ExpiredToken", "The security token included in the request is expired", nil)))
+	fmt.Println(ExitCode(fmt.Errorf("Timed out after 30s: %w", context.DeadlineExceeded)))
+
+	// Output:
+	// 1
+	// 2
+	// 2
+	// 3
+	// 4
+	// 5
+	// 6
+}
+
+func TestExitIfErrorUsesTheExitCodeForPreActionAndActionErrors(t *testing.T) {
+	configErr := &vault.ConfigError{Err: errors.New("Loop detected in config file for profile 'llamas'")}
+
+	for _, tc := range []struct {
+		args     []string
+		expected int
+	}{
+		{[]string{"preaction"}, ExitCodeConfig},
+		{[]string{"action"}, ExitCodeCredentialsMissing},
+		{[]string{"unknown"}, ExitCodeError},
+	} {
+		app := kingpin.New("aws-vault", "")
+		app.ErrorWriter(ioutil.Discard)
+		app.Command("preaction", "").PreAction(func(c *kingpin.ParseContext) error {
+			return actionFailed(configErr, "")
+		})
+		app.Command("action", "").Action(func(c *kingpin.ParseContext) error {
+			return actionFailed(vault.ErrCredentialsMissing, "action")
+		})
+
+		code := 0
+		_, err := app.Parse(tc.args)
+		ExitIfError(app, err, func(c int) { code = c })
+		if code != tc.expected {
+			t.Fatalf("Expected %v to exit with %d, got %d", tc.args, tc.expected, code)
+		}
+	}
+}
@@ -0,0 +1,365 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ExportCommandInput struct {
+	ProfileName           string
+	Format                string
+	UpdateCredentialsFile bool
+	CredentialsFile       string
+	Output                string
+	Force                 bool
+	Keyring               *vault.CredentialKeyring
+	Config                vault.Config
+	SessionDuration       time.Duration
+	SessionTTL            time.Duration
+	AssumeRoleTTL         time.Duration
+	NoSession             bool
+	Refresh               bool
+	Validate              bool
+	Watch                 bool
+	SessionName           string
+}
+
+func ConfigureExportCommand(app *kingpin.Application) {
+	input := ExportCommandInput{}
+
+	cmd := app.Command("export", "Prints temporary credentials for a profile")
+
+	cmd.Flag("duration", "Duration of the temporary or assume-role session. Defaults to 1h").
+		Short('d').
+		DurationVar(&input.SessionDuration)
+
+	cmd.Flag("session-ttl", "Duration of the GetSessionToken session, overriding --duration and the config").
+		DurationVar(&input.SessionTTL)
+
+	cmd.Flag("assume-role-ttl", "Duration of the assume-role session, overriding --duration and the config").
+		DurationVar(&input.AssumeRoleTTL)
+
+	cmd.Flag("no-session", "Don't create a session with GetSessionToken").
+		Short('n').
+		BoolVar(&input.NoSession)
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Flag("session-name", "RoleSessionName for the role assumed by the profile in this run, overriding role_session_name. The session isn't cached").
+		StringVar(&input.SessionName)
+
+	cmd.Flag("refresh", "Ignore cached credentials, creating and caching new ones").
+		BoolVar(&input.Refresh)
+
+	cmd.Flag("validate", "Check the stored credentials work with GetCallerIdentity before using them").
+		BoolVar(&input.Validate)
+
+	cmd.Flag("format", "Output format [env, json, powershell, cmd, ini]").
+		Default("env").
+		EnumVar(&input.Format, "env", "json", "powershell", "cmd", "ini")
+
+	cmd.Flag("update-credentials-file", "Write the credentials to the profile's section in the shared credentials file instead of printing them").
+		BoolVar(&input.UpdateCredentialsFile)
+
+	cmd.Flag("credentials-file", "Path of the shared credentials file, defaults to ~/.aws/credentials").
+		Envar("AWS_SHARED_CREDENTIALS_FILE").
+		StringVar(&input.CredentialsFile)
+
+	cmd.Flag("output", "Write the credentials to this file with 0600 permissions instead of printing them").
+		Short('o').
+		StringVar(&input.Output)
+
+	cmd.Flag("watch", "Keep running, printing the credentials as a line of JSON again each time they're refreshed before expiring. Requires --format=json").
+		BoolVar(&input.Watch)
+
+	cmd.Flag("force", "Overwrite the --output file even if it wasn't written by aws-vault").
+		BoolVar(&input.Force)
+
+	profileArg(cmd, &input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
+		input.Config.GetSessionTokenDuration = input.SessionDuration
+		input.Config.AssumeRoleDuration = input.SessionDuration
+		if input.SessionTTL != 0 {
+			input.Config.GetSessionTokenDuration = input.SessionTTL
+		}
+		if input.AssumeRoleTTL != 0 {
+			input.Config.AssumeRoleDuration = input.AssumeRoleTTL
+		}
+		return actionFailed(ExportCommand(input), "export")
+	})
+}
+
+func ExportCommand(input ExportCommandInput) error {
+	if input.Output != "" && input.UpdateCredentialsFile {
+		return fmt.Errorf("Can't use --output with --update-credentials-file")
+	}
+	if input.Watch && (input.Format != "json" || input.Output != "" || input.UpdateCredentialsFile) {
+		return fmt.Errorf("--watch can only be used with --format=json, printing to stdout")
+	}
+	if input.Watch && GlobalFlags.Pretty {
+		return fmt.Errorf("--watch can't be used with --pretty, as it prints a line of JSON each time")
+	}
+
+	vault.UseSession = !input.NoSession
+	vault.Refresh = input.Refresh
+	vault.ValidateStoredCredentials = input.Validate
+
+	configLoader.BaseConfig = input.Config
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+	if err = config.ValidateDurations(); err != nil {
+		return &vault.ConfigError{Err: err}
+	}
+	if err = overrideRoleSessionName(config, input.SessionName); err != nil {
+		return err
+	}
+
+	creds, err := vault.NewTempCredentialsWithContext(config, input.Keyring)
+	if err != nil {
+		return fmt.Errorf("Error getting temporary credentials: %w", err)
+	}
+
+	ctx, cancel := credentialsContext()
+	defer cancel()
+	val, err := getCredentials(ctx, creds)
+	if err != nil {
+		return fmt.Errorf("Failed to get credentials for %s: %w", input.ProfileName, err)
+	}
+
+	if input.Watch {
+		return watchCredentials(os.Stdout, creds.Credentials, val)
+	}
+
+	if input.UpdateCredentialsFile {
+		credentialsFile, err := loadCredentialsFile(input.CredentialsFile)
+		if err != nil {
+			return err
+		}
+		if err = credentialsFile.SetCredentials(input.ProfileName, val); err != nil {
+			return fmt.Errorf("Error writing credentials file: %w", err)
+		}
+		fmt.Printf("Wrote credentials for profile %q to %s\n", input.ProfileName, credentialsFile.Path)
+		return nil
+	}
+
+	// master credentials don't expire
+	expiration, err := creds.ExpiresAt()
+	if err != nil {
+		expiration = time.Time{}
+	}
+
+	if input.Output != "" {
+		var buf bytes.Buffer
+		if input.Format != "json" {
+			fmt.Fprintln(&buf, exportFileComment(input.Format))
+		}
+		if err = printCredentials(&buf, input.Format, input.ProfileName, val, expiration, config.Region); err != nil {
+			return err
+		}
+		if err = writeExportFile(input.Output, buf.Bytes(), input.Force); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "Wrote credentials for profile %q to %s\n", input.ProfileName, input.Output)
+		return nil
+	}
+
+	return printCredentials(os.Stdout, input.Format, input.ProfileName, val, expiration, config.Region)
+}
+
+func printCredentials(w io.Writer, format, profileName string, val credentials.Value, expiration time.Time, region string) error {
+	switch format {
+	case "json":
+		return printCredentialsJSON(w, val, expiration)
+	case "ini":
+		printCredentialsIni(w, profileName, val, expiration)
+	case "powershell":
+		printCredentialsPowershell(w, val, expiration, region)
+	case "cmd":
+		printCredentialsCmd(w, val, expiration, region)
+	default:
+		printCredentialsEnv(w, val, expiration, region)
+	}
+	return nil
+}
+
+// printCredentialsIni prints a section that can be pasted into a shared credentials file
+func printCredentialsIni(w io.Writer, profileName string, val credentials.Value, expiration time.Time) {
+	if !expiration.IsZero() {
+		fmt.Fprintf(w, "# expires %s\n", expiration.UTC().Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "[%s]\n", profileName)
+	fmt.Fprintf(w, "aws_access_key_id = %s\n", val.AccessKeyID)
+	fmt.Fprintf(w, "aws_secret_access_key = %s\n", val.SecretAccessKey)
+	if val.SessionToken != "" {
+		fmt.Fprintf(w, "aws_session_token = %s\n", val.SessionToken)
+	}
+}
+
+// exportFileMarker identifies files written by export --output, so they can be safely overwritten
+const exportFileMarker = "Written by aws-vault export"
+
+func exportFileComment(format string) string {
+	if format == "cmd" {
+		return "rem " + exportFileMarker
+	}
+	return "# " + exportFileMarker
+}
+
+// isExportFile returns true if b is empty or was written by export --output
+func isExportFile(b []byte) bool {
+	if len(bytes.TrimSpace(b)) == 0 {
+		return true
+	}
+
+	firstLine := string(bytes.SplitN(b, []byte("\n"), 2)[0])
+	if strings.Contains(firstLine, exportFileMarker) {
+		return true
+	}
+
+	// json output can't have a comment, so check it's the credential process format
+	var data AwsCredentialHelperData
+	return json.Unmarshal(b, &data) == nil && data.Version == 1 && data.AccessKeyID != ""
+}
+
+// writeExportFile atomically writes b to path with 0600 permissions, refusing to replace a file
+// that wasn't written by aws-vault unless force is set
+func writeExportFile(path string, b []byte, force bool) error {
+	existing, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil && !force && !isExportFile(existing) {
+		return fmt.Errorf("%s has content that wasn't written by aws-vault, use --force to overwrite it", path)
+	}
+
+	// ioutil.TempFile creates the file with 0600 permissions
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if _, err = f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
+
+// watchRetryInterval is how long --watch waits before refreshing again when a refresh doesn't
+// return credentials that expire later
+var watchRetryInterval = time.Minute
+
+// watchCredentials prints the credentials as a line of JSON, then again each time they are
+// refreshed just before expiring, so a consumer can keep its own cache up to date
+func watchCredentials(w io.Writer, creds *credentials.Credentials, val credentials.Value) error {
+	// refreshes should re-use the sessions cached by the first Get
+	vault.Refresh = false
+
+	var printed time.Time
+	for {
+		expiration, err := creds.ExpiresAt()
+		if err != nil || expiration.IsZero() {
+			return fmt.Errorf("--watch can't be used with credentials that don't expire")
+		}
+		if expiration.After(printed) {
+			if err = printCredentialsJSON(w, val, expiration); err != nil {
+				return err
+			}
+			printed = expiration
+			time.Sleep(time.Until(expiration))
+		} else {
+			// the refresh returned credentials that expire no later than the last ones, so wait
+			// rather than printing them again straight away
+			log.Printf("Refreshed credentials still expire at %s, retrying in %s", expiration.Format(time.RFC3339), watchRetryInterval)
+			time.Sleep(watchRetryInterval)
+		}
+		creds.Expire()
+		if val, err = creds.Get(); err != nil {
+			return fmt.Errorf("Failed to refresh credentials: %w", err)
+		}
+	}
+}
+
+func printCredentialsJSON(w io.Writer, val credentials.Value, expiration time.Time) error {
+	credentialData := AwsCredentialHelperData{
+		Version:         1,
+		AccessKeyID:     val.AccessKeyID,
+		SecretAccessKey: val.SecretAccessKey,
+		SessionToken:    val.SessionToken,
+	}
+	if !expiration.IsZero() {
+		credentialData.Expiration = expiration.UTC().Format(time.RFC3339)
+	}
+	b, err := marshalJSON(&credentialData)
+	if err != nil {
+		return fmt.Errorf("Error creating credential json: %w", err)
+	}
+	fmt.Fprintln(w, string(b))
+	return nil
+}
+
+// credentialsEnv returns the environment variables for the credentials, in the order they are printed
+func credentialsEnv(val credentials.Value, expiration time.Time, region string) [][2]string {
+	var env [][2]string
+	if region != "" {
+		env = append(env, [2]string{"AWS_REGION", region}, [2]string{"AWS_DEFAULT_REGION", region})
+	}
+	env = append(env,
+		[2]string{"AWS_ACCESS_KEY_ID", val.AccessKeyID},
+		[2]string{"AWS_SECRET_ACCESS_KEY", val.SecretAccessKey},
+	)
+	if val.SessionToken != "" {
+		env = append(env, [2]string{"AWS_SESSION_TOKEN", val.SessionToken}, [2]string{"AWS_SECURITY_TOKEN", val.SessionToken})
+	}
+	if !expiration.IsZero() {
+		env = append(env, [2]string{"AWS_SESSION_EXPIRATION", expiration.Format(time.RFC3339)})
+	}
+	return env
+}
+
+func printCredentialsEnv(w io.Writer, val credentials.Value, expiration time.Time, region string) {
+	for _, kv := range credentialsEnv(val, expiration, region) {
+		fmt.Fprintf(w, "%s=%s\n", kv[0], kv[1])
+	}
+}
+
+// powershellEscaper escapes the characters that are special inside a double-quoted PowerShell string
+var powershellEscaper = strings.NewReplacer("`", "``", `"`, "`\"", "$", "`$")
+
+func printCredentialsPowershell(w io.Writer, val credentials.Value, expiration time.Time, region string) {
+	for _, kv := range credentialsEnv(val, expiration, region) {
+		fmt.Fprintf(w, "$env:%s=\"%s\"\n", kv[0], powershellEscaper.Replace(kv[1]))
+	}
+}
+
+func printCredentialsCmd(w io.Writer, val credentials.Value, expiration time.Time, region string) {
+	for _, kv := range credentialsEnv(val, expiration, region) {
+		// quoting the whole assignment keeps characters like & and | in the value literal
+		fmt.Fprintf(w, "set \"%s=%s\"\n", kv[0], kv[1])
+	}
+}
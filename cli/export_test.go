@@ -0,0 +1,166 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func ExampleExportCommand() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "--format=json", "llamas",
+	}))
+
+	// Output:
+	// {"Version":1,"AccessKeyId":"ABC","SecretAccessKey":"XYZ","SessionToken":""}
+}
+
+func ExampleExportCommand_pretty() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	defer func() { GlobalFlags.Pretty = false }()
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"--pretty", "export", "--no-session", "--format=json", "llamas",
+	}))
+
+	// Output:
+	// {
+	//   "Version": 1,
+	//   "AccessKeyId": "ABC",
+	//   "SecretAccessKey": "XYZ",
+	//   "SessionToken": ""
+	// }
+}
+
+func ExampleExportCommand_powershell() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"X\"Y$Z"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "--format=powershell", "llamas",
+	}))
+
+	// Output:
+	// $env:AWS_ACCESS_KEY_ID="ABC"
+	// $env:AWS_SECRET_ACCESS_KEY="X`"Y`$Z"
+}
+
+func ExampleExportCommand_ini() {
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ","SessionToken":"TOKEN"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "--format=ini", "llamas",
+	}))
+
+	// Output:
+	// [llamas]
+	// aws_access_key_id = ABC
+	// aws_secret_access_key = XYZ
+	// aws_session_token = TOKEN
+}
+
+func ExampleExportCommand_output() {
+	dir, err := ioutil.TempDir("", "aws-vault-example")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(dir)
+	output := filepath.Join(dir, ".env")
+
+	awsConfigFile = &vault.ConfigFile{}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureExportCommand(app)
+	kingpin.MustParse(app.Parse([]string{
+		"export", "--no-session", "--output", output, "llamas",
+	}))
+
+	b, _ := ioutil.ReadFile(output)
+	fmt.Print(string(b))
+
+	fi, _ := os.Stat(output)
+	fmt.Println(fi.Mode())
+
+	// Output:
+	// # Written by aws-vault export
+	// AWS_ACCESS_KEY_ID=ABC
+	// AWS_SECRET_ACCESS_KEY=XYZ
+	// -rw-------
+}
+
+// sameExpiryProvider returns credentials with the same expiration each time, failing after a few retrieves
+type sameExpiryProvider struct {
+	credentials.Expiry
+	expiration time.Time
+	retrieves  int
+}
+
+func (p *sameExpiryProvider) Retrieve() (credentials.Value, error) {
+	p.retrieves++
+	if p.retrieves > 3 {
+		return credentials.Value{}, errors.New("done")
+	}
+	p.SetExpiration(p.expiration, 0)
+	return credentials.Value{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}, nil
+}
+
+func TestWatchCredentialsDoesntRepeatCredentialsThatDontExpireLater(t *testing.T) {
+	defer func(d time.Duration) { watchRetryInterval = d }(watchRetryInterval)
+	watchRetryInterval = time.Millisecond
+
+	creds := credentials.NewCredentials(&sameExpiryProvider{expiration: time.Now().Add(10 * time.Millisecond)})
+	val, err := creds.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = watchCredentials(&buf, creds, val)
+	if err == nil || !strings.Contains(err.Error(), "done") {
+		t.Fatalf("Expected the provider's error, got %v", err)
+	}
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 {
+		t.Fatalf("Expected the credentials to be printed once, got %d lines:\n%s", lines, buf.String())
+	}
+}
@@ -1,14 +1,21 @@
 package cli
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/99designs/aws-vault/prompt"
 	"github.com/99designs/aws-vault/vault"
 	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mitchellh/go-homedir"
 	"golang.org/x/crypto/ssh/terminal"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -18,20 +25,33 @@ const (
 )
 
 var (
-	keyringImpl      keyring.Keyring
-	awsConfigFile    *vault.ConfigFile
-	configLoader     *vault.ConfigLoader
-	promptsAvailable = prompt.Available()
+	keyringImpl              keyring.Keyring
+	awsConfigFile            *vault.ConfigFile
+	configLoader             *vault.ConfigLoader
+	promptsAvailable         = prompt.Available()
+	passwordPromptsAvailable = prompt.AvailablePassword()
 )
 
 var GlobalFlags struct {
 	Debug        bool
+	Trace        bool
 	Backend      string
 	PromptDriver string
 	KeychainName string
+	KeyringDir   string
 	PassDir      string
 	PassCmd      string
 	PassPrefix   string
+	VaultAddr    string
+	VaultMount   string
+	VaultPrefix  string
+
+	FilePassphraseFile string
+	PassphrasePrompt   string
+
+	Timeout time.Duration
+
+	Pretty bool
 }
 
 func ConfigureGlobals(app *kingpin.Application) {
@@ -39,24 +59,52 @@ func ConfigureGlobals(app *kingpin.Application) {
 	for _, backendType := range keyring.AvailableBackends() {
 		backendsAvailable = append(backendsAvailable, string(backendType))
 	}
+	backendsAvailable = append(backendsAvailable, vault.HashiCorpVaultBackend)
 
 	app.Flag("debug", "Show debugging output").
 		BoolVar(&GlobalFlags.Debug)
 
-	app.Flag("backend", fmt.Sprintf("Secret backend to use %v", backendsAvailable)).
-		Envar("AWS_VAULT_BACKEND").
-		EnumVar(&GlobalFlags.Backend, backendsAvailable...)
+	app.Flag("trace", "Show how long each step of resolving credentials takes").
+		BoolVar(&GlobalFlags.Trace)
 
-	app.Flag("prompt", fmt.Sprintf("Prompt driver to use %v", promptsAvailable)).
-		Default("terminal").
-		Envar("AWS_VAULT_PROMPT").
+	app.Flag("timeout", "Give up resolving credentials after this long, including waiting for an MFA token. Commands run with the credentials aren't limited").
+		Envar("AWS_VAULT_TIMEOUT").
+		DurationVar(&GlobalFlags.Timeout)
+
+	app.Flag("pretty", "Indent JSON output, such as from export --format=json or whoami --format=json").
+		Envar("AWS_VAULT_PRETTY").
+		BoolVar(&GlobalFlags.Pretty)
+
+	backend := app.Flag("backend", fmt.Sprintf("Secret backend to use %v. A comma separated list reads from each in turn until one has the item, and writes to the first", backendsAvailable)).
+		Envar("AWS_VAULT_BACKEND")
+	if projectBackend := currentProjectFile().Backend; projectBackend != "" {
+		backend.Default(projectBackend)
+	}
+	backend.StringVar(&GlobalFlags.Backend)
+
+	// AWS_VAULT_PROMPT is applied in vault.Mfa so that it doesn't override a profile's mfa_prompt
+	app.Flag("prompt", fmt.Sprintf("Prompt driver to use %v, defaults to the profile's mfa_prompt, $AWS_VAULT_PROMPT or terminal", promptsAvailable)).
 		EnumVar(&GlobalFlags.PromptDriver, promptsAvailable...)
 
+	app.Flag("passphrase-prompt", fmt.Sprintf("Prompt driver to use for keyring passphrases %v, separately from --prompt for MFA tokens", passwordPromptsAvailable)).
+		Default("terminal").
+		Envar("AWS_VAULT_PASSPHRASE_PROMPT").
+		EnumVar(&GlobalFlags.PassphrasePrompt, passwordPromptsAvailable...)
+
 	app.Flag("keychain", "Name of macOS keychain to use, if it doesn't exist it will be created").
 		Default("aws-vault").
 		Envar("AWS_VAULT_KEYCHAIN_NAME").
 		StringVar(&GlobalFlags.KeychainName)
 
+	app.Flag("keyring-dir", "Directory for the file backend, including cached sessions").
+		Default("~/.awsvault/keys/").
+		Envar("AWS_VAULT_KEYRING_DIR").
+		StringVar(&GlobalFlags.KeyringDir)
+
+	app.Flag("file-passphrase-file", "File containing the passphrase for the file backend, instead of prompting for it").
+		Envar("AWS_VAULT_FILE_PASSPHRASE_FILE").
+		StringVar(&GlobalFlags.FilePassphraseFile)
+
 	app.Flag("pass-dir", "Pass password store directory").
 		Envar("AWS_VAULT_PASS_PASSWORD_STORE_DIR").
 		StringVar(&GlobalFlags.PassDir)
@@ -69,54 +117,268 @@ func ConfigureGlobals(app *kingpin.Application) {
 		Envar("AWS_VAULT_PASS_PREFIX").
 		StringVar(&GlobalFlags.PassPrefix)
 
+	app.Flag("vault-addr", "Address of the HashiCorp Vault server for the vault backend").
+		Envar("VAULT_ADDR").
+		StringVar(&GlobalFlags.VaultAddr)
+
+	app.Flag("vault-mount", "Mount of the KV version 2 secrets engine for the vault backend").
+		Default("secret").
+		Envar("AWS_VAULT_HASHICORP_MOUNT").
+		StringVar(&GlobalFlags.VaultMount)
+
+	app.Flag("vault-prefix", "Path in the secrets engine that the vault backend stores items under").
+		Default("aws-vault").
+		Envar("AWS_VAULT_HASHICORP_PREFIX").
+		StringVar(&GlobalFlags.VaultPrefix)
+
 	app.PreAction(func(c *kingpin.ParseContext) (err error) {
 		if !GlobalFlags.Debug {
 			log.SetOutput(ioutil.Discard)
 		} else {
 			keyring.Debug = true
 		}
+		if GlobalFlags.Trace {
+			vault.Trace = os.Stderr
+		}
+		// the backends command probes each backend itself, so it works when the default one can't be opened
+		if c.SelectedCommand != nil && c.SelectedCommand.FullCommand() == "backends" {
+			return nil
+		}
 		if keyringImpl == nil {
-			var allowedBackends []keyring.BackendType
-			if GlobalFlags.Backend != "" {
-				allowedBackends = append(allowedBackends, keyring.BackendType(GlobalFlags.Backend))
-			}
-			keyringImpl, err = keyring.Open(keyring.Config{
-				ServiceName:              "aws-vault",
-				AllowedBackends:          allowedBackends,
-				KeychainName:             GlobalFlags.KeychainName,
-				FileDir:                  "~/.awsvault/keys/",
-				FilePasswordFunc:         fileKeyringPassphrasePrompt,
-				PassDir:                  GlobalFlags.PassDir,
-				PassCmd:                  GlobalFlags.PassCmd,
-				PassPrefix:               GlobalFlags.PassPrefix,
-				LibSecretCollectionName:  "awsvault",
-				KWalletAppID:             "aws-vault",
-				KWalletFolder:            "aws-vault",
-				KeychainTrustApplication: true,
-				WinCredPrefix:            "aws-vault",
-			})
-			if err != nil {
-				return err
+			if keyringImpl, err = openKeyrings(backendOrder(), backendsAvailable); err != nil {
+				return actionFailed(err, "")
 			}
 		}
 		if awsConfigFile == nil {
 			awsConfigFile, err = vault.LoadConfigFromEnv()
 		}
 		configLoader = &vault.ConfigLoader{File: awsConfigFile}
-		return err
+		// the SSO account and role can only be chosen interactively
+		if terminal.IsTerminal(int(os.Stdin.Fd())) {
+			vault.DefaultSSOPicker = terminalSSOPicker{}
+		}
+		return actionFailed(err, "")
 	})
 }
 
+// backendOrder returns the backends listed in --backend, in the order they are read from. An empty
+// name means the first backend that's available
+func backendOrder() []string {
+	var backends []string
+	for _, backend := range strings.Split(GlobalFlags.Backend, ",") {
+		backends = append(backends, strings.TrimSpace(backend))
+	}
+	return backends
+}
+
+// openKeyrings opens the backends, reading from each in turn when there are several. Backends that
+// can't be opened are skipped, as long as one of them can be
+func openKeyrings(backends []string, backendsAvailable []string) (keyring.Keyring, error) {
+	var keyrings []keyring.Keyring
+	var firstErr error
+	for _, backend := range backends {
+		kr, err := openKeyring(backend, backendsAvailable)
+		if err != nil {
+			if len(backends) == 1 {
+				return nil, err
+			}
+			log.Printf("Skipping backend %q, it can't be opened: %v", backend, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		keyrings = append(keyrings, kr)
+	}
+
+	switch len(keyrings) {
+	case 0:
+		return nil, firstErr
+	case 1:
+		return keyrings[0], nil
+	default:
+		return vault.FallbackKeyring{Keyring: keyrings[0], Fallbacks: keyrings[1:]}, nil
+	}
+}
+
+// openKeyring opens the named backend, or the first available one if backend is empty
+func openKeyring(backend string, backendsAvailable []string) (keyring.Keyring, error) {
+	if backend == vault.HashiCorpVaultBackend {
+		kr, err := hashiCorpVaultKeyring()
+		if err != nil {
+			return nil, err
+		}
+		return vault.LockAwareKeyring{Keyring: kr}, nil
+	}
+
+	if backend == "" {
+		// the first backend that can be opened, as keyring.Open would, but knowing which one it is
+		for _, backendType := range keyring.AvailableBackends() {
+			kr, err := openKeyringBackend(backendType)
+			if err == nil {
+				return kr, nil
+			}
+			log.Printf("Skipping backend %q, it can't be opened: %v", backendType, err)
+		}
+		return nil, keyring.ErrNoAvailImpl
+	}
+
+	if !isStringInSlice(backend, backendsAvailable) {
+		return nil, fmt.Errorf("Backend %q isn't available, supported backends are: %s",
+			backend, strings.Join(backendsAvailable, ", "))
+	}
+	return openKeyringBackend(keyring.BackendType(backend))
+}
+
+// openKeyringBackend opens a keyring backend, wrapped for what the backend lacks
+func openKeyringBackend(backendType keyring.BackendType) (keyring.Keyring, error) {
+	kr, err := keyring.Open(keyringConfig([]keyring.BackendType{backendType}))
+	if err != nil {
+		return nil, err
+	}
+	switch backendType {
+	case keyring.FileBackend:
+		// the file backend has no locking of its own, so concurrent invocations are serialized
+		// with a lock file alongside the keyring dir. It can't live inside it as every file
+		// there is listed as a key
+		dir, err := homedir.Expand(GlobalFlags.KeyringDir)
+		if err != nil {
+			return nil, err
+		}
+		kr = vault.ExclusiveKeyring{Keyring: kr, LockPath: filepath.Clean(dir) + ".lock"}
+	case keyring.WinCredBackend:
+		// Windows Credential Manager limits the size of each item, which chained session tokens can exceed
+		kr = vault.ChunkedKeyring{Keyring: kr, MaxSize: vault.MaxWinCredBlobSize}
+	}
+	return vault.LockAwareKeyring{Keyring: kr}, nil
+}
+
+// credentialsContext returns the context credentials are resolved with, which is done after --timeout
+func credentialsContext() (context.Context, context.CancelFunc) {
+	if GlobalFlags.Timeout == 0 {
+		return context.WithCancel(context.Background())
+	}
+	return context.WithTimeout(context.Background(), GlobalFlags.Timeout)
+}
+
+// getCredentials resolves creds, giving up when ctx is done
+func getCredentials(ctx context.Context, creds *vault.ContextCredentials) (credentials.Value, error) {
+	val, err := creds.GetWithContext(ctx)
+	if err != nil {
+		return credentials.Value{}, timeoutError(ctx, err)
+	}
+	return val, nil
+}
+
+// timeoutError explains err if it's from giving up after --timeout
+func timeoutError(ctx context.Context, err error) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("Timed out after %s: %w", GlobalFlags.Timeout, ctx.Err())
+	}
+	return err
+}
+
+// profileSessions returns the sessions in k of the session owner of the profile, so other owners'
+// sessions are left alone
+func profileSessions(k *vault.CredentialKeyring, profileName string) *vault.KeyringSessions {
+	sessions := k.Sessions()
+	if configLoader != nil {
+		if config, err := configLoader.LoadFromProfile(profileName); err == nil {
+			sessions.Owner = config.SessionOwner()
+		}
+	}
+	return sessions
+}
+
+// marshalJSON marshals v for output, indented with --pretty
+func marshalJSON(v interface{}) ([]byte, error) {
+	if GlobalFlags.Pretty {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// keyringConfig returns the config for opening the first of allowedBackends that works, or any backend if it's empty
+func keyringConfig(allowedBackends []keyring.BackendType) keyring.Config {
+	return keyring.Config{
+		ServiceName:              "aws-vault",
+		AllowedBackends:          allowedBackends,
+		KeychainName:             GlobalFlags.KeychainName,
+		FileDir:                  GlobalFlags.KeyringDir,
+		FilePasswordFunc:         fileKeyringPassphrasePrompt,
+		KeychainPasswordFunc:     passphrasePrompt,
+		PassDir:                  GlobalFlags.PassDir,
+		PassCmd:                  GlobalFlags.PassCmd,
+		PassPrefix:               GlobalFlags.PassPrefix,
+		LibSecretCollectionName:  "awsvault",
+		KWalletAppID:             "aws-vault",
+		KWalletFolder:            "aws-vault",
+		KeychainTrustApplication: true,
+		WinCredPrefix:            "aws-vault",
+	}
+}
+
+func isStringInSlice(s string, slice []string) bool {
+	for _, v := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// hashiCorpVaultKeyring returns the keyring for the vault backend. It authenticates with
+// VAULT_TOKEN, the token saved by the vault CLI, or VAULT_ROLE_ID and VAULT_SECRET_ID for AppRole
+func hashiCorpVaultKeyring() (*vault.HashiCorpVaultKeyring, error) {
+	if GlobalFlags.VaultAddr == "" {
+		return nil, fmt.Errorf("The vault backend needs the server address, set --vault-addr or VAULT_ADDR")
+	}
+
+	k := &vault.HashiCorpVaultKeyring{
+		Address:  GlobalFlags.VaultAddr,
+		Mount:    GlobalFlags.VaultMount,
+		Prefix:   GlobalFlags.VaultPrefix,
+		Token:    os.Getenv("VAULT_TOKEN"),
+		RoleID:   os.Getenv("VAULT_ROLE_ID"),
+		SecretID: os.Getenv("VAULT_SECRET_ID"),
+	}
+	if k.Token == "" && k.RoleID == "" {
+		if path, err := homedir.Expand("~/.vault-token"); err == nil {
+			if b, err := ioutil.ReadFile(path); err == nil {
+				k.Token = strings.TrimSpace(string(b))
+			}
+		}
+	}
+
+	return k, nil
+}
+
 func fileKeyringPassphrasePrompt(prompt string) (string, error) {
 	if password := os.Getenv("AWS_VAULT_FILE_PASSPHRASE"); password != "" {
 		return password, nil
 	}
 
-	fmt.Fprintf(os.Stderr, "%s: ", prompt)
-	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
-	if err != nil {
-		return "", err
+	if GlobalFlags.FilePassphraseFile != "" {
+		path, err := homedir.Expand(GlobalFlags.FilePassphraseFile)
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("Failed to read the file backend passphrase: %w", err)
+		}
+		log.Printf("Using the file backend passphrase from %s", path)
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+
+	return passphrasePrompt(prompt)
+}
+
+// passphrasePrompt asks for a keyring passphrase with the --passphrase-prompt driver
+func passphrasePrompt(text string) (string, error) {
+	method, ok := prompt.PasswordMethods[GlobalFlags.PassphrasePrompt]
+	if !ok {
+		method = prompt.TerminalPasswordPrompt
 	}
-	fmt.Println()
-	return string(b), nil
+	return method(text + ": ")
 }
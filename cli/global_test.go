@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestFileKeyringPassphraseFromFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "aws-vault-passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err = f.WriteString("correct horse\n"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	defer func(path string) { GlobalFlags.FilePassphraseFile = path }(GlobalFlags.FilePassphraseFile)
+	GlobalFlags.FilePassphraseFile = f.Name()
+
+	passphrase, err := fileKeyringPassphrasePrompt("Enter passphrase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if passphrase != "correct horse" {
+		t.Fatalf("Expected the passphrase from the file, got %q", passphrase)
+	}
+}
+
+// blockingProvider never returns credentials, like an MFA prompt nobody answers, until it's cancelled
+type blockingProvider struct {
+	cancelled chan struct{}
+}
+
+func (p blockingProvider) Retrieve() (credentials.Value, error) {
+	select {}
+}
+
+func (p blockingProvider) RetrieveWithContext(ctx context.Context) (credentials.Value, error) {
+	<-ctx.Done()
+	close(p.cancelled)
+	return credentials.Value{}, ctx.Err()
+}
+
+func (blockingProvider) IsExpired() bool {
+	return true
+}
+
+func TestGetCredentialsTimesOut(t *testing.T) {
+	defer func(timeout time.Duration) { GlobalFlags.Timeout = timeout }(GlobalFlags.Timeout)
+	GlobalFlags.Timeout = 10 * time.Millisecond
+
+	p := blockingProvider{cancelled: make(chan struct{})}
+	ctx, cancel := credentialsContext()
+	defer cancel()
+
+	_, err := getCredentials(ctx, vault.NewContextCredentials(p))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	select {
+	case <-p.cancelled:
+	default:
+		t.Fatal("Expected the provider to be cancelled rather than left running")
+	}
+}
+
+func TestOpenKeyringsSkipsBackendsThatCantBeOpened(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string) { GlobalFlags.KeyringDir = dir }(GlobalFlags.KeyringDir)
+	GlobalFlags.KeyringDir = dir
+
+	kr, err := openKeyrings([]string{"missing", "file"}, []string{"file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := kr.(vault.FallbackKeyring); ok {
+		t.Fatalf("Expected only the file backend, got %T", kr)
+	}
+
+	if _, err = openKeyrings([]string{"missing", "also-missing"}, []string{"file"}); err == nil {
+		t.Fatal("Expected an error when none of the backends can be opened")
+	}
+}
+
+func TestOpenKeyringLocksTheFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	defer func(dir string) { GlobalFlags.KeyringDir = dir }(GlobalFlags.KeyringDir)
+	GlobalFlags.KeyringDir = dir
+
+	kr, err := openKeyring("file", []string{"file"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockAware, ok := kr.(vault.LockAwareKeyring)
+	if !ok {
+		t.Fatalf("Expected a vault.LockAwareKeyring, got %T", kr)
+	}
+	if exclusive, ok := lockAware.Keyring.(vault.ExclusiveKeyring); !ok || exclusive.LockPath != filepath.Clean(dir)+".lock" {
+		t.Fatalf("Expected the file backend to be locked with %s.lock, got %#v", filepath.Clean(dir), lockAware.Keyring)
+	}
+}
@@ -0,0 +1,74 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type ImportCommandInput struct {
+	ProfileNames    []string
+	CredentialsFile string
+	Keyring         *vault.CredentialKeyring
+}
+
+func ConfigureImportCommand(app *kingpin.Application) {
+	input := ImportCommandInput{}
+
+	cmd := app.Command("import", "Imports credentials from the AWS shared credentials file")
+
+	cmd.Flag("credentials-file", "Path of the shared credentials file, defaults to ~/.aws/credentials").
+		Envar("AWS_SHARED_CREDENTIALS_FILE").
+		StringVar(&input.CredentialsFile)
+
+	cmd.Arg("profiles", "Names of the profiles to import, defaults to all").
+		StringsVar(&input.ProfileNames)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(ImportCommand(input), "import")
+	})
+}
+
+func ImportCommand(input ImportCommandInput) error {
+	credentialsFile, err := loadCredentialsFile(input.CredentialsFile)
+	if err != nil {
+		return err
+	}
+
+	profileNames := input.ProfileNames
+	if len(profileNames) == 0 {
+		profileNames = credentialsFile.ProfileNames()
+	}
+
+	for _, profileName := range profileNames {
+		val, ok := credentialsFile.Credentials(profileName)
+		if !ok {
+			fmt.Printf("Skipping profile %q, it has no credentials in %s\n", profileName, credentialsFile.Path)
+			continue
+		}
+
+		if err = input.Keyring.Set(profileName, val); err != nil {
+			return err
+		}
+		fmt.Printf("Imported credentials for profile %q\n", profileName)
+
+		if n, _ := profileSessions(input.Keyring, profileName).Delete(profileName); n > 0 {
+			fmt.Printf("Deleted %d existing sessions.\n", n)
+		}
+	}
+
+	return nil
+}
+
+// loadCredentialsFile loads the credentials file at path, or the default location if path is empty
+func loadCredentialsFile(path string) (*vault.CredentialsFile, error) {
+	if path == "" {
+		var err error
+		if path, err = vault.CredentialsFilePath(); err != nil {
+			return nil, err
+		}
+	}
+	return vault.LoadCredentialsFile(path)
+}
@@ -7,11 +7,13 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
 	"strings"
 	"time"
 
 	"github.com/99designs/aws-vault/vault"
-	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/skratchdot/open-golang/open"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
@@ -20,7 +22,11 @@ type LoginCommandInput struct {
 	ProfileName     string
 	Keyring         *vault.CredentialKeyring
 	UseStdout       bool
+	NoOpen          bool
+	Browser         string
+	QRCode          bool
 	Path            string
+	Issuer          string
 	Config          vault.Config
 	SessionDuration time.Duration
 }
@@ -41,14 +47,31 @@ func ConfigureLoginCommand(app *kingpin.Application) {
 	cmd.Flag("path", "The AWS service you would like access").
 		StringVar(&input.Path)
 
+	cmd.Flag("console-region", "Region to open the console in, overriding console_region. Credentials are still obtained in the profile's region").
+		PlaceHolder("REGION").
+		StringVar(&input.Config.ConsoleRegion)
+
+	cmd.Flag("issuer", "URL the console's sign out and session expiry links go back to, such as an internal portal").
+		Default("aws-vault").
+		Envar("AWS_VAULT_LOGIN_ISSUER").
+		StringVar(&input.Issuer)
+
 	cmd.Flag("stdout", "Print login URL to stdout instead of opening in default browser").
 		Short('s').
 		BoolVar(&input.UseStdout)
 
-	cmd.Arg("profile", "Name of the profile").
-		Required().
-		HintAction(awsConfigFile.ProfileNames).
-		StringVar(&input.ProfileName)
+	cmd.Flag("no-open", "Don't open the login URL in a browser, just print it").
+		Envar("AWS_VAULT_NO_OPEN").
+		BoolVar(&input.NoOpen)
+
+	cmd.Flag("browser", "Command used to open the login URL, e.g. 'firefox -P work'. Defaults to the OS default browser").
+		Envar("AWS_VAULT_BROWSER").
+		StringVar(&input.Browser)
+
+	cmd.Flag("qr", "Print the login URL as a QR code to scan with a phone, using qrencode").
+		BoolVar(&input.QRCode)
+
+	profileArg(cmd, &input.ProfileName)
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
@@ -57,8 +80,7 @@ func ConfigureLoginCommand(app *kingpin.Application) {
 		input.Config.GetFederationTokenDuration = input.SessionDuration
 		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
 		err := LoginCommand(input)
-		app.FatalIfError(err, "Login failed")
-		return nil
+		return actionFailed(err, "Login failed")
 	})
 }
 
@@ -70,19 +92,21 @@ func LoginCommand(input LoginCommandInput) error {
 		return err
 	}
 
-	var creds *credentials.Credentials
+	var creds *vault.ContextCredentials
 
 	// if AssumeRole isn't used, GetFederationToken has to be used for IAM credentials
 	if config.RoleARN == "" {
-		creds, err = vault.NewFederationTokenCredentials(input.ProfileName, input.Keyring, config)
+		creds, err = vault.NewFederationTokenCredentialsWithContext(input.ProfileName, input.Keyring, config)
 	} else {
-		creds, err = vault.NewTempCredentials(config, input.Keyring)
+		creds, err = vault.NewTempCredentialsWithContext(config, input.Keyring)
 	}
 	if err != nil {
 		return err
 	}
 
-	val, err := creds.Get()
+	ctx, cancel := credentialsContext()
+	defer cancel()
+	val, err := getCredentials(ctx, creds)
 	if err != nil {
 		return fmt.Errorf("Failed to get credentials for %s: %w", config.ProfileName, err)
 	}
@@ -96,7 +120,14 @@ func LoginCommand(input LoginCommandInput) error {
 		return err
 	}
 
-	loginURLPrefix, destination := generateLoginURL(config.Region, input.Path)
+	// the federation token comes from STS in the profile's region, but the console can open in another
+	consoleRegion := config.Region
+	if config.ConsoleRegion != "" {
+		log.Printf("Opening the console in %s rather than %s", config.ConsoleRegion, config.Region)
+		consoleRegion = config.ConsoleRegion
+	}
+
+	loginURLPrefix, destination := generateLoginURL(consoleRegion, input.Path)
 
 	req, err := http.NewRequest("GET", loginURLPrefix, nil)
 	if err != nil {
@@ -140,12 +171,17 @@ func LoginCommand(input LoginCommandInput) error {
 		return fmt.Errorf("Expected a response with SigninToken")
 	}
 
-	loginURL := fmt.Sprintf("%s?Action=login&Issuer=aws-vault&Destination=%s&SigninToken=%s",
-		loginURLPrefix, url.QueryEscape(destination), url.QueryEscape(signinToken))
+	loginURL := fmt.Sprintf("%s?Action=login&Issuer=%s&Destination=%s&SigninToken=%s",
+		loginURLPrefix, url.QueryEscape(input.Issuer), url.QueryEscape(destination), url.QueryEscape(signinToken))
 
-	if input.UseStdout {
+	if input.QRCode {
+		return printQRCode(loginURL)
+	} else if input.UseStdout || input.NoOpen {
+		fmt.Println(loginURL)
+	} else if isHeadless() {
+		fmt.Fprintln(os.Stderr, "No browser available in this session (use --no-open to hide this hint), open this URL to login:")
 		fmt.Println(loginURL)
-	} else if err = open.Run(loginURL); err != nil {
+	} else if err = openURL(loginURL, input.Browser); err != nil {
 		log.Println(err)
 		fmt.Println(loginURL)
 	}
@@ -153,6 +189,41 @@ func LoginCommand(input LoginCommandInput) error {
 	return nil
 }
 
+// openURL opens the URL with the browser command, or the OS default browser if the command is empty
+func openURL(url string, browser string) error {
+	args := strings.Fields(browser)
+	if len(args) == 0 {
+		return open.Run(url)
+	}
+
+	log.Printf("Opening login URL with %s", args[0])
+	return exec.Command(args[0], append(args[1:], url)...).Start()
+}
+
+// printQRCode renders the URL as a QR code in the terminal using the qrencode command
+func printQRCode(url string) error {
+	qrencode, err := exec.LookPath("qrencode")
+	if err != nil {
+		return fmt.Errorf("--qr requires qrencode, install it from https://fukuchi.org/works/qrencode/ or your package manager")
+	}
+
+	cmd := exec.Command(qrencode, "-t", "UTF8", "-o", "-", url)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// isHeadless returns whether there's likely no browser that can be opened, e.g. in an SSH session
+func isHeadless() bool {
+	if os.Getenv("SSH_CONNECTION") != "" || os.Getenv("SSH_TTY") != "" {
+		return true
+	}
+	if runtime.GOOS == "darwin" || runtime.GOOS == "windows" {
+		return false
+	}
+	return os.Getenv("DISPLAY") == "" && os.Getenv("WAYLAND_DISPLAY") == ""
+}
+
 func generateLoginURL(region string, path string) (string, string) {
 	loginURLPrefix := "https://signin.aws.amazon.com/federation"
 	destination := "https://console.aws.amazon.com/"
@@ -15,6 +15,8 @@ type LsCommandInput struct {
 	OnlyProfiles    bool
 	OnlySessions    bool
 	OnlyCredentials bool
+	OnlyExpired     bool
+	OnlyValid       bool
 }
 
 func ConfigureListCommand(app *kingpin.Application) {
@@ -32,14 +34,23 @@ func ConfigureListCommand(app *kingpin.Application) {
 	cmd.Flag("credentials", "Show only the profiles with stored credential").
 		BoolVar(&input.OnlyCredentials)
 
+	cmd.Flag("expired", "Show only sessions that have expired, rather than removing them").
+		BoolVar(&input.OnlyExpired)
+
+	cmd.Flag("valid", "Show only sessions that haven't expired").
+		BoolVar(&input.OnlyValid)
+
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
-		app.FatalIfError(LsCommand(input), "")
-		return nil
+		return actionFailed(LsCommand(input), "")
 	})
 }
 
 func LsCommand(input LsCommandInput) error {
+	if input.OnlyExpired && input.OnlyValid {
+		return fmt.Errorf("--expired can't be used with --valid")
+	}
+
 	krs := input.Keyring.Sessions()
 
 	credentialsNames, err := input.Keyring.CredentialsKeys()
@@ -47,15 +58,30 @@ func LsCommand(input LsCommandInput) error {
 		return err
 	}
 
-	sessions, err := krs.Sessions()
-	if err != nil {
+	var sessions []vault.KeyringSession
+	if input.OnlyExpired || input.OnlyValid {
+		// listing sessions removes expired ones, so they're filtered from all of them instead
+		allSessions, err := krs.AllSessions()
+		if err != nil {
+			return err
+		}
+		for _, sess := range allSessions {
+			if sess.IsExpired() == input.OnlyExpired {
+				sessions = append(sessions, sess)
+			}
+		}
+	} else if sessions, err = krs.Sessions(); err != nil {
 		return err
 	}
 
 	var sessionNames []string
 	for _, sess := range sessions {
 		label := fmt.Sprintf("%d", sess.Expiration.Unix())
-		if sess.MfaSerial != "" {
+		if sess.IsCredentialProcess() {
+			label += " (credential_process)"
+		} else if sess.IsAssumeRole() {
+			label += " (role)"
+		} else if sess.MfaSerial != "" {
 			label += " (mfa)"
 		}
 		sessionNames = append(sessionNames, label)
@@ -107,7 +133,11 @@ func LsCommand(input LsCommandInput) error {
 		for _, sess := range sessions {
 			if profileName == sess.ProfileName {
 				label := fmt.Sprintf("%d", sess.Expiration.Unix())
-				if sess.MfaSerial != "" {
+				if sess.IsCredentialProcess() {
+					label += " (credential_process)"
+				} else if sess.IsAssumeRole() {
+					label += " (role)"
+				} else if sess.MfaSerial != "" {
 					label += " (mfa)"
 				}
 				sessionLabels = append(sessionLabels, label)
@@ -21,3 +21,23 @@ func ExampleLsCommand() {
 	// Output:
 	// llamas
 }
+
+func ExampleLsCommand_expired() {
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "session,bGxhbWFz,,1000000000"},
+		{Key: "session,bGxhbWFz,,4000000000"},
+	})
+
+	for _, filter := range []string{"--expired", "--valid"} {
+		app := kingpin.New(`aws-vault`, ``)
+		ConfigureGlobals(app)
+		ConfigureListCommand(app)
+		kingpin.MustParse(app.Parse([]string{
+			"list", "--sessions", filter,
+		}))
+	}
+
+	// Output:
+	// 1000000000
+	// 4000000000
+}
@@ -0,0 +1,115 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+	ini "gopkg.in/ini.v1"
+)
+
+// projectFileName is the name of the project-local file, looked for in the working directory and its parents
+const projectFileName = ".aws-vault"
+
+// ProjectFile is a project-local file setting the default profile and backend, e.g.
+//
+//	profile = dev
+//	backend = file
+type ProjectFile struct {
+	Path    string
+	Profile string `ini:"profile"`
+	Backend string `ini:"backend"`
+}
+
+var (
+	projectFile     *ProjectFile
+	projectFileOnce sync.Once
+)
+
+// currentProjectFile returns the project file for the working directory, or an empty one if there isn't one
+func currentProjectFile() *ProjectFile {
+	projectFileOnce.Do(func() {
+		projectFile = &ProjectFile{}
+		dir, err := os.Getwd()
+		if err != nil {
+			return
+		}
+		path, ok := findProjectFile(dir)
+		if !ok {
+			return
+		}
+		// this runs before --debug is parsed, so problems are shown regardless
+		f, err := loadProjectFile(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "aws-vault: ignoring %s: %v\n", path, err)
+			return
+		}
+		projectFile = f
+	})
+	return projectFile
+}
+
+// findProjectFile looks for the project file in dir and then each of its parents
+func findProjectFile(dir string) (string, bool) {
+	for {
+		path := filepath.Join(dir, projectFileName)
+		if fi, err := os.Stat(path); err == nil && !fi.IsDir() {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+func loadProjectFile(path string) (*ProjectFile, error) {
+	f := &ProjectFile{Path: path}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return nil, err
+	}
+	if err = cfg.Section("").MapTo(f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// profileArg adds the profile argument to cmd, which is required unless the project file sets a profile
+func profileArg(cmd *kingpin.CmdClause, profileName *string) {
+	arg := cmd.Arg("profile", "Name of the profile, defaults to the profile in the "+projectFileName+" project file").
+		HintAction(awsConfigFile.ProfileNames)
+
+	if profile := currentProjectFile().Profile; profile != "" {
+		arg.Default(profile).StringVar(profileName)
+	} else {
+		arg.Required().StringVar(profileName)
+	}
+}
+
+// projectCommand returns the command given without a profile, which kingpin parses as the profile,
+// from the arguments in elements. It's only used when the project file sets a profile
+func projectCommand(elements []*kingpin.ParseElement, profileName string, configFile *vault.ConfigFile) ([]string, bool) {
+	if currentProjectFile().Profile == "" || profileName == currentProjectFile().Profile {
+		return nil, false
+	}
+	if configFile != nil {
+		if _, ok := configFile.ProfileSection(profileName); ok {
+			return nil, false
+		}
+	}
+	var cmdline []string
+	for _, element := range elements {
+		if _, ok := element.Clause.(*kingpin.ArgClause); ok && element.Value != nil {
+			cmdline = append(cmdline, *element.Value)
+		}
+	}
+	if len(cmdline) == 0 || cmdline[0] != profileName {
+		return nil, false
+	}
+	return cmdline, true
+}
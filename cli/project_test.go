@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestFindProjectFileWalksUp(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sub := filepath.Join(dir, "a", "b")
+	if err = os.MkdirAll(sub, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(dir, projectFileName), []byte("profile = dev\nbackend = file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	path, ok := findProjectFile(sub)
+	if !ok {
+		t.Fatal("Expected to find the project file")
+	}
+	f, err := loadProjectFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Profile != "dev" || f.Backend != "file" {
+		t.Fatalf("Unexpected project file %+v", f)
+	}
+}
+
+func TestProjectCommandUsesTheParsedArguments(t *testing.T) {
+	defer func(f *ProjectFile) { projectFile = f }(currentProjectFile())
+	projectFile = &ProjectFile{Profile: "dev"}
+
+	configFile := &vault.ConfigFile{}
+	for _, tc := range []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"exec", "--", "terraform", "plan", "-out", "plan.bin"}, []string{"terraform", "plan", "-out", "plan.bin"}},
+		{[]string{"exec", "--no-session", "--", "aws", "s3", "ls"}, []string{"aws", "s3", "ls"}},
+		{[]string{"exec", "dev", "--", "aws", "s3", "ls"}, nil},
+		{[]string{"exec"}, nil},
+	} {
+		app := kingpin.New("aws-vault", "")
+		input := ExecCommandInput{}
+		cmd := app.Command("exec", "")
+		cmd.Flag("no-session", "").BoolVar(&input.NoSession)
+		profileArg(cmd, &input.ProfileName)
+		cmd.Arg("cmd", "").StringVar(&input.Command)
+		cmd.Arg("args", "").StringsVar(&input.Args)
+
+		// ParseContext only collects the elements, Parse sets the values
+		c, err := app.ParseContext(tc.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err = app.Parse(tc.args); err != nil {
+			t.Fatal(err)
+		}
+		cmdline, ok := projectCommand(c.Elements, input.ProfileName, configFile)
+		if ok != (tc.expected != nil) || !reflect.DeepEqual(cmdline, tc.expected) {
+			t.Fatalf("%v: expected %q, got %q", tc.args, tc.expected, cmdline)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// revokePolicyName is the name of the inline policy the IAM console uses to revoke role sessions
+const revokePolicyName = "AWSRevokeOlderSessions"
+
+type RevokeCommandInput struct {
+	ProfileName string
+	Keyring     *vault.CredentialKeyring
+	Config      vault.Config
+}
+
+func ConfigureRevokeCommand(app *kingpin.Application) {
+	input := RevokeCommandInput{}
+
+	cmd := app.Command("revoke", "Revokes all temporary credentials issued for a profile until now")
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(RevokeCommand(input), "revoke")
+	})
+}
+
+func RevokeCommand(input RevokeCommandInput) error {
+	vault.UseSessionCache = false
+
+	configLoader.BaseConfig = input.Config
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	// IAM calls can't be made with GetSessionToken credentials without MFA, so users revoke with
+	// their master credentials and roles with freshly assumed credentials
+	var creds *credentials.Credentials
+	if config.RoleARN == "" {
+		masterCredentialsName, err := vault.MasterCredentialsFor(input.ProfileName, input.Keyring, config)
+		if err != nil {
+			return err
+		}
+		creds = vault.NewMasterCredentials(input.Keyring, masterCredentialsName)
+	} else {
+		creds, err = vault.NewTempCredentials(config, input.Keyring)
+		if err != nil {
+			return fmt.Errorf("Error getting temporary credentials: %w", err)
+		}
+	}
+
+	sess, err := vault.NewProfileSession(creds, config)
+	if err != nil {
+		return err
+	}
+
+	policy, err := revokeOlderSessionsPolicy(time.Now())
+	if err != nil {
+		return err
+	}
+
+	if config.RoleARN == "" {
+		userName, err := vault.GetUsernameFromSession(sess)
+		if err != nil {
+			return err
+		}
+		_, err = iam.New(sess).PutUserPolicy(&iam.PutUserPolicyInput{
+			UserName:       aws.String(userName),
+			PolicyName:     aws.String(revokePolicyName),
+			PolicyDocument: aws.String(policy),
+		})
+		if err != nil {
+			return fmt.Errorf("Can't revoke sessions for user %s: %w", userName, err)
+		}
+		fmt.Printf("Revoked sessions issued before now for user %s\n", userName)
+	} else {
+		roleARN, err := vault.ParseRoleARN(config.RoleARN)
+		if err != nil {
+			return err
+		}
+		_, err = iam.New(sess).PutRolePolicy(&iam.PutRolePolicyInput{
+			RoleName:       aws.String(roleARN.Name),
+			PolicyName:     aws.String(revokePolicyName),
+			PolicyDocument: aws.String(policy),
+		})
+		if err != nil {
+			return fmt.Errorf("Can't revoke sessions for role %s: %w", roleARN.Name, err)
+		}
+		fmt.Printf("Revoked sessions issued before now for role %s\n", roleARN.Name)
+	}
+
+	// cached sessions have been revoked too, whoever they belong to
+	sessions := input.Keyring.Sessions()
+	profileNames, _ := getProfilesInChain(input.ProfileName, configLoader)
+	for _, profileName := range profileNames {
+		if n, _ := sessions.DeleteForAllOwners(profileName); n > 0 {
+			fmt.Printf("Deleted %d sessions for %s\n", n, profileName)
+		}
+	}
+
+	return nil
+}
+
+// revokeOlderSessionsPolicy returns a policy denying everything to temporary credentials issued before t
+func revokeOlderSessionsPolicy(t time.Time) (string, error) {
+	b, err := json.Marshal(map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []map[string]interface{}{{
+			"Effect":   "Deny",
+			"Action":   "*",
+			"Resource": "*",
+			"Condition": map[string]interface{}{
+				"DateLessThan": map[string]string{
+					"aws:TokenIssueTime": t.UTC().Format(time.RFC3339),
+				},
+			},
+		}},
+	})
+	return string(b), err
+}
@@ -31,34 +31,31 @@ func ConfigureRemoveCommand(app *kingpin.Application) {
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
-		RemoveCommand(app, input)
-		return nil
+		return actionFailed(RemoveCommand(input), "")
 	})
 }
 
-func RemoveCommand(app *kingpin.Application, input RemoveCommandInput) {
+func RemoveCommand(input RemoveCommandInput) error {
 	if !input.SessionsOnly {
 		r, err := prompt.TerminalPrompt(fmt.Sprintf("Delete credentials for profile %q? (Y|n)", input.ProfileName))
 		if err != nil {
-			app.Fatalf(err.Error())
-			return
+			return err
 		} else if r == "N" || r == "n" {
-			return
+			return nil
 		}
 
 		if err := input.Keyring.Remove(input.ProfileName); err != nil {
-			app.Fatalf(err.Error())
-			return
+			return err
 		}
 		fmt.Printf("Deleted credentials.\n")
 	}
 
-	sessions := input.Keyring.Sessions()
+	sessions := profileSessions(input.Keyring, input.ProfileName)
 
 	n, err := sessions.Delete(input.ProfileName)
 	if err != nil {
-		app.Fatalf(err.Error())
-		return
+		return err
 	}
 	fmt.Printf("Deleted %d sessions.\n", n)
+	return nil
 }
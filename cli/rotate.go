@@ -6,14 +6,19 @@ import (
 	"time"
 
 	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 type RotateCommandInput struct {
 	NoSession   bool
+	DryRun      bool
+	MinAge      time.Duration
+	Using       string
 	ProfileName string
 	Keyring     *vault.CredentialKeyring
 	Config      vault.Config
@@ -28,6 +33,17 @@ func ConfigureRotateCommand(app *kingpin.Application) {
 		Short('n').
 		BoolVar(&input.NoSession)
 
+	cmd.Flag("dry-run", "Check the credentials can be rotated without changing any keys").
+		BoolVar(&input.DryRun)
+
+	cmd.Flag("min-age", "Skip rotation if the access key is younger than this, so scheduled rotation is idempotent").
+		DurationVar(&input.MinAge)
+
+	cmd.Flag("using", "Rotate with the credentials of this profile, such as an admin profile, for when the credentials being rotated no longer work").
+		PlaceHolder("PROFILE").
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.Using)
+
 	cmd.Arg("profile", "Name of the profile").
 		Required().
 		HintAction(awsConfigFile.ProfileNames).
@@ -36,8 +52,7 @@ func ConfigureRotateCommand(app *kingpin.Application) {
 	cmd.Action(func(c *kingpin.ParseContext) error {
 		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
 		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
-		app.FatalIfError(RotateCommand(input), "rotate")
-		return nil
+		return actionFailed(RotateCommand(input), "rotate")
 	})
 }
 
@@ -58,7 +73,11 @@ func RotateCommand(input RotateCommandInput) error {
 		return err
 	}
 
-	if input.NoSession {
+	if input.DryRun {
+		fmt.Printf("Checking credentials stored for profile '%s' can be rotated\n", masterCredentialsName)
+	} else if input.Using != "" {
+		fmt.Printf("Rotating credentials stored for profile '%s' using profile '%s' (takes 10-20 seconds)\n", masterCredentialsName, input.Using)
+	} else if input.NoSession {
 		fmt.Printf("Rotating credentials stored for profile '%s' using master credentials (takes 10-20 seconds)\n", masterCredentialsName)
 	} else {
 		fmt.Printf("Rotating credentials stored for profile '%s' using a session from profile '%s' (takes 10-20 seconds)\n", masterCredentialsName, input.ProfileName)
@@ -70,32 +89,67 @@ func RotateCommand(input RotateCommandInput) error {
 		return err
 	}
 	oldMasterCredsAccessKeyID := vault.FormatKeyForDisplay(oldMasterCreds.AccessKeyID)
-	log.Printf("Rotating access key %s\n", oldMasterCredsAccessKeyID)
-
-	fmt.Println("Creating a new access key")
 
 	// create a session to rotate the credentials
 	var sessCreds *credentials.Credentials
-	if input.NoSession {
-		sessCreds = vault.NewMasterCredentials(input.Keyring, config.ProfileName)
-	} else {
-		sessCreds, err = vault.NewTempCredentials(config, input.Keyring)
+	var sess *session.Session
+	var iamUserName *string
+	if input.Using != "" {
+		usingConfig, err := configLoader.LoadFromProfile(input.Using)
 		if err != nil {
-			return fmt.Errorf("Error getting temporary credentials: %w", err)
+			return err
+		}
+		if sessCreds, err = vault.NewTempCredentials(usingConfig, input.Keyring); err != nil {
+			return fmt.Errorf("Error getting temporary credentials for %s: %w", input.Using, err)
+		}
+		if sess, err = vault.NewProfileSession(sessCreds, usingConfig); err != nil {
+			return err
+		}
+
+		// the credentials of another profile need to be told which user the access key belongs to
+		if iamUserName, err = accessKeyUserName(sess, oldMasterCreds.AccessKeyID); err != nil {
+			return err
+		}
+	} else {
+		if input.NoSession {
+			sessCreds = vault.NewMasterCredentials(input.Keyring, config.ProfileName)
+		} else {
+			sessCreds, err = vault.NewTempCredentials(config, input.Keyring)
+			if err != nil {
+				return fmt.Errorf("Error getting temporary credentials: %w", err)
+			}
+		}
+
+		if sess, err = vault.NewProfileSession(sessCreds, config); err != nil {
+			return err
+		}
+
+		// A username is needed for some IAM calls if the credentials have assumed a role
+		if iamUserName, err = getUsernameIfAssumingRole(sess, config); err != nil {
+			return err
 		}
 	}
 
-	sess, err := vault.NewSession(sessCreds, config.Region)
-	if err != nil {
-		return err
+	if input.MinAge > 0 {
+		age, err := accessKeyAge(sess, iamUserName, oldMasterCreds.AccessKeyID)
+		if err != nil {
+			return err
+		}
+		if age < input.MinAge {
+			fmt.Printf("Access key %s is %s old, younger than the minimum age of %s, skipping rotation\n",
+				oldMasterCredsAccessKeyID, age.Round(time.Second), input.MinAge)
+			return nil
+		}
+		log.Printf("Access key %s is %s old", oldMasterCredsAccessKeyID, age.Round(time.Second))
 	}
 
-	// A username is needed for some IAM calls if the credentials have assumed a role
-	iamUserName, err := getUsernameIfAssumingRole(sess, config)
-	if err != nil {
-		return err
+	if input.DryRun {
+		return checkRotatable(sess, iamUserName, masterCredentialsName)
 	}
 
+	log.Printf("Rotating access key %s\n", oldMasterCredsAccessKeyID)
+	fmt.Println("Creating a new access key")
+
 	// Create a new access key
 	createOut, err := iam.New(sess).CreateAccessKey(&iam.CreateAccessKeyInput{
 		UserName: iamUserName,
@@ -116,10 +170,9 @@ func RotateCommand(input RotateCommandInput) error {
 	}
 
 	// Delete old sessions
-	sessions := input.Keyring.Sessions()
 	profileNames, err := getProfilesInChain(input.ProfileName, configLoader)
 	for _, profileName := range profileNames {
-		if n, _ := sessions.Delete(profileName); n > 0 {
+		if n, _ := profileSessions(input.Keyring, profileName).Delete(profileName); n > 0 {
 			fmt.Printf("Deleted %d sessions for %s\n", n, profileName)
 		}
 	}
@@ -127,6 +180,11 @@ func RotateCommand(input RotateCommandInput) error {
 	// expire the cached credentials
 	sessCreds.Expire()
 
+	if err = runRotateHook(input.ProfileName, masterCredentialsName, config, newMasterCreds); err != nil {
+		return fmt.Errorf("%w. The new access key %s is stored, but the old access key %s wasn't deleted",
+			err, vault.FormatKeyForDisplay(newMasterCreds.AccessKeyID), oldMasterCredsAccessKeyID)
+	}
+
 	// Use new credentials to delete old access key
 	fmt.Printf("Deleting old access key %s\n", oldMasterCredsAccessKeyID)
 	err = retry(time.Second*20, time.Second*2, func() error {
@@ -146,6 +204,75 @@ func RotateCommand(input RotateCommandInput) error {
 	return nil
 }
 
+// runRotateHook runs on_rotate_cmd, from the rotated profile or else the profile the credentials are
+// stored for, once the new access key works
+func runRotateHook(profileName, masterCredentialsName string, config *vault.Config, newMasterCreds credentials.Value) error {
+	hookCmd := config.OnRotateCmd
+	if hookCmd == "" && masterCredentialsName != profileName {
+		masterConfig, err := configLoader.LoadFromProfile(masterCredentialsName)
+		if err != nil {
+			return err
+		}
+		hookCmd = masterConfig.OnRotateCmd
+	}
+	if hookCmd == "" {
+		return nil
+	}
+
+	// new access keys take a few seconds to be usable
+	fmt.Printf("Checking new access key %s works\n", vault.FormatKeyForDisplay(newMasterCreds.AccessKeyID))
+	sess, err := vault.NewProfileSession(credentials.NewStaticCredentialsFromCreds(newMasterCreds), config)
+	if err != nil {
+		return err
+	}
+	err = retry(time.Second*20, time.Second*2, func() error {
+		_, err := sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("New access key doesn't work: %w", err)
+	}
+
+	fmt.Println("Running on_rotate_cmd")
+	return vault.RunRotateHook(hookCmd, masterCredentialsName, newMasterCreds)
+}
+
+// checkRotatable probes IAM permissions with ListAccessKeys, and checks there is room for a new access key
+func checkRotatable(sess *session.Session, iamUserName *string, masterCredentialsName string) error {
+	listOut, err := iam.New(sess).ListAccessKeys(&iam.ListAccessKeysInput{
+		UserName: iamUserName,
+	})
+	if err != nil {
+		return fmt.Errorf("Credentials for profile '%s' can't be rotated: %w", masterCredentialsName, err)
+	}
+
+	// IAM users are limited to two access keys, so one needs to be free to create a new one
+	if len(listOut.AccessKeyMetadata) >= 2 {
+		return fmt.Errorf("Credentials for profile '%s' can't be rotated: the IAM user already has %d access keys", masterCredentialsName, len(listOut.AccessKeyMetadata))
+	}
+
+	fmt.Printf("Credentials for profile '%s' can be rotated\n", masterCredentialsName)
+	return nil
+}
+
+// accessKeyAge returns how long ago the access key was created, using the CreateDate from ListAccessKeys
+func accessKeyAge(sess *session.Session, iamUserName *string, accessKeyID string) (time.Duration, error) {
+	listOut, err := iam.New(sess).ListAccessKeys(&iam.ListAccessKeysInput{
+		UserName: iamUserName,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("Error listing access keys: %w", err)
+	}
+
+	for _, key := range listOut.AccessKeyMetadata {
+		if aws.StringValue(key.AccessKeyId) == accessKeyID && key.CreateDate != nil {
+			return time.Since(*key.CreateDate), nil
+		}
+	}
+
+	return 0, fmt.Errorf("Access key %s wasn't found for the IAM user", vault.FormatKeyForDisplay(accessKeyID))
+}
+
 func retry(maxTime time.Duration, sleep time.Duration, f func() error) (err error) {
 	t0 := time.Now()
 	i := 0
@@ -167,6 +294,19 @@ func retry(maxTime time.Duration, sleep time.Duration, f func() error) (err erro
 	}
 }
 
+// accessKeyUserName returns the IAM user the access key belongs to, which can be looked up even if the
+// access key is disabled
+func accessKeyUserName(sess *session.Session, accessKeyID string) (*string, error) {
+	out, err := iam.New(sess).GetAccessKeyLastUsed(&iam.GetAccessKeyLastUsedInput{
+		AccessKeyId: aws.String(accessKeyID),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Can't find the IAM user of access key %s: %w", vault.FormatKeyForDisplay(accessKeyID), err)
+	}
+	log.Printf("Found IAM username '%s'", aws.StringValue(out.UserName))
+	return out.UserName, nil
+}
+
 func getUsernameIfAssumingRole(sess *session.Session, config *vault.Config) (*string, error) {
 	if config.RoleARN != "" {
 		n, err := vault.GetUsernameFromSession(sess)
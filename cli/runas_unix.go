@@ -0,0 +1,44 @@
+// +build !windows
+
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// runAsUser makes cmd run as the named user and its groups, and returns the user's home directory
+func runAsUser(cmd *exec.Cmd, name string) (string, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("Invalid uid %q for user %s", u.Uid, name)
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return "", fmt.Errorf("Invalid gid %q for user %s", u.Gid, name)
+	}
+
+	groupIds, err := u.GroupIds()
+	if err != nil {
+		return "", fmt.Errorf("Error listing groups of user %s: %w", name, err)
+	}
+	var groups []uint32
+	for _, g := range groupIds {
+		if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+			groups = append(groups, uint32(id))
+		}
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Credential: &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: groups},
+	}
+	return u.HomeDir, nil
+}
@@ -0,0 +1,36 @@
+// +build !windows
+
+package cli
+
+import (
+	"os/exec"
+	"os/user"
+	"strconv"
+	"testing"
+)
+
+func TestRunAsUserSetsCredential(t *testing.T) {
+	current, err := user.Current()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("true")
+	homeDir, err := runAsUser(cmd, current.Username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if homeDir != current.HomeDir {
+		t.Fatalf("Expected home directory %q, got %q", current.HomeDir, homeDir)
+	}
+	if cmd.SysProcAttr == nil || cmd.SysProcAttr.Credential == nil {
+		t.Fatal("Expected the command to have a credential set")
+	}
+	if uid := strconv.Itoa(int(cmd.SysProcAttr.Credential.Uid)); uid != current.Uid {
+		t.Fatalf("Expected uid %s, got %s", current.Uid, uid)
+	}
+
+	if _, err = runAsUser(exec.Command("true"), "aws-vault-no-such-user"); err == nil {
+		t.Fatal("Expected an error for an unknown user")
+	}
+}
@@ -0,0 +1,12 @@
+// +build windows
+
+package cli
+
+import (
+	"fmt"
+	"os/exec"
+)
+
+func runAsUser(cmd *exec.Cmd, name string) (string, error) {
+	return "", fmt.Errorf("--run-as isn't supported on Windows")
+}
@@ -15,13 +15,10 @@ func ConfigureServerCommand(app *kingpin.Application) {
 		Hidden()
 
 	cmd.Action(func(c *kingpin.ParseContext) error {
-		ServerCommand(app, input)
-		return nil
+		return actionFailed(ServerCommand(input), "Server failed")
 	})
 }
 
-func ServerCommand(app *kingpin.Application, input ServerCommandInput) {
-	if err := server.StartMetadataServer(); err != nil {
-		app.Fatalf("Server failed: %v", err)
-	}
+func ServerCommand(input ServerCommandInput) error {
+	return server.StartMetadataServer()
 }
@@ -0,0 +1,54 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/aws-vault/prompt"
+)
+
+// terminalSSOPicker chooses SSO accounts and roles by number on the terminal
+type terminalSSOPicker struct{}
+
+func (terminalSSOPicker) Pick(title string, options []string) (int, error) {
+	fmt.Fprintf(os.Stderr, "%s:\n", title)
+	for i, option := range options {
+		fmt.Fprintf(os.Stderr, "%3d) %s\n", i+1, option)
+	}
+
+	for {
+		text, err := prompt.TerminalPrompt(fmt.Sprintf("Enter a number [1-%d]: ", len(options)))
+		if err != nil {
+			return 0, err
+		}
+		if n, err := strconv.Atoi(text); err == nil && n >= 1 && n <= len(options) {
+			return n - 1, nil
+		}
+	}
+}
+
+// Remember offers to save the chosen account and role to the profile in the config file
+func (terminalSSOPicker) Remember(profileName, accountID, roleName string) error {
+	text, err := prompt.TerminalPrompt(fmt.Sprintf("Save sso_account_id %s and sso_role_name %s to profile %s? [y/N] ", accountID, roleName, profileName))
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(text, "y") {
+		return nil
+	}
+
+	if err = awsConfigFile.SetProfileKey(profileName, "sso_account_id", accountID); err != nil {
+		return err
+	}
+	if err = awsConfigFile.SetProfileKey(profileName, "sso_role_name", roleName); err != nil {
+		return err
+	}
+	if err = awsConfigFile.Save(); err != nil {
+		return fmt.Errorf("Error saving config file: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "Saved to profile %s in %s\n", profileName, awsConfigFile.Path)
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/99designs/aws-vault/vault"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type TreeCommandInput struct {
+	ProfileName string
+	Keyring     *vault.CredentialKeyring
+}
+
+func ConfigureTreeCommand(app *kingpin.Application) {
+	input := TreeCommandInput{}
+
+	cmd := app.Command("tree", "Print the chain of source profiles and roles for a profile")
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(TreeCommand(os.Stdout, input), "tree")
+	})
+}
+
+func TreeCommand(w io.Writer, input TreeCommandInput) error {
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	return printProfileTree(w, config, input.Keyring, 0)
+}
+
+// printProfileTree prints each hop in the chain, following the same resolution as vault.NewTempCredentialsProvider
+func printProfileTree(w io.Writer, config *vault.Config, keyring *vault.CredentialKeyring, depth int) error {
+	hasStoredCredentials, err := keyring.Has(config.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	indent := strings.Repeat("   ", depth)
+	if depth > 0 {
+		fmt.Fprintf(w, "%s└─ %s", strings.Repeat("   ", depth-1), config.ProfileName)
+	} else {
+		fmt.Fprint(w, config.ProfileName)
+	}
+
+	switch {
+	case config.HasSamlProvider():
+		fmt.Fprintln(w, " (saml)")
+	case config.HasWebIdentity():
+		fmt.Fprintln(w, " (web identity)")
+	case hasStoredCredentials:
+		fmt.Fprintln(w, " (stored credentials)")
+	case config.CredentialProcess != "":
+		fmt.Fprintln(w, " (credential_process)")
+	case config.HasSSOStartURL():
+		fmt.Fprintln(w, " (sso)")
+	case config.CredentialSource != "":
+		fmt.Fprintf(w, " (credential_source %s)\n", config.CredentialSource)
+	case !config.HasSourceProfile():
+		fmt.Fprintln(w, " (credentials missing)")
+	default:
+		fmt.Fprintln(w)
+	}
+
+	for _, roleARN := range config.ChainedRoleARNs {
+		fmt.Fprintf(w, "%s   role_arn:   %s\n", indent, roleARN)
+	}
+	if config.RoleARN != "" {
+		fmt.Fprintf(w, "%s   role_arn:   %s\n", indent, config.RoleARN)
+	}
+	if config.MfaSerial != "" {
+		fmt.Fprintf(w, "%s   mfa_serial: %s\n", indent, config.MfaSerial)
+	}
+	if config.Region != "" {
+		fmt.Fprintf(w, "%s   region:     %s\n", indent, config.Region)
+	}
+
+	if !config.HasSamlProvider() && !config.HasWebIdentity() && !hasStoredCredentials && config.CredentialProcess == "" && config.CredentialSource == "" && config.HasSourceProfile() {
+		return printProfileTree(w, config.SourceProfile, keyring, depth+1)
+	}
+
+	return nil
+}
@@ -0,0 +1,50 @@
+package cli
+
+import (
+	"io/ioutil"
+	"log"
+	"os"
+
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func ExampleTreeCommand() {
+	f, err := ioutil.TempFile("", "aws-config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(`[profile read-only]
+mfa_serial = arn:aws:iam::123456789012:mfa/jonsmith
+
+[profile target]
+source_profile = read-only
+role_arn = arn:aws:iam::123456789012:role/target
+`)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	awsConfigFile, err = vault.LoadConfig(f.Name())
+	if err != nil {
+		log.Fatal(err)
+	}
+	keyringImpl = keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "read-only", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+
+	app := kingpin.New("aws-vault", "")
+	ConfigureGlobals(app)
+	ConfigureTreeCommand(app)
+	kingpin.MustParse(app.Parse([]string{"tree", "target"}))
+
+	// Output:
+	// target
+	//    role_arn:   arn:aws:iam::123456789012:role/target
+	// └─ read-only (stored credentials)
+	//       mfa_serial: arn:aws:iam::123456789012:mfa/jonsmith
+}
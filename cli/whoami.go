@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+type WhoamiCommandInput struct {
+	ProfileName string
+	Keyring     *vault.CredentialKeyring
+	Config      vault.Config
+	Format      string
+}
+
+// CallerIdentity is the result of GetCallerIdentity
+type CallerIdentity struct {
+	Account string `json:"Account"`
+	Arn     string `json:"Arn"`
+	UserID  string `json:"UserId"`
+}
+
+func ConfigureWhoamiCommand(app *kingpin.Application) {
+	input := WhoamiCommandInput{}
+
+	cmd := app.Command("whoami", "Show the identity that credentials for a profile resolve to")
+	cmd.Alias("verify")
+
+	cmd.Flag("mfa-token", "The MFA token to use").
+		Short('t').
+		StringVar(&input.Config.MfaToken)
+
+	cmd.Flag("format", "Output format [text, json]").
+		Default("text").
+		EnumVar(&input.Format, "text", "json")
+
+	cmd.Arg("profile", "Name of the profile").
+		Required().
+		HintAction(awsConfigFile.ProfileNames).
+		StringVar(&input.ProfileName)
+
+	cmd.Action(func(c *kingpin.ParseContext) error {
+		input.Config.MfaPromptMethod = GlobalFlags.PromptDriver
+		input.Keyring = &vault.CredentialKeyring{Keyring: keyringImpl}
+		return actionFailed(WhoamiCommand(input), "whoami")
+	})
+}
+
+func WhoamiCommand(input WhoamiCommandInput) error {
+	configLoader.BaseConfig = input.Config
+	configLoader.ActiveProfile = input.ProfileName
+	config, err := configLoader.LoadFromProfile(input.ProfileName)
+	if err != nil {
+		return err
+	}
+
+	var resp *sts.GetCallerIdentityOutput
+	err = vault.WithTempCredentials(config, input.Keyring, func(creds *vault.ContextCredentials) error {
+		sess, err := vault.NewProfileSession(creds.Credentials, config)
+		if err != nil {
+			return err
+		}
+		resp, err = sts.New(sess).GetCallerIdentity(&sts.GetCallerIdentityInput{})
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to get caller identity for %s: %w", input.ProfileName, err)
+	}
+
+	identity := CallerIdentity{
+		Account: aws.StringValue(resp.Account),
+		Arn:     aws.StringValue(resp.Arn),
+		UserID:  aws.StringValue(resp.UserId),
+	}
+
+	if input.Format == "json" {
+		b, err := marshalJSON(&identity)
+		if err != nil {
+			return fmt.Errorf("Error creating identity json: %w", err)
+		}
+		fmt.Println(string(b))
+		return nil
+	}
+
+	fmt.Printf("Account: %s\nArn:     %s\nUserId:  %s\n", identity.Account, identity.Arn, identity.UserID)
+	return nil
+}
@@ -33,6 +33,18 @@ func run(args []string, exit func(int)) {
 	cli.ConfigureRemoveCommand(app)
 	cli.ConfigureLoginCommand(app)
 	cli.ConfigureServerCommand(app)
-
-	kingpin.MustParse(app.Parse(args))
+	cli.ConfigureWhoamiCommand(app)
+	cli.ConfigureDecodeCommand(app)
+	cli.ConfigureTreeCommand(app)
+	cli.ConfigureAgentCommand(app)
+	cli.ConfigureAgentCredentialsCommand(app)
+	cli.ConfigureImportCommand(app)
+	cli.ConfigureExportCommand(app)
+	cli.ConfigureRevokeCommand(app)
+	cli.ConfigureConfigLintCommand(app)
+	cli.ConfigureConfigShowCommand(app)
+	cli.ConfigureBackendsCommand(app)
+
+	_, err := app.Parse(args)
+	cli.ExitIfError(app, err, exit)
 }
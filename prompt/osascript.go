@@ -21,6 +21,23 @@ func OSAScriptPrompt(prompt string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// OSAScriptPasswordPrompt shows a dialog that hides what's typed
+func OSAScriptPasswordPrompt(prompt string) (string, error) {
+	cmd := exec.Command("osascript", "-e", fmt.Sprintf(`
+		display dialog "%s" default answer "" with hidden answer buttons {"OK", "Cancel"} default button 1
+        text returned of the result
+        return result`,
+		prompt))
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
 func init() {
 	Methods["osascript"] = OSAScriptPrompt
+	PasswordMethods["osascript"] = OSAScriptPasswordPrompt
 }
@@ -8,6 +8,11 @@ var Methods = map[string]PromptFunc{
 	"terminal": TerminalPrompt,
 }
 
+// PasswordMethods are the prompt methods for secrets such as keyring passphrases, which don't show what's typed
+var PasswordMethods = map[string]PromptFunc{
+	"terminal": TerminalPasswordPrompt,
+}
+
 func Available() []string {
 	methods := []string{}
 	for k := range Methods {
@@ -16,6 +21,15 @@ func Available() []string {
 	return methods
 }
 
+// AvailablePassword returns the names of PasswordMethods
+func AvailablePassword() []string {
+	methods := []string{}
+	for k := range PasswordMethods {
+		methods = append(methods, k)
+	}
+	return methods
+}
+
 func Method(s string) PromptFunc {
 	m, ok := Methods[s]
 	if !ok {
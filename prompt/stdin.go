@@ -0,0 +1,40 @@
+package prompt
+
+import (
+	"io"
+	"os"
+	"strings"
+)
+
+// StdinPrompt reads a single line from stdin without printing a prompt or requiring a terminal,
+// so tokens can be piped in from automation
+func StdinPrompt(prompt string) (string, error) {
+	return readLine(os.Stdin)
+}
+
+// readLine reads up to the next newline a byte at a time, rather than through a buffer, so that
+// anything after it is left for later prompts or the command aws-vault runs
+func readLine(r io.Reader) (string, error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == io.EOF && len(line) > 0 {
+			break
+		} else if err != nil {
+			return "", err
+		}
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+func init() {
+	Methods["stdin"] = StdinPrompt
+	PasswordMethods["stdin"] = StdinPrompt
+}
@@ -0,0 +1,25 @@
+package prompt
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadLineLeavesTheRestOfTheInput(t *testing.T) {
+	r := strings.NewReader("123456\n654321\nlast")
+
+	for _, expected := range []string{"123456", "654321", "last"} {
+		line, err := readLine(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != expected {
+			t.Fatalf("Expected %q, got %q", expected, line)
+		}
+	}
+
+	if _, err := readLine(r); err != io.EOF {
+		t.Fatalf("Expected io.EOF once the input is used up, got %v", err)
+	}
+}
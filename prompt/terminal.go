@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
 )
 
 func TerminalPrompt(prompt string) (string, error) {
@@ -17,3 +19,15 @@ func TerminalPrompt(prompt string) (string, error) {
 	}
 	return strings.TrimSpace(text), nil
 }
+
+// TerminalPasswordPrompt reads a line from the terminal without echoing it
+func TerminalPasswordPrompt(prompt string) (string, error) {
+	fmt.Fprint(os.Stderr, prompt)
+
+	b, err := terminal.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
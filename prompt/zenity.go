@@ -2,11 +2,17 @@ package prompt
 
 import (
 	"fmt"
+	"log"
 	"os/exec"
 	"strings"
 )
 
 func ZenityPrompt(prompt string) (string, error) {
+	if _, err := exec.LookPath("zenity"); err != nil {
+		log.Printf("zenity not found, falling back to terminal prompt")
+		return TerminalPrompt(prompt)
+	}
+
 	cmd := exec.Command("zenity", "--entry", "--title=aws-vault", fmt.Sprintf(`--text=%s`, prompt))
 
 	out, err := cmd.Output()
@@ -17,6 +23,24 @@ func ZenityPrompt(prompt string) (string, error) {
 	return strings.TrimSpace(string(out)), nil
 }
 
+// ZenityPasswordPrompt shows a dialog that hides what's typed
+func ZenityPasswordPrompt(prompt string) (string, error) {
+	if _, err := exec.LookPath("zenity"); err != nil {
+		log.Printf("zenity not found, falling back to terminal prompt")
+		return TerminalPasswordPrompt(prompt)
+	}
+
+	cmd := exec.Command("zenity", "--password", "--title=aws-vault")
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(out), "\n"), nil
+}
+
 func init() {
 	Methods["zenity"] = ZenityPrompt
+	PasswordMethods["zenity"] = ZenityPasswordPrompt
 }
@@ -0,0 +1,134 @@
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// CredentialsFunc returns the credentials for a profile
+type CredentialsFunc func(profileName string) (*credentials.Credentials, error)
+
+// AgentCredentials is the response from an agent
+type AgentCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token"`
+	Expiration      string `json:"Expiration"`
+}
+
+// StartAgent serves credentials for any profile on a unix socket. Each request selects a profile
+// with the "profile" query parameter, and must send the token in the Authorization header
+func StartAgent(socketPath string, token string, credsFunc CredentialsFunc) error {
+	// a new directory is only accessible to the user, so no one else can connect before the socket is chmod
+	if err := os.MkdirAll(filepath.Dir(socketPath), 0700); err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(socketPath); err == nil {
+		if conn, err := net.Dial("unix", socketPath); err == nil {
+			conn.Close()
+			return fmt.Errorf("An agent is already running on %s", socketPath)
+		}
+		log.Printf("Removing stale socket %s", socketPath)
+		if err = os.Remove(socketPath); err != nil {
+			return err
+		}
+	}
+
+	l, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	if err = os.Chmod(socketPath, 0600); err != nil {
+		return err
+	}
+
+	log.Printf("Agent running on %s", socketPath)
+	return http.Serve(l, agentHandler(token, credsFunc))
+}
+
+func agentHandler(token string, credsFunc CredentialsFunc) http.HandlerFunc {
+	// requests are handled one at a time so that MFA prompts don't overlap
+	var mu sync.Mutex
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			http.Error(w, "Invalid agent token", http.StatusUnauthorized)
+			return
+		}
+
+		profileName := r.URL.Query().Get("profile")
+		if profileName == "" {
+			http.Error(w, "Missing profile", http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		log.Printf("Agent request for profile %s", profileName)
+		creds, err := credsFunc(profileName)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		// the response has the same fields as the ECS endpoint's, where credentials that don't expire
+		// have no Expiration
+		writeEcsCredentials(w, creds)
+	}
+}
+
+// GetAgentCredentials requests credentials for a profile from the agent listening on socketPath
+func GetAgentCredentials(socketPath string, token string, profileName string) (*AgentCredentials, error) {
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socketPath)
+			},
+		},
+		// the agent may be waiting for an MFA token to be entered
+		Timeout: 5 * time.Minute,
+	}
+
+	req, err := http.NewRequest("GET", "http://agent/?profile="+url.QueryEscape(profileName), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", token)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Can't connect to agent on %s: %w", socketPath, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, fmt.Errorf("Agent returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var creds AgentCredentials
+	if err = json.NewDecoder(resp.Body).Decode(&creds); err != nil {
+		return nil, err
+	}
+
+	return &creds, nil
+}
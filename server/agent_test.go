@@ -0,0 +1,87 @@
+package server
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func serveAgentCredentials(handler http.HandlerFunc, target string, token string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	r.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestAgentHandlerNeedsTheTokenAndAProfile(t *testing.T) {
+	handler := agentHandler("token", func(profileName string) (*credentials.Credentials, error) {
+		return credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""), nil
+	})
+
+	if w := serveAgentCredentials(handler, "/?profile=llamas", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected %d for the wrong token, got %d", http.StatusUnauthorized, w.Code)
+	}
+	if w := serveAgentCredentials(handler, "/", "token"); w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected %d without a profile, got %d", http.StatusBadRequest, w.Code)
+	}
+}
+
+func TestAgentHandlerReportsCredentialsErrors(t *testing.T) {
+	handler := agentHandler("token", func(profileName string) (*credentials.Credentials, error) {
+		return nil, errors.New("no such profile")
+	})
+
+	if w := serveAgentCredentials(handler, "/?profile=llamas", "token"); w.Code != http.StatusInternalServerError {
+		t.Fatalf("Expected %d, got %d", http.StatusInternalServerError, w.Code)
+	}
+}
+
+func TestAgentServesCredentialsThatDontExpire(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "run", "agent.sock")
+
+	go StartAgent(socketPath, "token", func(profileName string) (*credentials.Credentials, error) {
+		return credentials.NewStaticCredentials("AKIA"+profileName, "secret", ""), nil
+	})
+
+	// the agent answers once the socket has been chmod
+	var creds *AgentCredentials
+	for i := 0; i < 100; i++ {
+		if creds, err = GetAgentCredentials(socketPath, "token", "llamas"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.AccessKeyID != "AKIAllamas" || creds.Expiration != "" {
+		t.Fatalf("Expected the credentials without an expiration, got %+v", creds)
+	}
+
+	if runtime.GOOS == "windows" {
+		return
+	}
+	for path, perm := range map[string]os.FileMode{filepath.Dir(socketPath): 0700, socketPath: 0600} {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fi.Mode().Perm() != perm {
+			t.Fatalf("Expected %s to only be accessible to the user, got %s", path, fi.Mode().Perm())
+		}
+	}
+}
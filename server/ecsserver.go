@@ -0,0 +1,149 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// EcsServer serves credentials like the ECS container credentials endpoint, so SDKs in a command
+// fetch fresh credentials from it whenever theirs expire. Unlike the instance metadata server it
+// listens on a random loopback port, so it doesn't need root
+type EcsServer struct {
+	// URL is set as AWS_CONTAINER_CREDENTIALS_FULL_URI for the command
+	URL string
+
+	// Token is set as AWS_CONTAINER_AUTHORIZATION_TOKEN, and must be sent by clients
+	Token string
+
+	// TokenFile is the file written by WriteTokenFile, removed by Close
+	TokenFile string
+
+	listener net.Listener
+}
+
+// StartEcsCredentialsServer starts serving creds in the background on addr, which must be a
+// loopback address as SDKs only fetch credentials over plain HTTP from one. If addr is empty a
+// random port is used
+func StartEcsCredentialsServer(creds *credentials.Credentials, addr string) (*EcsServer, error) {
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return nil, fmt.Errorf("%s isn't a loopback address", addr)
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &EcsServer{
+		URL:      fmt.Sprintf("http://%s/", l.Addr()),
+		Token:    hex.EncodeToString(b),
+		listener: l,
+	}
+
+	log.Printf("Starting ECS credentials server on %s", l.Addr())
+	go func() {
+		if err := http.Serve(l, ecsCredsHandler(s.Token, creds)); err != nil {
+			log.Printf("ECS credentials server stopped: %v", err)
+		}
+	}()
+
+	return s, nil
+}
+
+// WriteTokenFile writes the token to a new file that only the current user can read, to be named by
+// AWS_CONTAINER_AUTHORIZATION_TOKEN_FILE so the token isn't in the command's environment
+func (s *EcsServer) WriteTokenFile() (string, error) {
+	f, err := ioutil.TempFile("", "aws-vault-ecs-token")
+	if err != nil {
+		return "", err
+	}
+	s.TokenFile = f.Name()
+	if _, err = f.WriteString(s.Token); err != nil {
+		f.Close()
+		return "", err
+	}
+	return s.TokenFile, f.Close()
+}
+
+// Close stops the server, and removes the token file if there is one
+func (s *EcsServer) Close() error {
+	if s.TokenFile != "" {
+		os.Remove(s.TokenFile)
+	}
+	return s.listener.Close()
+}
+
+func ecsCredsHandler(token string, creds *credentials.Credentials) http.HandlerFunc {
+	// credentials are refreshed one request at a time, so an MFA prompt isn't shown twice
+	var mu sync.Mutex
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte(token)) != 1 {
+			http.Error(w, "Invalid authorization token", http.StatusForbidden)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		log.Printf("Credentials.IsExpired() = %#v", creds.IsExpired())
+		writeEcsCredentials(w, creds)
+	}
+}
+
+// ecsCredentials is the response of the ECS container credentials endpoint
+type ecsCredentials struct {
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string `json:"SecretAccessKey"`
+	Token           string `json:"Token,omitempty"`
+	Expiration      string `json:"Expiration,omitempty"`
+}
+
+// writeEcsCredentials writes creds in the format of the ECS container credentials endpoint, where
+// Expiration is optional so credentials that don't expire can be served too
+func writeEcsCredentials(w http.ResponseWriter, creds *credentials.Credentials) {
+	val, err := creds.Get()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ecsCredentials{
+		AccessKeyID:     val.AccessKeyID,
+		SecretAccessKey: val.SecretAccessKey,
+		Token:           val.SessionToken,
+	}
+	if expiration, err := creds.ExpiresAt(); err == nil {
+		resp.Expiration = expiration.Format(awsTimeFormat)
+		log.Printf("Serving credentials via ECS endpoint, expiration of %s (%s)", resp.Expiration, time.Until(expiration).String())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err = json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("Failed to write credentials: %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// refreshingProvider returns new credentials that expire in an hour each time it's retrieved
+type refreshingProvider struct {
+	credentials.Expiry
+	retrieves int
+}
+
+func (p *refreshingProvider) Retrieve() (credentials.Value, error) {
+	p.retrieves++
+	p.SetExpiration(time.Now().Add(time.Hour), 5*time.Minute)
+	return credentials.Value{AccessKeyID: "ASIAEXAMPLE", SecretAccessKey: "secret", SessionToken: "token"}, nil
+}
+
+func serveEcsCredentials(t *testing.T, handler http.HandlerFunc, token string) (*httptest.ResponseRecorder, ecsCredentials) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", token)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	var resp ecsCredentials
+	if w.Code == http.StatusOK {
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return w, resp
+}
+
+func TestEcsCredsHandlerNeedsTheToken(t *testing.T) {
+	handler := ecsCredsHandler("token", credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""))
+
+	if w, _ := serveEcsCredentials(t, handler, "wrong"); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected %d for the wrong token, got %d", http.StatusForbidden, w.Code)
+	}
+	if w, _ := serveEcsCredentials(t, handler, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("Expected %d without a token, got %d", http.StatusForbidden, w.Code)
+	}
+}
+
+func TestEcsCredsHandlerServesCredentialsThatDontExpire(t *testing.T) {
+	handler := ecsCredsHandler("token", credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""))
+
+	w, resp := serveEcsCredentials(t, handler, "token")
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected %d, got %d", http.StatusOK, w.Code)
+	}
+	if resp.AccessKeyID != "AKIAEXAMPLE" || resp.Expiration != "" {
+		t.Fatalf("Expected the credentials without an expiration, got %+v", resp)
+	}
+}
+
+func TestEcsCredsHandlerRefreshesExpiredCredentials(t *testing.T) {
+	p := &refreshingProvider{}
+	creds := credentials.NewCredentials(p)
+	handler := ecsCredsHandler("token", creds)
+
+	_, resp := serveEcsCredentials(t, handler, "token")
+	expiration, err := time.Parse(awsTimeFormat, resp.Expiration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiration.After(time.Now()) {
+		t.Fatalf("Expected an expiration in the future, got %s", resp.Expiration)
+	}
+
+	// credentials past their expiry window are refreshed rather than served again
+	creds.Expire()
+	_, resp = serveEcsCredentials(t, handler, "token")
+	if p.retrieves != 2 {
+		t.Fatalf("Expected the credentials to be refreshed, got %d retrieves", p.retrieves)
+	}
+	if expiration, err = time.Parse(awsTimeFormat, resp.Expiration); err != nil || !expiration.After(time.Now()) {
+		t.Fatalf("Expected an expiration in the future, got %s", resp.Expiration)
+	}
+}
@@ -1,30 +1,53 @@
 package vault
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"strings"
+	"text/template"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
+// minAssumeRoleDuration is the shortest duration accepted by AssumeRole
+const minAssumeRoleDuration = 15 * time.Minute
+
 // AssumeRoleProvider retrieves temporary credentials from STS using AssumeRole
 type AssumeRoleProvider struct {
-	StsClient       *sts.STS
-	RoleARN         string
+	StsClient *sts.STS
+	IamClient *iam.IAM
+	RoleARN   string
+
+	// RoleARNResolver, if set, resolves a RoleARN that references a secret the first time the role
+	// is assumed. Sessions are still cached under RoleARN
+	RoleARNResolver func() (string, error)
+	resolvedRoleARN string
+
 	RoleSessionName string
 	ExternalID      string
 	Duration        time.Duration
 	ExpiryWindow    time.Duration
+
+	// SourceCreds, if set, caps Duration at the remaining lifetime of the source credentials
+	SourceCreds *ContextCredentials
 	Mfa
 	credentials.Expiry
 }
 
 // Retrieve generates a new set of temporary credentials using STS AssumeRole
 func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
-	role, err := p.assumeRole()
+	return p.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext is Retrieve, but stops waiting for the MFA token or STS when ctx is done
+func (p *AssumeRoleProvider) RetrieveWithContext(ctx context.Context) (credentials.Value, error) {
+	role, err := p.assumeRole(ctx)
 	if err != nil {
 		return credentials.Value{}, err
 	}
@@ -37,42 +60,163 @@ func (p *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 	}, nil
 }
 
-func (p *AssumeRoleProvider) roleSessionName() string {
-	if p.RoleSessionName == "" {
-		// Try to work out a role name that will hopefully end up unique.
-		return fmt.Sprintf("%d", time.Now().UTC().UnixNano())
+// resolveRoleARN resolves RoleARN with RoleARNResolver, if it hasn't been already
+func (p *AssumeRoleProvider) resolveRoleARN() error {
+	if p.RoleARNResolver == nil || p.resolvedRoleARN != "" {
+		return nil
+	}
+	roleARN, err := p.RoleARNResolver()
+	if err != nil {
+		return err
+	}
+	p.resolvedRoleARN = roleARN
+	return nil
+}
+
+// roleARN returns the ARN of the role, once it's been resolved
+func (p *AssumeRoleProvider) roleARN() string {
+	if p.resolvedRoleARN != "" {
+		return p.resolvedRoleARN
+	}
+	return p.RoleARN
+}
+
+func (p *AssumeRoleProvider) roleSessionName(ctx context.Context) (string, error) {
+	if strings.Contains(p.RoleSessionName, "{{") {
+		sessionName, err := expandRoleSessionName(ctx, p.RoleSessionName, p.roleARN(), p.StsClient, p.IamClient)
+		if err != nil || sessionName != "" {
+			return sessionName, err
+		}
+		log.Printf("role_session_name %q expanded to an empty name, using the default", p.RoleSessionName)
+	} else if p.RoleSessionName != "" {
+		return p.RoleSessionName, nil
+	}
+
+	sessionName, err := expandRoleSessionName(ctx, defaultRoleSessionName, p.roleARN(), p.StsClient, p.IamClient)
+	if err == nil {
+		p.RoleSessionName = sessionName
+		return sessionName, nil
+	}
+	log.Printf("Couldn't determine the identity for the role session name: %v", err)
+
+	// Try to work out a role name that will hopefully end up unique.
+	return fmt.Sprintf("%d", time.Now().UTC().UnixNano()), nil
+}
+
+// externalID returns ExternalID with any template expanded, e.g. {{.AccountID}} is replaced by the account id of RoleARN
+func (p *AssumeRoleProvider) externalID() (string, error) {
+	if !strings.Contains(p.ExternalID, "{{") {
+		return p.ExternalID, nil
+	}
+
+	tmpl, err := template.New("external_id").Option("missingkey=error").Parse(p.ExternalID)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing external_id template: %w", err)
+	}
+
+	roleARN, err := ParseRoleARN(p.roleARN())
+	if err != nil {
+		return "", fmt.Errorf("Error parsing role_arn for external_id template: %w", err)
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, struct{ AccountID string }{AccountID: roleARN.AccountID})
+	if err != nil {
+		return "", fmt.Errorf("Error expanding external_id template: %w", err)
+	}
+
+	return b.String(), nil
+}
+
+// duration returns the wanted duration, capped at the remaining lifetime of SourceCreds
+func (p *AssumeRoleProvider) duration(ctx context.Context) (time.Duration, error) {
+	if p.SourceCreds == nil {
+		return p.Duration, nil
+	}
+
+	// errors are surfaced by the AssumeRole call which uses the same credentials
+	if _, err := p.SourceCreds.GetWithContext(ctx); err != nil {
+		return p.Duration, nil
+	}
+
+	// master credentials don't expire
+	expiresAt, err := p.SourceCreds.ExpiresAt()
+	if err != nil || expiresAt.IsZero() {
+		return p.Duration, nil
 	}
 
-	return p.RoleSessionName
+	remaining := time.Until(expiresAt) - p.ExpiryWindow
+	if remaining >= p.Duration {
+		return p.Duration, nil
+	}
+	if remaining < minAssumeRoleDuration {
+		return 0, fmt.Errorf("role %s: the source credentials expire in %s, sooner than the %s minimum duration of AssumeRole", p.roleARN(), time.Until(expiresAt).Round(time.Second), minAssumeRoleDuration)
+	}
+	log.Printf("Capping AssumeRole duration at %s to match the source credentials", remaining.Round(time.Second))
+
+	return remaining, nil
+}
+
+// durationError explains an AssumeRole error caused by asking for a longer session than the role allows
+func (p *AssumeRoleProvider) durationError(err error, duration time.Duration) error {
+	aerr, ok := err.(awserr.Error)
+	if !ok || aerr.Code() != "ValidationError" || !strings.Contains(aerr.Message(), "DurationSeconds exceeds") {
+		return err
+	}
+	if strings.Contains(aerr.Message(), "role chaining") {
+		return &ConfigError{fmt.Errorf("role %s: the duration %s is longer than the 1h allowed when chaining roles, reduce it with --assume-role-ttl or duration_seconds", p.roleARN(), duration)}
+	}
+	return &ConfigError{fmt.Errorf("role %s: the duration %s is longer than the role's maximum session duration, reduce it with --assume-role-ttl or duration_seconds, or raise the role's MaxSessionDuration", p.roleARN(), duration)}
 }
 
-func (p *AssumeRoleProvider) assumeRole() (*sts.Credentials, error) {
-	var err error
+func (p *AssumeRoleProvider) assumeRole(ctx context.Context) (*sts.Credentials, error) {
+	if err := p.resolveRoleARN(); err != nil {
+		return nil, err
+	}
+
+	roleSessionName, err := p.roleSessionName(ctx)
+	if err != nil {
+		return nil, err
+	}
 
+	duration, err := p.duration(ctx)
+	if err != nil {
+		return nil, err
+	}
 	input := &sts.AssumeRoleInput{
-		RoleArn:         aws.String(p.RoleARN),
-		RoleSessionName: aws.String(p.roleSessionName()),
-		DurationSeconds: aws.Int64(int64(p.Duration.Seconds())),
+		RoleArn:         aws.String(p.roleARN()),
+		RoleSessionName: aws.String(roleSessionName),
+		DurationSeconds: aws.Int64(int64(duration.Seconds())),
 	}
 
 	if p.ExternalID != "" {
-		input.ExternalId = aws.String(p.ExternalID)
+		externalID, err := p.externalID()
+		if err != nil {
+			return nil, err
+		}
+		input.ExternalId = aws.String(externalID)
 	}
 
 	if p.MfaSerial != "" {
-		input.SerialNumber = aws.String(p.MfaSerial)
-		input.TokenCode, err = p.GetMfaToken()
+		if err = p.resolveMfaSerial(); err != nil {
+			return nil, err
+		}
+		input.SerialNumber = aws.String(p.serial())
+		input.TokenCode, err = p.GetMfaTokenWithContext(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	resp, err := p.StsClient.AssumeRole(input)
+	done := traceStep("sts:AssumeRole %s", p.roleARN())
+	resp, err := p.StsClient.AssumeRoleWithContext(ctx, input)
+	done()
 	if err != nil {
-		return nil, err
+		return nil, p.durationError(err, duration)
 	}
 
 	log.Printf("Generated credentials %s using AssumeRole, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	notifyHook(p.Hook, HookEventRefresh)
 
 	return resp.Credentials, nil
 }
@@ -0,0 +1,360 @@
+package vault_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// newFakeAWSSession returns a session for a fake STS and IAM endpoint, which records the form of
+// each AssumeRole and GetFederationToken request in form
+func newFakeAWSSession(t *testing.T, accountAlias string, form *url.Values) (*session.Session, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		switch r.PostForm.Get("Action") {
+		case "GetCallerIdentity":
+			fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult>
+<Arn>arn:aws:iam::123456789012:user/alice</Arn><Account>123456789012</Account><UserId>AIDAEXAMPLE</UserId>
+</GetCallerIdentityResult></GetCallerIdentityResponse>`)
+		case "ListAccountAliases":
+			if accountAlias == "" {
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `<ErrorResponse><Error><Code>AccessDenied</Code><Message>denied</Message></Error></ErrorResponse>`)
+				return
+			}
+			fmt.Fprintf(w, `<ListAccountAliasesResponse><ListAccountAliasesResult>
+<AccountAliases><member>%s</member></AccountAliases><IsTruncated>false</IsTruncated>
+</ListAccountAliasesResult></ListAccountAliasesResponse>`, accountAlias)
+		case "AssumeRole", "AssumeRoleWithWebIdentity", "GetFederationToken":
+			*form = r.PostForm
+			action := r.PostForm.Get("Action")
+			fmt.Fprintf(w, `<%[1]sResponse><%[1]sResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey>
+<SessionToken>token</SessionToken><Expiration>%[2]s</Expiration>
+</Credentials></%[1]sResult></%[1]sResponse>`, action, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			t.Fatalf("Unexpected action %q", r.PostForm.Get("Action"))
+		}
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	return sess, ts.Close
+}
+
+func TestAssumeRoleExpandsExternalIDTemplate(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	p := &vault.AssumeRoleProvider{
+		StsClient:  sts.New(sess),
+		RoleARN:    "arn:aws:iam::123456789012:role/partners/acme/partner",
+		ExternalID: "partner-{{.AccountID}}",
+		Duration:   time.Hour,
+	}
+	if _, err := p.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+
+	if externalID := form.Get("ExternalId"); externalID != "partner-123456789012" {
+		t.Fatalf("Expected external id %q, got %q", "partner-123456789012", externalID)
+	}
+}
+
+func TestAssumeRoleDefaultSessionName(t *testing.T) {
+	var testCases = []struct {
+		AccountAlias string
+		SessionName  string
+	}{
+		{"prod-account", "alice@prod-account"},
+		{"", "alice@123456789012"},
+	}
+
+	for _, tc := range testCases {
+		var form url.Values
+		sess, done := newFakeAWSSession(t, tc.AccountAlias, &form)
+
+		p := &vault.AssumeRoleProvider{
+			StsClient: sts.New(sess),
+			IamClient: iam.New(sess),
+			RoleARN:   "arn:aws:iam::123456789012:role/admin",
+			Duration:  time.Hour,
+		}
+		if _, err := p.Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		if sessionName := form.Get("RoleSessionName"); sessionName != tc.SessionName {
+			t.Fatalf("Expected role session name %q, got %q", tc.SessionName, sessionName)
+		}
+	}
+}
+
+func TestAssumeRoleSessionNameTemplate(t *testing.T) {
+	os.Setenv("BUILD_ID", "build #42")
+	defer os.Unsetenv("BUILD_ID")
+
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	p := &vault.AssumeRoleProvider{
+		StsClient:       sts.New(sess),
+		RoleARN:         "arn:aws:iam::123456789012:role/admin",
+		RoleSessionName: "ci-{{.Env.BUILD_ID}}{{.Env.UNSET_VARIABLE}}",
+		Duration:        time.Hour,
+	}
+	if _, err := p.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessionName := form.Get("RoleSessionName"); sessionName != "ci-build--42" {
+		t.Fatalf("Expected role session name %q, got %q", "ci-build--42", sessionName)
+	}
+}
+
+func TestAssumeRoleSessionNameTemplateWithRolePath(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	p := &vault.AssumeRoleProvider{
+		StsClient:       sts.New(sess),
+		RoleARN:         "arn:aws:iam::123456789012:role/team/dev/Admin",
+		RoleSessionName: "{{.RoleName}}@{{.AccountID}}",
+		Duration:        time.Hour,
+	}
+	if _, err := p.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+
+	if sessionName := form.Get("RoleSessionName"); sessionName != "Admin@123456789012" {
+		t.Fatalf("Expected role session name %q, got %q", "Admin@123456789012", sessionName)
+	}
+	if roleARN := form.Get("RoleArn"); roleARN != "arn:aws:iam::123456789012:role/team/dev/Admin" {
+		t.Fatalf("Expected the role ARN to be passed unchanged, got %q", roleARN)
+	}
+}
+
+func TestAssumeRoleSessionNameTemplateOnlyLooksUpTheIdentityItUses(t *testing.T) {
+	var testCases = []struct {
+		RoleSessionName string
+		SessionName     string
+		Operations      string
+	}{
+		{"ci-{{.RoleName}}", "ci-admin", "AssumeRole"},
+		{"{{.CallerName}}-ci", "alice-ci", "GetCallerIdentity,AssumeRole"},
+		{"{{.CallerName}}@{{.AccountAlias}}-ci", "alice@prod-account-ci", "GetCallerIdentity,ListAccountAliases,AssumeRole"},
+	}
+
+	for _, tc := range testCases {
+		var form url.Values
+		sess, done := newFakeAWSSession(t, "prod-account", &form)
+
+		var operations []string
+		sess.Handlers.Send.PushFront(func(r *request.Request) {
+			operations = append(operations, r.Operation.Name)
+		})
+
+		p := &vault.AssumeRoleProvider{
+			StsClient:       sts.New(sess),
+			IamClient:       iam.New(sess),
+			RoleARN:         "arn:aws:iam::123456789012:role/admin",
+			RoleSessionName: tc.RoleSessionName,
+			Duration:        time.Hour,
+		}
+		if _, err := p.Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		if sessionName := form.Get("RoleSessionName"); sessionName != tc.SessionName {
+			t.Fatalf("Expected role session name %q, got %q", tc.SessionName, sessionName)
+		}
+		if ops := strings.Join(operations, ","); ops != tc.Operations {
+			t.Fatalf("%s: expected the calls %s, got %s", tc.RoleSessionName, tc.Operations, ops)
+		}
+	}
+}
+
+func TestValidateRoleSessionName(t *testing.T) {
+	for name, valid := range map[string]bool{
+		"debug-alice@example.com": true,
+		"a":                       false,
+		"has space":               false,
+		"{{.Env.USER}}":           false,
+		strings.Repeat("x", 65):   false,
+	} {
+		if err := vault.ValidateRoleSessionName(name); (err == nil) != valid {
+			t.Errorf("ValidateRoleSessionName(%q) returned %v", name, err)
+		}
+	}
+}
+
+func TestAssumeRoleExplainsMaxSessionDurationErrors(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>ValidationError</Code>
+<Message>The requested DurationSeconds exceeds the MaxSessionDuration set for this role.</Message></Error></ErrorResponse>`)
+	}))
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	p := &vault.AssumeRoleProvider{
+		StsClient:       sts.New(sess),
+		RoleARN:         "arn:aws:iam::123456789012:role/admin",
+		RoleSessionName: "alice",
+		Duration:        8 * time.Hour,
+	}
+	_, err := p.Retrieve()
+
+	var configErr *vault.ConfigError
+	if !errors.As(err, &configErr) {
+		t.Fatalf("Expected a ConfigError, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "8h0m0s is longer than the role's maximum session duration") {
+		t.Fatalf("Unexpected error %q", err)
+	}
+}
+
+func TestAssumeRoleWithContextStopsWaitingForTheMfaToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell command")
+	}
+
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	p := &vault.AssumeRoleProvider{
+		StsClient:       sts.New(sess),
+		RoleARN:         "arn:aws:iam::111111111111:role/admin",
+		RoleSessionName: "alice",
+		Duration:        time.Hour,
+		Mfa: vault.Mfa{
+			MfaSerial:   "arn:aws:iam::111111111111:mfa/alice",
+			MfaTokenCmd: "exec sleep 10",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := p.RetrieveWithContext(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Fatalf("Expected mfa_token_cmd to be killed, took %s", time.Since(start))
+	}
+	if form != nil {
+		t.Fatalf("Expected AssumeRole not to be called")
+	}
+}
+
+// expiringProvider returns static credentials that expire after a fixed time
+type expiringProvider struct {
+	credentials.Expiry
+	expiration time.Time
+}
+
+func (p *expiringProvider) Retrieve() (credentials.Value, error) {
+	p.SetExpiration(p.expiration, 0)
+	return credentials.Value{AccessKeyID: "ASIASOURCE", SecretAccessKey: "secret", SessionToken: "token"}, nil
+}
+
+// autoDurationProvider returns a provider for a profile with duration_seconds=auto, sourced from
+// credentials that expire after expiresIn
+func autoDurationProvider(t *testing.T, expiresIn time.Duration) *vault.AssumeRoleProvider {
+	f := newConfigFile(t, []byte(`[profile auto]
+role_arn=arn:aws:iam::123456789012:role/admin
+role_session_name=alice
+duration_seconds=auto
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	configLoader := &vault.ConfigLoader{File: configFile, ActiveProfile: "auto"}
+	config, err := configLoader.LoadFromProfile("auto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sourceCreds := credentials.NewCredentials(&expiringProvider{expiration: time.Now().Add(expiresIn)})
+	p, err := vault.NewAssumeRoleProvider(sourceCreds, config, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestAutoDurationCapsTheAssumeRoleDuration(t *testing.T) {
+	p := autoDurationProvider(t, 45*time.Minute)
+
+	var form url.Values
+	sess, closeServer := newFakeAWSSession(t, "", &form)
+	defer closeServer()
+	p.StsClient = sts.New(sess)
+	if _, err := p.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the source's remaining 45m, less the 5m expiry window, rather than the default 1h
+	var seconds int
+	fmt.Sscan(form.Get("DurationSeconds"), &seconds)
+	if expected := int((40 * time.Minute).Seconds()); seconds > expected || seconds < expected-60 {
+		t.Fatalf("Expected a DurationSeconds of about %d, got %q", expected, form.Get("DurationSeconds"))
+	}
+}
+
+func TestAutoDurationRefusesToOutliveTheSource(t *testing.T) {
+	p := autoDurationProvider(t, 10*time.Minute)
+
+	var form url.Values
+	sess, closeServer := newFakeAWSSession(t, "", &form)
+	defer closeServer()
+	p.StsClient = sts.New(sess)
+
+	_, err := p.Retrieve()
+	if err == nil || !strings.Contains(err.Error(), "sooner than the 15m0s minimum duration of AssumeRole") {
+		t.Fatalf("Expected an error about the source expiring, got %v", err)
+	}
+	if form != nil {
+		t.Fatalf("Expected AssumeRole not to be called")
+	}
+}
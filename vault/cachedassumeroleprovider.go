@@ -0,0 +1,101 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// assumeRoleSessionPrefix is prepended to the role ARN to form the MFA serial part of the session key
+// that AssumeRole credentials are cached under, so each role has its own cache. The external id and
+// source identity, if any, follow the role ARN
+const assumeRoleSessionPrefix = "role_arn:"
+
+// CachedAssumeRoleProvider retrieves cached credentials for the role from the keyring, or if none are
+// cached retrieves temporary credentials from STS using AssumeRole. Credentials are cached per role ARN,
+// separately from the session of the source profile, so profiles sharing a source share its session
+type CachedAssumeRoleProvider struct {
+	CredentialsName string
+	Region          string
+	Provider        *AssumeRoleProvider
+	Keyring         *CredentialKeyring
+	ExpiryWindow    time.Duration
+
+	// SourceIdentity names the source credentials the role is assumed with, such as the source profile
+	// or the previous role of role_arns, so a session assumed from a different source isn't reused
+	SourceIdentity string
+
+	// Owner is who the session is cached for, see KeyringSessions.Owner
+	Owner string
+	credentials.Expiry
+}
+
+// Retrieve returns cached credentials from the keyring, or if no credentials are cached
+// generates a new set of temporary credentials using STS AssumeRole
+func (p *CachedAssumeRoleProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext is Retrieve, but stops waiting for the MFA token or STS when ctx is done
+func (p *CachedAssumeRoleProvider) RetrieveWithContext(ctx context.Context) (credentials.Value, error) {
+	sessions := p.Keyring.Sessions()
+	sessions.Owner = p.Owner
+	cacheKey := p.cacheKey()
+
+	var session *sts.Credentials
+	if Refresh {
+		log.Printf("Refreshing cached credentials for %s", p.CredentialsName)
+	} else if cached, err := sessions.Retrieve(p.CredentialsName, cacheKey, p.Region); err == nil && time.Now().Add(p.ExpiryWindow).Before(*cached.Expiration) {
+		log.Printf("Re-using cached credentials %s generated from AssumeRole, expires in %s", FormatKeyForDisplay(*cached.AccessKeyId), time.Until(*cached.Expiration).String())
+		session = cached
+	}
+
+	if session == nil {
+		if CacheOnly {
+			return credentials.Value{}, fmt.Errorf("profile %s: %w", p.CredentialsName, ErrNoCachedCredentials)
+		}
+
+		var err error
+		if session, err = p.Provider.assumeRole(ctx); err != nil {
+			return credentials.Value{}, err
+		}
+		if err = sessions.Store(p.CredentialsName, cacheKey, p.Region, session); err != nil {
+			return credentials.Value{}, err
+		}
+
+		// the sessions of other roles cached for the profile, such as the hops of role_arns, are kept
+		if _, err = sessions.DeleteReplaced(p.CredentialsName, cacheKey, session); err != nil {
+			log.Printf("Error deleting the sessions replaced for %s: %v", p.CredentialsName, err)
+		}
+	}
+
+	p.SetExpiration(*session.Expiration, p.ExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     *session.AccessKeyId,
+		SecretAccessKey: *session.SecretAccessKey,
+		SessionToken:    *session.SessionToken,
+	}, nil
+}
+
+// cacheKey returns the MFA serial part of the session key that the role's sessions are cached under
+func (p *CachedAssumeRoleProvider) cacheKey() string {
+	key := assumeRoleSessionPrefix + p.Provider.RoleARN
+	if p.Provider.ExternalID != "" {
+		key += ",external_id:" + p.Provider.ExternalID
+	}
+	if p.SourceIdentity != "" {
+		key += ",source:" + p.SourceIdentity
+	}
+	return key
+}
+
+// IsAssumeRole returns true if the session caches AssumeRole credentials
+func (ks KeyringSession) IsAssumeRole() bool {
+	return strings.HasPrefix(ks.MfaSerial, assumeRoleSessionPrefix)
+}
@@ -0,0 +1,176 @@
+package vault_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestCachedAssumeRoleProviderCachesPerRole(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	newProvider := func(profileName, roleARN string) *vault.CachedAssumeRoleProvider {
+		return &vault.CachedAssumeRoleProvider{
+			CredentialsName: profileName,
+			Keyring:         k,
+			Provider: &vault.AssumeRoleProvider{
+				StsClient:       sts.New(sess),
+				RoleARN:         roleARN,
+				RoleSessionName: "alice",
+				Duration:        time.Hour,
+			},
+		}
+	}
+
+	var testCases = []struct {
+		ProfileName string
+		RoleARN     string
+		AssumesRole bool
+	}{
+		{"admin-a", "arn:aws:iam::111111111111:role/admin", true},
+		{"admin-a", "arn:aws:iam::111111111111:role/admin", false},
+		{"admin-b", "arn:aws:iam::222222222222:role/admin", true},
+	}
+
+	for _, tc := range testCases {
+		form = nil
+		if _, err := newProvider(tc.ProfileName, tc.RoleARN).Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		if assumedRole := form.Get("RoleArn"); tc.AssumesRole && assumedRole != tc.RoleARN {
+			t.Fatalf("Expected %s to be assumed, got %q", tc.RoleARN, assumedRole)
+		} else if !tc.AssumesRole && form != nil {
+			t.Fatalf("Expected cached credentials for %s, but %s was assumed", tc.RoleARN, assumedRole)
+		}
+	}
+}
+
+func TestCachedAssumeRoleProviderCachesPerExternalIDAndSource(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	newProvider := func(externalID, sourceIdentity string) *vault.CachedAssumeRoleProvider {
+		return &vault.CachedAssumeRoleProvider{
+			CredentialsName: "partner",
+			Keyring:         k,
+			SourceIdentity:  sourceIdentity,
+			Provider: &vault.AssumeRoleProvider{
+				StsClient:       sts.New(sess),
+				RoleARN:         "arn:aws:iam::111111111111:role/partner",
+				RoleSessionName: "alice",
+				ExternalID:      externalID,
+				Duration:        time.Hour,
+			},
+		}
+	}
+
+	var testCases = []struct {
+		ExternalID     string
+		SourceIdentity string
+		AssumesRole    bool
+	}{
+		{"example-corp", "master", true},
+		{"example-corp", "master", false},
+		{"other-corp", "master", true},
+		{"example-corp", "other-master", true},
+		{"other-corp", "master", false},
+	}
+
+	for _, tc := range testCases {
+		form = nil
+		if _, err := newProvider(tc.ExternalID, tc.SourceIdentity).Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		if tc.AssumesRole && form.Get("ExternalId") != tc.ExternalID {
+			t.Fatalf("Expected the role to be assumed with external id %s from %s, got %q", tc.ExternalID, tc.SourceIdentity, form.Get("ExternalId"))
+		} else if !tc.AssumesRole && form != nil {
+			t.Fatalf("Expected cached credentials for external id %s from %s, but the role was assumed", tc.ExternalID, tc.SourceIdentity)
+		}
+	}
+}
+
+func TestCachedAssumeRoleProviderRefreshOnlyReplacesTheRolesSession(t *testing.T) {
+	const adminRole = "arn:aws:iam::111111111111:role/admin"
+	const readOnlyRole = "arn:aws:iam::111111111111:role/read-only"
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	expiration := time.Now().Add(30 * time.Minute)
+	for _, roleARN := range []string{adminRole, readOnlyRole} {
+		err := k.Sessions().Store("chain", "role_arn:"+roleARN, "", &sts.Credentials{
+			AccessKeyId:     aws.String("ASIACACHED"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      &expiration,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	newProvider := func(stsClient *sts.STS) *vault.CachedAssumeRoleProvider {
+		return &vault.CachedAssumeRoleProvider{
+			CredentialsName: "chain",
+			Keyring:         k,
+			Provider: &vault.AssumeRoleProvider{
+				StsClient:       stsClient,
+				RoleARN:         adminRole,
+				RoleSessionName: "alice",
+				Duration:        time.Hour,
+			},
+		}
+	}
+	cachedKeyID := func(roleARN string) string {
+		creds, err := k.Sessions().Retrieve("chain", "role_arn:"+roleARN, "")
+		if err != nil {
+			t.Fatalf("Expected a cached session for %s: %v", roleARN, err)
+		}
+		return *creds.AccessKeyId
+	}
+
+	vault.Refresh = true
+	defer func() { vault.Refresh = false }()
+
+	// a refresh that fails leaves the cached session in place
+	var form url.Values
+	unreachable, closeUnreachable := newFakeAWSSession(t, "", &form)
+	closeUnreachable()
+	if _, err := newProvider(sts.New(unreachable)).Retrieve(); err == nil {
+		t.Fatal("Expected AssumeRole to fail")
+	}
+	if keyID := cachedKeyID(adminRole); keyID != "ASIACACHED" {
+		t.Fatalf("Expected the cached session to be kept, got %s", keyID)
+	}
+
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+	if _, err := newProvider(sts.New(sess)).Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if form.Get("RoleArn") != adminRole {
+		t.Fatalf("Expected %s to be assumed, got %q", adminRole, form.Get("RoleArn"))
+	}
+	if keyID := cachedKeyID(adminRole); keyID != "ASIAEXAMPLE" {
+		t.Fatalf("Expected the refreshed session to be cached, got %s", keyID)
+	}
+	if keyID := cachedKeyID(readOnlyRole); keyID != "ASIACACHED" {
+		t.Fatalf("Expected the session of %s to be kept, got %s", readOnlyRole, keyID)
+	}
+
+	sessions, err := k.Sessions().AllSessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("Expected the replaced session to be deleted, got %d sessions", len(sessions))
+	}
+}
@@ -1,48 +1,160 @@
 package vault
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	"net"
+	"os"
+	"strings"
 	"time"
 
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	awssession "github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 // CachedSessionTokenProvider retrieves cached credentials from the keyring, or if no credentials are cached
 // retrieves temporary credentials from STS using GetSessionToken
 type CachedSessionTokenProvider struct {
 	CredentialsName string
+	Region          string
 	Provider        *SessionTokenProvider
 	Keyring         *CredentialKeyring
 	ExpiryWindow    time.Duration
+
+	// ExpiredGrace is how long after expiring a cached session is used when a new one can't be
+	// created because of a network error. Zero disables this
+	ExpiredGrace time.Duration
+
+	// VerifyMfa calls GetCallerIdentity with sessions created with MFA before caching them
+	VerifyMfa bool
+
+	// Owner is who the session is cached for, see KeyringSessions.Owner
+	Owner string
 	credentials.Expiry
 }
 
+// sessionTokenFlights coalesces concurrent Retrieve calls for the same session
+var sessionTokenFlights flightGroup
+
 // Retrieve returns cached credentials from the keyring, or if no credentials are cached
-// generates a new set of temporary credentials using STS GetSessionToken
+// generates a new set of temporary credentials using STS GetSessionToken. Concurrent calls for
+// the same profile share a single keyring read and STS call
 func (p *CachedSessionTokenProvider) Retrieve() (credentials.Value, error) {
+	return p.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext is Retrieve, but stops waiting for the MFA token or STS when ctx is done.
+// Concurrent calls wait with the context of the first
+func (p *CachedSessionTokenProvider) RetrieveWithContext(ctx context.Context) (credentials.Value, error) {
+	key := strings.Join([]string{p.CredentialsName, p.Provider.MfaSerial, p.Region, p.Owner}, "\x00")
+	session, err := sessionTokenFlights.Do(key, func() (*sts.Credentials, error) {
+		return p.retrieve(ctx)
+	})
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.SetExpiration(*session.Expiration, p.ExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     *session.AccessKeyId,
+		SecretAccessKey: *session.SecretAccessKey,
+		SessionToken:    *session.SessionToken,
+	}, nil
+}
+
+func (p *CachedSessionTokenProvider) retrieve(ctx context.Context) (*sts.Credentials, error) {
 	sessions := p.Keyring.Sessions()
+	sessions.ExpiredGrace = p.ExpiredGrace
+	sessions.Owner = p.Owner
 
-	session, err := sessions.Retrieve(p.CredentialsName, p.Provider.MfaSerial)
+	// expiring is a cached session that's still valid, but too close to expiring to be re-used
+	var session, expiring *sts.Credentials
+	var err error
+	if Refresh {
+		log.Printf("Refreshing cached credentials for %s", p.CredentialsName)
+		if _, err = sessions.Delete(p.CredentialsName); err != nil {
+			return nil, err
+		}
+		err = keyring.ErrKeyNotFound
+	} else {
+		session, err = sessions.Retrieve(p.CredentialsName, p.Provider.MfaSerial, p.Region)
+		if err == nil && !time.Now().Add(p.ExpiryWindow).Before(*session.Expiration) {
+			log.Printf("Cached session for %s expires in %s, creating a new one", p.CredentialsName, time.Until(*session.Expiration).String())
+			session, expiring, err = nil, session, keyring.ErrKeyNotFound
+		}
+	}
 	if err != nil {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w", p.CredentialsName, ErrNoCachedCredentials)
+		}
+
 		// session lookup missed, we need to create a new one.
-		session, err = p.Provider.GetSessionToken()
+		session, err = p.Provider.GetSessionTokenWithContext(ctx)
+		if err != nil && expiring != nil && isNetworkError(err) {
+			fmt.Fprintf(os.Stderr, "Warning: couldn't refresh the session for %s, using the session that expires in %s: %v\n",
+				p.CredentialsName, time.Until(*expiring.Expiration).Round(time.Second), err)
+			return expiring, nil
+		}
+		if err != nil && p.ExpiredGrace > 0 && isNetworkError(err) {
+			if expired, expiredErr := sessions.RetrieveExpired(p.CredentialsName, p.Provider.MfaSerial, p.Region); expiredErr == nil {
+				fmt.Fprintf(os.Stderr, "Warning: couldn't refresh the session for %s, using the session that expired %s ago: %v\n",
+					p.CredentialsName, time.Since(*expired.Expiration).Round(time.Second), err)
+				return expired, nil
+			}
+		}
 		if err != nil {
-			return credentials.Value{}, err
+			return nil, err
 		}
 
-		err = sessions.Store(p.CredentialsName, p.Provider.MfaSerial, session)
+		if p.VerifyMfa && p.Provider.MfaSerial != "" {
+			if err = p.verify(ctx, session); err != nil {
+				return nil, err
+			}
+		}
+
+		err = sessions.Store(p.CredentialsName, p.Provider.MfaSerial, p.Region, session)
 		if err != nil {
-			return credentials.Value{}, err
+			return nil, err
 		}
 	} else {
 		log.Printf("Re-using cached credentials %s generated from GetSessionToken, expires in %s", FormatKeyForDisplay(*session.AccessKeyId), time.Until(*session.Expiration).String())
 	}
 
-	p.SetExpiration(*session.Expiration, p.ExpiryWindow)
+	return session, nil
+}
 
-	return credentials.Value{
-		AccessKeyID:     *session.AccessKeyId,
-		SecretAccessKey: *session.SecretAccessKey,
-		SessionToken:    *session.SessionToken,
-	}, nil
+// verify checks session works by calling GetCallerIdentity with it, so a broken session isn't cached
+func (p *CachedSessionTokenProvider) verify(ctx context.Context, session *sts.Credentials) error {
+	defer traceStep("verify session for %s", p.CredentialsName)()
+
+	sess, err := awssession.NewSession(p.Provider.StsClient.Config.Copy(&aws.Config{
+		Credentials: credentials.NewStaticCredentials(*session.AccessKeyId, *session.SecretAccessKey, *session.SessionToken),
+	}))
+	if err != nil {
+		return err
+	}
+
+	identity, err := sts.New(sess).GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return &MfaError{fmt.Errorf("The session created with MFA device %s didn't work, so it wasn't cached: %w", p.Provider.serial(), err)}
+	}
+
+	log.Printf("Verified the session for %s as %s", p.CredentialsName, aws.StringValue(identity.Arn))
+	return nil
+}
+
+// isNetworkError returns true if err is from failing to reach AWS, rather than AWS refusing the request
+func isNetworkError(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "RequestError" {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
 }
@@ -0,0 +1,258 @@
+package vault_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// slowKeyring counts how many times keys are listed, taking a while each time like a D-Bus or
+// Keychain round trip
+type slowKeyring struct {
+	keyring.Keyring
+	keysCalls int32
+}
+
+func (k *slowKeyring) Keys() ([]string, error) {
+	atomic.AddInt32(&k.keysCalls, 1)
+	time.Sleep(100 * time.Millisecond)
+	return k.Keyring.Keys()
+}
+
+func TestCachedSessionTokenProviderCoalescesConcurrentRetrieves(t *testing.T) {
+	kr := &slowKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	k := &vault.CredentialKeyring{Keyring: kr}
+	err := k.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 10
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p := &vault.CachedSessionTokenProvider{
+				CredentialsName: "llamas",
+				Region:          "us-east-1",
+				Keyring:         k,
+				Provider:        &vault.SessionTokenProvider{},
+			}
+			val, err := p.Retrieve()
+			if err == nil && val.AccessKeyID != "ASIAEXAMPLE" {
+				t.Errorf("Expected access key %q, got %q", "ASIAEXAMPLE", val.AccessKeyID)
+			}
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls := atomic.LoadInt32(&kr.keysCalls); calls >= n {
+		t.Fatalf("Expected concurrent retrieves to share keyring reads, got %d for %d retrieves", calls, n)
+	}
+}
+
+func TestCachedSessionTokenProviderUsesExpiredSessionWithinGraceWhenOffline(t *testing.T) {
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err = k.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXPIRED"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(-5 * time.Minute)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &vault.CachedSessionTokenProvider{
+		CredentialsName: "llamas",
+		Region:          "us-east-1",
+		Keyring:         k,
+		Provider:        &vault.SessionTokenProvider{StsClient: sts.New(sess), Duration: time.Hour},
+	}
+	if _, err = p.Retrieve(); err == nil {
+		t.Fatal("Expected an error without a grace period")
+	}
+
+	// other commands reading the sessions, with no grace period of their own, keep the expired session
+	if _, err = k.Sessions().Sessions(); err != nil {
+		t.Fatal(err)
+	}
+
+	p.ExpiredGrace = time.Hour
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIAEXPIRED" {
+		t.Fatalf("Expected the expired session, got %q", val.AccessKeyID)
+	}
+
+	p.ExpiredGrace = time.Minute
+	if _, err = p.Retrieve(); err == nil {
+		t.Fatal("Expected an error once the session is older than the grace period")
+	}
+}
+
+func TestCachedSessionTokenProviderDoesntCacheSessionsThatFailVerification(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		switch r.PostForm.Get("Action") {
+		case "GetSessionToken":
+			fmt.Fprintf(w, `<GetSessionTokenResponse><GetSessionTokenResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		case "GetCallerIdentity":
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>InvalidClientTokenId</Code>
+<Message>The security token included in the request is invalid.</Message></Error></ErrorResponse>`)
+		default:
+			t.Fatalf("Unexpected action %q", r.PostForm.Get("Action"))
+		}
+	}))
+	defer ts.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	p := &vault.CachedSessionTokenProvider{
+		CredentialsName: "llamas",
+		Region:          "us-east-1",
+		Keyring:         k,
+		VerifyMfa:       true,
+		Provider: &vault.SessionTokenProvider{
+			StsClient: sts.New(sess),
+			Duration:  time.Hour,
+			Mfa:       vault.Mfa{MfaSerial: "arn:aws:iam::123456789012:mfa/llamas", MfaToken: "123456"},
+		},
+	}
+	if _, err = p.Retrieve(); err == nil {
+		t.Fatal("Expected the session to fail verification")
+	}
+
+	if _, err = k.Sessions().Retrieve("llamas", "arn:aws:iam::123456789012:mfa/llamas", "us-east-1"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected the session not to be cached, got %v", err)
+	}
+}
+
+func TestCachedSessionTokenProviderReplacesSessionsWithinTheExpiryWindow(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		switch action := r.PostForm.Get("Action"); action {
+		case "GetCallerIdentity":
+			fmt.Fprint(w, callerIdentityResponse("arn:aws:iam::123456789012:user/llamas"))
+			return
+		case "GetSessionToken":
+		default:
+			t.Fatalf("Unexpected action %q", action)
+		}
+		fmt.Fprintf(w, `<GetSessionTokenResponse><GetSessionTokenResult><Credentials>
+<AccessKeyId>ASIANEW</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	}))
+	defer ts.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("us-east-1"),
+		Endpoint:    aws.String(ts.URL),
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		MaxRetries:  aws.Int(0),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	storeExpiring := func() {
+		err := k.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXPIRING"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(2 * time.Minute)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	storeExpiring()
+
+	p := &vault.CachedSessionTokenProvider{
+		CredentialsName: "llamas",
+		Region:          "us-east-1",
+		Keyring:         k,
+		ExpiryWindow:    5 * time.Minute,
+		Provider:        &vault.SessionTokenProvider{StsClient: sts.New(sess), Duration: time.Hour},
+	}
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIANEW" {
+		t.Fatalf("Expected a new session rather than one within the expiry window, got %q", val.AccessKeyID)
+	}
+	if p.IsExpired() {
+		t.Fatal("Expected the new session not to be within the expiry window")
+	}
+
+	// when a new session can't be created the cached one is still valid, so it's used
+	ts.Close()
+	k = &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	storeExpiring()
+	p.Keyring = k
+	val, err = p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIAEXPIRING" {
+		t.Fatalf("Expected the cached session when offline, got %q", val.AccessKeyID)
+	}
+}
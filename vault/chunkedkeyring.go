@@ -0,0 +1,134 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// MaxWinCredBlobSize is the largest credential blob Windows Credential Manager stores, CRED_MAX_CREDENTIAL_BLOB_SIZE
+const MaxWinCredBlobSize = 5 * 512
+
+// chunkedItemPrefix starts the data of an item that is split into chunks, followed by the number of chunks
+const chunkedItemPrefix = "aws-vault-chunked:"
+
+// chunkKeySeparator separates the key of a chunked item from the chunk number in the key of each chunk
+const chunkKeySeparator = ",chunk,"
+
+// ChunkedKeyring splits items with more data than MaxSize across several keyring items, reassembling
+// them on Get. Windows Credential Manager needs this for chained session tokens, which can be larger than
+// it allows. The chunks aren't listed by Keys
+type ChunkedKeyring struct {
+	keyring.Keyring
+	MaxSize int
+}
+
+func chunkKey(key string, i int) string {
+	return fmt.Sprintf("%s%s%d", key, chunkKeySeparator, i)
+}
+
+// chunkCount returns the number of chunks if data is the header of a chunked item
+func chunkCount(data []byte) (int, bool) {
+	if !bytes.HasPrefix(data, []byte(chunkedItemPrefix)) {
+		return 0, false
+	}
+	n, err := strconv.Atoi(string(data[len(chunkedItemPrefix):]))
+	return n, err == nil
+}
+
+func (k ChunkedKeyring) Get(key string) (keyring.Item, error) {
+	item, err := k.Keyring.Get(key)
+	if err != nil {
+		return item, err
+	}
+
+	n, ok := chunkCount(item.Data)
+	if !ok {
+		return item, nil
+	}
+
+	var data []byte
+	for i := 0; i < n; i++ {
+		chunk, err := k.Keyring.Get(chunkKey(key, i))
+		if err != nil {
+			return keyring.Item{}, fmt.Errorf("Error reading chunk %d of %s: %w", i, key, err)
+		}
+		data = append(data, chunk.Data...)
+	}
+	item.Data = data
+
+	return item, nil
+}
+
+func (k ChunkedKeyring) Set(item keyring.Item) error {
+	// chunks of a previous, larger item would be left behind
+	if err := k.removeChunks(item.Key); err != nil {
+		return err
+	}
+
+	if len(item.Data) <= k.MaxSize {
+		return k.Keyring.Set(item)
+	}
+
+	n := 0
+	for data := item.Data; len(data) > 0; n++ {
+		size := k.MaxSize
+		if len(data) < size {
+			size = len(data)
+		}
+		chunk := item
+		chunk.Key = chunkKey(item.Key, n)
+		chunk.Data = data[:size]
+		if err := k.Keyring.Set(chunk); err != nil {
+			return err
+		}
+		data = data[size:]
+	}
+
+	header := item
+	header.Data = []byte(chunkedItemPrefix + strconv.Itoa(n))
+	return k.Keyring.Set(header)
+}
+
+func (k ChunkedKeyring) Remove(key string) error {
+	if err := k.removeChunks(key); err != nil {
+		return err
+	}
+	return k.Keyring.Remove(key)
+}
+
+// removeChunks removes the chunks of the item, if it's chunked
+func (k ChunkedKeyring) removeChunks(key string) error {
+	item, err := k.Keyring.Get(key)
+	if err == keyring.ErrKeyNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	n, _ := chunkCount(item.Data)
+	for i := 0; i < n; i++ {
+		if err = k.Keyring.Remove(chunkKey(key, i)); err != nil && err != keyring.ErrKeyNotFound {
+			return err
+		}
+	}
+	return nil
+}
+
+func (k ChunkedKeyring) Keys() ([]string, error) {
+	allKeys, err := k.Keyring.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var keys []string
+	for _, key := range allKeys {
+		if !strings.Contains(key, chunkKeySeparator) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
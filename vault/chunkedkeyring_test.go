@@ -0,0 +1,54 @@
+package vault_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func TestChunkedKeyringSplitsLargeItems(t *testing.T) {
+	backend := keyring.NewArrayKeyring(nil)
+	k := vault.ChunkedKeyring{Keyring: backend, MaxSize: 10}
+
+	data := bytes.Repeat([]byte("0123456789"), 3)
+	data = append(data, '!')
+	if err := k.Set(keyring.Item{Key: "llamas", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+
+	item, err := k.Get("llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(item.Data, data) {
+		t.Fatalf("Expected the chunks to be reassembled, got %q", item.Data)
+	}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0] != "llamas" {
+		t.Fatalf("Expected only the item to be listed, got %v", keys)
+	}
+
+	// a smaller item replaces the chunks
+	if err = k.Set(keyring.Item{Key: "llamas", Data: []byte("small")}); err != nil {
+		t.Fatal(err)
+	}
+	if allKeys, _ := backend.Keys(); len(allKeys) != 1 {
+		t.Fatalf("Expected the chunks to be removed, got %v", allKeys)
+	}
+
+	if err = k.Set(keyring.Item{Key: "llamas", Data: data}); err != nil {
+		t.Fatal(err)
+	}
+	if err = k.Remove("llamas"); err != nil {
+		t.Fatal(err)
+	}
+	if allKeys, _ := backend.Keys(); len(allKeys) != 0 {
+		t.Fatalf("Expected the item and its chunks to be removed, got %v", allKeys)
+	}
+}
@@ -1,14 +1,20 @@
 package vault
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"log"
+	"net"
+	"net/http"
 	"os"
+	"os/user"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/99designs/aws-vault/prompt"
 	"github.com/mitchellh/go-homedir"
 	ini "gopkg.in/ini.v1"
 )
@@ -21,6 +27,10 @@ const (
 	DefaultChainedSessionDuration = time.Hour * 8
 
 	defaultSectionName = "default"
+
+	// durationAuto is the duration value that caps the AssumeRole duration at the
+	// remaining lifetime of the source credentials
+	durationAuto = "auto"
 )
 
 func init() {
@@ -32,6 +42,16 @@ func init() {
 type ConfigFile struct {
 	Path    string
 	iniFile *ini.File
+
+	// contents and sections are kept until the whole file is needed, so that loading a profile
+	// only parses the sections of the profiles it uses
+	contents []byte
+	sections map[string][]sectionSpan
+}
+
+var configLoadOptions = ini.LoadOptions{
+	AllowNestedValues: true,
+	Insensitive:       true,
 }
 
 // configPath returns either $AWS_CONFIG_FILE or ~/.aws/config
@@ -109,29 +129,123 @@ func LoadConfigFromEnv() (*ConfigFile, error) {
 }
 
 func (c *ConfigFile) parseFile() error {
+	b, err := ioutil.ReadFile(c.Path)
+	if err != nil {
+		return &ConfigError{fmt.Errorf("Error parsing config file %q: %v", c.Path, err)}
+	}
+	b = bytes.TrimPrefix(b, []byte("\xef\xbb\xbf"))
+
+	if sections, ok := indexConfigSections(b); ok {
+		log.Printf("Indexed %d sections of config file %s", len(sections), c.Path)
+		c.contents, c.sections = b, sections
+		return nil
+	}
+	return c.parseContents(b)
+}
+
+func (c *ConfigFile) parseContents(b []byte) error {
 	log.Printf("Parsing config file %s", c.Path)
-	f, err := ini.LoadSources(ini.LoadOptions{
-		AllowNestedValues: true,
-		Insensitive:       true,
-	}, c.Path)
+	f, err := ini.LoadSources(configLoadOptions, b)
 	if err != nil {
-		return fmt.Errorf("Error parsing config file %q: %v", c.Path, err)
+		return &ConfigError{fmt.Errorf("Error parsing config file %q: %v", c.Path, err)}
 	}
 	c.iniFile = f
+	c.contents, c.sections = nil, nil
 	return nil
 }
 
+// ini returns the whole parsed config file, parsing it if only sections have been parsed so far
+func (c *ConfigFile) ini() *ini.File {
+	if c.iniFile == nil && c.sections != nil {
+		if err := c.parseContents(c.contents); err != nil {
+			log.Printf("%v", err)
+		}
+	}
+	return c.iniFile
+}
+
+// section returns the named section, only parsing the sections it needs if the whole file hasn't been parsed
+func (c *ConfigFile) section(sectionName string) (*ini.Section, error) {
+	if c.sections == nil {
+		if c.iniFile == nil {
+			return nil, errors.New("No iniFile to get the section from")
+		}
+		return c.iniFile.GetSection(sectionName)
+	}
+
+	f, err := ini.LoadSources(configLoadOptions, sectionContents(c.contents, c.sections, sectionName))
+	if err != nil {
+		return nil, &ConfigError{fmt.Errorf("Error parsing config file %q: %v", c.Path, err)}
+	}
+	return f.GetSection(sectionName)
+}
+
+// ConfigError is an error caused by the config file or a profile's settings
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
 // ProfileSection is a profile section of the config file
 type ProfileSection struct {
-	Name            string `ini:"-"`
-	MfaSerial       string `ini:"mfa_serial,omitempty"`
-	RoleARN         string `ini:"role_arn,omitempty"`
-	ExternalID      string `ini:"external_id,omitempty"`
-	Region          string `ini:"region,omitempty"`
-	RoleSessionName string `ini:"role_session_name,omitempty"`
-	DurationSeconds uint   `ini:"duration_seconds,omitempty"`
-	SourceProfile   string `ini:"source_profile,omitempty"`
-	ParentProfile   string `ini:"parent_profile,omitempty"`
+	Name           string `ini:"-"`
+	MfaSerial      string `ini:"mfa_serial,omitempty"`
+	MfaPrompt      string `ini:"mfa_prompt,omitempty"`
+	MfaTokenCmd    string `ini:"mfa_token_cmd,omitempty"`
+	NoCacheWithMfa bool   `ini:"no_cache_with_mfa,omitempty"`
+	VerifyMfa      bool   `ini:"verify_mfa_session,omitempty"`
+	AssumeRoleMfa  string `ini:"assume_role_mfa,omitempty"`
+
+	AllowExpiredGrace time.Duration `ini:"allow_expired_grace,omitempty"`
+	SessionCacheID    string        `ini:"session_cache_id,omitempty"`
+	GetSessionToken   string        `ini:"get_session_token,omitempty"`
+	ConsoleRegion     string        `ini:"console_region,omitempty"`
+	RoleARN           string        `ini:"role_arn,omitempty"`
+	RoleARNs          string        `ini:"role_arns,omitempty"`
+	ExternalID        string        `ini:"external_id,omitempty"`
+	Region            string        `ini:"region,omitempty"`
+	RoleSessionName   string        `ini:"role_session_name,omitempty"`
+	DurationSeconds   uint          `ini:"duration_seconds,omitempty"`
+	SourceProfile     string        `ini:"source_profile,omitempty"`
+	ParentProfile     string        `ini:"parent_profile,omitempty"`
+	IncludeProfile    string        `ini:"include_profile,omitempty"`
+	OnRefreshCmd      string        `ini:"on_refresh_cmd,omitempty"`
+	OnRotateCmd       string        `ini:"on_rotate_cmd,omitempty"`
+
+	StrictSourceProfile bool `ini:"strict_source_profile,omitempty"`
+
+	CredentialProcess string `ini:"credential_process,omitempty"`
+	FederationPolicy  string `ini:"federation_policy,omitempty"`
+
+	CredentialSource      string `ini:"credential_source,omitempty"`
+	Ec2MetadataEndpoint   string `ini:"ec2_metadata_service_endpoint,omitempty"`
+	Ec2MetadataTokenTTL   uint   `ini:"ec2_metadata_token_ttl,omitempty"`
+	Ec2MetadataV1Disabled bool   `ini:"ec2_metadata_v1_disabled,omitempty"`
+
+	SamlProviderARN   string `ini:"saml_provider_arn,omitempty"`
+	SamlAssertionCmd  string `ini:"saml_assertion_cmd,omitempty"`
+	SamlAssertionFile string `ini:"saml_assertion_file,omitempty"`
+
+	WebIdentityTokenFile string `ini:"web_identity_token_file,omitempty"`
+
+	HTTPDialTimeout         time.Duration `ini:"http_dial_timeout,omitempty"`
+	HTTPTLSHandshakeTimeout time.Duration `ini:"http_tls_handshake_timeout,omitempty"`
+	HTTPKeepAlive           time.Duration `ini:"http_keepalive,omitempty"`
+
+	SSOStartURL  string `ini:"sso_start_url,omitempty"`
+	SSORegion    string `ini:"sso_region,omitempty"`
+	SSOAccountID string `ini:"sso_account_id,omitempty"`
+	SSORoleName  string `ini:"sso_role_name,omitempty"`
+
+	// DurationSecondsAuto is set when duration_seconds=auto
+	DurationSecondsAuto bool `ini:"-"`
 }
 
 func (s ProfileSection) IsEmpty() bool {
@@ -143,7 +257,7 @@ func (s ProfileSection) IsEmpty() bool {
 func (c *ConfigFile) ProfileSections() []ProfileSection {
 	var result []ProfileSection
 
-	if c.iniFile == nil {
+	if c.ini() == nil {
 		return result
 	}
 
@@ -172,31 +286,55 @@ func (c *ConfigFile) ProfileSection(name string) (ProfileSection, bool) {
 	profile := ProfileSection{
 		Name: name,
 	}
-	if c.iniFile == nil {
-		return profile, false
-	}
 	// default profile name has a slightly different section format
 	sectionName := "profile " + name
 	if name == defaultSectionName {
 		sectionName = defaultSectionName
 	}
-	section, err := c.iniFile.GetSection(sectionName)
+	section, err := c.section(sectionName)
 	if err != nil {
 		return profile, false
 	}
 	if err = section.MapTo(&profile); err != nil {
 		panic(err)
 	}
+	// "auto" can't be mapped to duration_seconds, so it's checked separately
+	if key, err := section.GetKey("duration_seconds"); err == nil && key.String() == durationAuto {
+		profile.DurationSecondsAuto = true
+	}
 	return profile, true
 }
 
+// SetProfileKey sets a key in the profile's section, creating the section if needed. The
+// config file isn't saved
+func (c *ConfigFile) SetProfileKey(profileName, key, value string) error {
+	if c.ini() == nil {
+		return errors.New("No iniFile to set the key in")
+	}
+	sectionName := "profile " + profileName
+	if profileName == defaultSectionName {
+		sectionName = defaultSectionName
+	}
+	section, err := c.iniFile.GetSection(sectionName)
+	if err != nil {
+		if section, err = c.iniFile.NewSection(sectionName); err != nil {
+			return fmt.Errorf("Error creating section %q: %v", profileName, err)
+		}
+	}
+	section.Key(key).SetValue(value)
+	return nil
+}
+
 func (c *ConfigFile) Save() error {
+	if c.ini() == nil {
+		return errors.New("No iniFile to save")
+	}
 	return c.iniFile.SaveTo(c.Path)
 }
 
 // Add the profile to the configuration file
 func (c *ConfigFile) Add(profile ProfileSection) error {
-	if c.iniFile == nil {
+	if c.ini() == nil {
 		return errors.New("No iniFile to add to")
 	}
 	// default profile name has a slightly different section format
@@ -229,6 +367,10 @@ type ConfigLoader struct {
 	File            *ConfigFile
 	ActiveProfile   string
 	visitedProfiles []string
+
+	// includedProfiles is the chain of include_profile being loaded. It's separate from visitedProfiles,
+	// as several profiles in a source_profile chain can include the same profile
+	includedProfiles []string
 }
 
 func (cl *ConfigLoader) visitProfile(name string) bool {
@@ -271,40 +413,195 @@ func (cl *ConfigLoader) populateFromConfigFile(config *Config, profileName strin
 		log.Printf("Profile '%s' missing in config file", profileName)
 	}
 
+	if err := cl.populateFromSection(config, psection); err != nil {
+		return err
+	}
+
+	if psection.IncludeProfile != "" {
+		err := cl.populateFromIncludedProfile(config, psection.IncludeProfile)
+		if err != nil {
+			return err
+		}
+	}
+
+	if psection.ParentProfile != "" {
+		err := cl.populateFromConfigFile(config, psection.ParentProfile)
+		if err != nil {
+			return err
+		}
+	} else if profileName != defaultSectionName {
+		err := cl.populateFromConfigFile(config, defaultSectionName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// populateFromIncludedProfile merges the settings of an include_profile into config. Unlike
+// parent_profile, how credentials are sourced is never included
+func (cl *ConfigLoader) populateFromIncludedProfile(config *Config, profileName string) error {
+	for _, p := range cl.includedProfiles {
+		if p == profileName {
+			return fmt.Errorf("Loop detected in config file for profile '%s'", profileName)
+		}
+	}
+	cl.includedProfiles = append(cl.includedProfiles, profileName)
+	defer func() { cl.includedProfiles = cl.includedProfiles[:len(cl.includedProfiles)-1] }()
+
+	psection, ok := cl.File.ProfileSection(profileName)
+	if !ok {
+		return fmt.Errorf("Included profile '%s' missing in config file", profileName)
+	}
+
+	psection.SourceProfile = ""
+	psection.RoleARN = ""
+	psection.RoleARNs = ""
+	psection.ExternalID = ""
+	psection.CredentialProcess = ""
+	psection.CredentialSource = ""
+	psection.SamlProviderARN = ""
+	psection.WebIdentityTokenFile = ""
+	psection.SSOStartURL = ""
+	if err := cl.populateFromSection(config, psection); err != nil {
+		return err
+	}
+
+	if psection.IncludeProfile != "" {
+		return cl.populateFromIncludedProfile(config, psection.IncludeProfile)
+	}
+
+	return nil
+}
+
+func (cl *ConfigLoader) populateFromSection(config *Config, psection ProfileSection) error {
 	if config.MfaSerial == "" {
 		config.MfaSerial = psection.MfaSerial
 	}
+	if config.MfaPromptMethod == "" {
+		config.MfaPromptMethod = psection.MfaPrompt
+	}
+	if config.MfaTokenCmd == "" {
+		config.MfaTokenCmd = psection.MfaTokenCmd
+	}
+	if !config.NoCacheWithMfa {
+		config.NoCacheWithMfa = psection.NoCacheWithMfa
+	}
+	if !config.VerifyMfaSession {
+		config.VerifyMfaSession = psection.VerifyMfa
+	}
+	if config.AssumeRoleMfa == "" {
+		config.AssumeRoleMfa = psection.AssumeRoleMfa
+	}
+	if !config.StrictSourceProfile {
+		config.StrictSourceProfile = psection.StrictSourceProfile
+	}
+	if config.GetSessionToken == "" {
+		config.GetSessionToken = psection.GetSessionToken
+	}
+	if config.ConsoleRegion == "" {
+		config.ConsoleRegion = psection.ConsoleRegion
+	}
+	if config.AllowExpiredGrace == 0 {
+		config.AllowExpiredGrace = psection.AllowExpiredGrace
+	}
+	if config.HTTPDialTimeout == 0 {
+		config.HTTPDialTimeout = psection.HTTPDialTimeout
+	}
+	if config.HTTPTLSHandshakeTimeout == 0 {
+		config.HTTPTLSHandshakeTimeout = psection.HTTPTLSHandshakeTimeout
+	}
+	if config.HTTPKeepAlive == 0 {
+		config.HTTPKeepAlive = psection.HTTPKeepAlive
+	}
+	if config.SessionCacheID == "" {
+		config.SessionCacheID = psection.SessionCacheID
+	}
 	if config.RoleARN == "" {
 		config.RoleARN = psection.RoleARN
 	}
 	if config.ExternalID == "" {
 		config.ExternalID = psection.ExternalID
 	}
+	// role_arns would be ignored for a role_arn set in the same section, another section of the profile or AWS_ROLE_ARN
+	if psection.RoleARNs != "" && config.RoleARN != "" && !config.hasRoleARNs {
+		return fmt.Errorf("profile %s: role_arns in %s can't be used with role_arn %s, remove one of them", config.ProfileName, psection.Name, config.RoleARN)
+	}
+	if config.RoleARN == "" && psection.RoleARNs != "" {
+		var roleARNs []string
+		for _, roleARN := range strings.Split(psection.RoleARNs, ",") {
+			if roleARN = strings.TrimSpace(roleARN); roleARN != "" {
+				roleARNs = append(roleARNs, roleARN)
+			}
+		}
+		if len(roleARNs) > 0 {
+			config.RoleARN = roleARNs[len(roleARNs)-1]
+			config.ChainedRoleARNs = roleARNs[:len(roleARNs)-1]
+			config.hasRoleARNs = true
+		}
+	}
 	if config.Region == "" {
 		config.Region = psection.Region
 	}
 	if config.RoleSessionName == "" {
 		config.RoleSessionName = psection.RoleSessionName
 	}
-	if config.AssumeRoleDuration == 0 {
+	if config.AssumeRoleDuration == 0 && !config.AssumeRoleDurationAuto {
 		config.AssumeRoleDuration = time.Duration(psection.DurationSeconds) * time.Second
+		config.AssumeRoleDurationAuto = psection.DurationSecondsAuto
 	}
 	if config.SourceProfileName == "" {
 		config.SourceProfileName = psection.SourceProfile
 	}
-
-	if psection.ParentProfile != "" {
-		err := cl.populateFromConfigFile(config, psection.ParentProfile)
-		if err != nil {
-			return err
-		}
-	} else if profileName != defaultSectionName {
-		err := cl.populateFromConfigFile(config, defaultSectionName)
-		if err != nil {
-			return err
-		}
+	if config.OnRefreshCmd == "" {
+		config.OnRefreshCmd = psection.OnRefreshCmd
+	}
+	if config.OnRotateCmd == "" {
+		config.OnRotateCmd = psection.OnRotateCmd
+	}
+	if config.CredentialProcess == "" {
+		config.CredentialProcess = psection.CredentialProcess
+	}
+	if config.FederationPolicy == "" {
+		config.FederationPolicy = psection.FederationPolicy
+	}
+	if config.CredentialSource == "" {
+		config.CredentialSource = psection.CredentialSource
+	}
+	if config.Ec2MetadataEndpoint == "" {
+		config.Ec2MetadataEndpoint = psection.Ec2MetadataEndpoint
+	}
+	if config.Ec2MetadataTokenTTL == 0 {
+		config.Ec2MetadataTokenTTL = time.Duration(psection.Ec2MetadataTokenTTL) * time.Second
+	}
+	if !config.Ec2MetadataV1Disabled {
+		config.Ec2MetadataV1Disabled = psection.Ec2MetadataV1Disabled
+	}
+	if config.SamlProviderARN == "" {
+		config.SamlProviderARN = psection.SamlProviderARN
+	}
+	if config.SamlAssertionCmd == "" {
+		config.SamlAssertionCmd = psection.SamlAssertionCmd
+	}
+	if config.SamlAssertionFile == "" {
+		config.SamlAssertionFile = psection.SamlAssertionFile
+	}
+	if config.WebIdentityTokenFile == "" {
+		config.WebIdentityTokenFile = psection.WebIdentityTokenFile
+	}
+	if config.SSOStartURL == "" {
+		config.SSOStartURL = psection.SSOStartURL
+	}
+	if config.SSORegion == "" {
+		config.SSORegion = psection.SSORegion
+	}
+	if config.SSOAccountID == "" {
+		config.SSOAccountID = psection.SSOAccountID
+	}
+	if config.SSORoleName == "" {
+		config.SSORoleName = psection.SSORoleName
 	}
-
 	return nil
 }
 
@@ -326,9 +623,14 @@ func (cl *ConfigLoader) populateFromEnv(profile *Config) {
 
 	var err error
 	if assumeRoleTTL := os.Getenv("AWS_ASSUME_ROLE_TTL"); assumeRoleTTL != "" && profile.AssumeRoleDuration == 0 {
-		profile.AssumeRoleDuration, err = time.ParseDuration(assumeRoleTTL)
-		if err == nil {
-			log.Printf("Using duration_seconds %q from AWS_ASSUME_ROLE_TTL", profile.AssumeRoleDuration)
+		if assumeRoleTTL == durationAuto {
+			log.Printf("Using duration_seconds %q from AWS_ASSUME_ROLE_TTL", durationAuto)
+			profile.AssumeRoleDurationAuto = true
+		} else {
+			profile.AssumeRoleDuration, err = time.ParseDuration(assumeRoleTTL)
+			if err == nil {
+				log.Printf("Using duration_seconds %q from AWS_ASSUME_ROLE_TTL", profile.AssumeRoleDuration)
+			}
 		}
 	}
 
@@ -353,6 +655,33 @@ func (cl *ConfigLoader) populateFromEnv(profile *Config) {
 		}
 	}
 
+	if tokenCmd := os.Getenv("AWS_VAULT_MFA_TOKEN_CMD"); tokenCmd != "" && profile.MfaTokenCmd == "" {
+		log.Printf("Using mfa_token_cmd %q from AWS_VAULT_MFA_TOKEN_CMD", tokenCmd)
+		profile.MfaTokenCmd = tokenCmd
+	}
+
+	if cacheID := os.Getenv("AWS_VAULT_SESSION_CACHE_ID"); cacheID != "" && profile.SessionCacheID == "" {
+		log.Printf("Using session_cache_id %q from AWS_VAULT_SESSION_CACHE_ID", cacheID)
+		profile.SessionCacheID = cacheID
+	}
+
+	if cacheTTL := os.Getenv("AWS_CREDENTIAL_PROCESS_CACHE_TTL"); cacheTTL != "" && profile.CredentialProcessCacheTTL == 0 {
+		profile.CredentialProcessCacheTTL, err = time.ParseDuration(cacheTTL)
+		if err == nil {
+			log.Printf("Caching credential_process output without an Expiration for %q from AWS_CREDENTIAL_PROCESS_CACHE_TTL", profile.CredentialProcessCacheTTL)
+		}
+	}
+
+	if endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"); endpoint != "" && profile.Ec2MetadataEndpoint == "" {
+		log.Printf("Using ec2_metadata_service_endpoint %q from AWS_EC2_METADATA_SERVICE_ENDPOINT", endpoint)
+		profile.Ec2MetadataEndpoint = endpoint
+	}
+
+	if os.Getenv("AWS_EC2_METADATA_V1_DISABLED") == "true" {
+		log.Printf("Using ec2_metadata_v1_disabled from AWS_EC2_METADATA_V1_DISABLED")
+		profile.Ec2MetadataV1Disabled = true
+	}
+
 	// AWS_ROLE_ARN and AWS_ROLE_SESSION_NAME only apply to the target profile
 	if profile.ProfileName == cl.ActiveProfile {
 		if roleARN := os.Getenv("AWS_ROLE_ARN"); roleARN != "" && profile.RoleARN == "" {
@@ -388,7 +717,7 @@ func (cl *ConfigLoader) LoadFromProfile(profileName string) (*Config, error) {
 	cl.resetLoopDetection()
 	err := cl.populateFromConfigFile(&config, profileName)
 	if err != nil {
-		return nil, err
+		return nil, &ConfigError{err}
 	}
 
 	cl.populateFromDefaults(&config)
@@ -412,25 +741,75 @@ type Config struct {
 	// SourceProfile is the profile where credentials come from
 	SourceProfile *Config
 
+	// StrictSourceProfile is an error for a profile with both stored credentials and a source_profile,
+	// rather than ignoring the source_profile
+	StrictSourceProfile bool
+
 	// ChainedFromProfile is the profile that used this profile as it's source profile
 	ChainedFromProfile *Config
 
 	// Region is the AWS region
 	Region string
 
+	// ConsoleRegion is the region the console opens in with login, when it's different to Region
+	ConsoleRegion string
+
 	// Mfa config
 	MfaSerial       string
 	MfaToken        string
 	MfaPromptMethod string
 
+	// MfaTokenCmd is a command that outputs the current MFA token, run instead of prompting
+	MfaTokenCmd string
+
+	// NoCacheWithMfa stops sessions created with MFA from being cached in the keyring
+	NoCacheWithMfa bool
+
+	// VerifyMfaSession checks sessions created with MFA work with GetCallerIdentity before caching them
+	VerifyMfaSession bool
+
+	// AssumeRoleMfa is whether the AssumeRole call of this profile uses MFA, see AssumeRoleNeedsMfa
+	AssumeRoleMfa string
+
+	// GetSessionToken is when a profile without a role_arn uses GetSessionToken, one of the GetSessionToken* values
+	GetSessionToken string
+
+	// NoMfa skips MFA for every profile in the chain, for roles and sessions whose policies don't require it
+	NoMfa bool
+
+	// AllowExpiredGrace is how long an expired GetSessionToken session is used for when a new one
+	// can't be created because of a network error
+	AllowExpiredGrace time.Duration
+
+	// HTTPDialTimeout, HTTPTLSHandshakeTimeout and HTTPKeepAlive tune the HTTP client used for the
+	// AWS APIs aws-vault calls, see HTTPClient. They don't affect the command run by exec
+	HTTPDialTimeout         time.Duration
+	HTTPTLSHandshakeTimeout time.Duration
+	HTTPKeepAlive           time.Duration
+
+	// SessionCacheID separates the cached sessions of people sharing a profile and keyring, see SessionOwner
+	SessionCacheID string
+
 	// AssumeRole config
 	RoleARN         string
 	RoleSessionName string
 	ExternalID      string
 
+	// ChainedRoleARNs are assumed in order from the source credentials before RoleARN, when the
+	// profile lists its roles in role_arns rather than having a profile for each
+	ChainedRoleARNs []string
+	hasRoleARNs     bool
+
+	// NoRoleSessionCache stops the AssumeRole session of this profile being cached, such as when
+	// RoleSessionName is only for a single run
+	NoRoleSessionCache bool
+
 	// GetSessionTokenDuration specifies the wanted duration for credentials generated with AssumeRole
 	AssumeRoleDuration time.Duration
 
+	// AssumeRoleDurationAuto caps AssumeRoleDuration at the remaining lifetime of the source credentials
+	AssumeRoleDurationAuto bool
+
 	// GetSessionTokenDuration specifies the wanted duration for credentials generated with GetSessionToken
 	GetSessionTokenDuration time.Duration
 
@@ -439,6 +818,172 @@ type Config struct {
 
 	// GetFederationTokenDuration specifies the wanted duration for credentials generated with GetFederationToken
 	GetFederationTokenDuration time.Duration
+
+	// OnRefreshCmd is a command run when credentials are refreshed or an MFA token is prompted for
+	OnRefreshCmd string
+
+	// OnRotateCmd is a command run by rotate with the new access key, before the old one is deleted
+	OnRotateCmd string
+
+	// CredentialProcess is a command that outputs source credentials
+	CredentialProcess string
+
+	// CredentialProcessCacheTTL is how long to cache CredentialProcess output that has no Expiration
+	CredentialProcessCacheTTL time.Duration
+
+	// FederationPolicy scopes down GetFederationToken sessions, see FederationTokenProvider.Policy
+	FederationPolicy string
+
+	// CredentialSource is where credentials come from when there aren't any stored, e.g. Ec2InstanceMetadata
+	CredentialSource string
+
+	// Ec2MetadataEndpoint, Ec2MetadataTokenTTL and Ec2MetadataV1Disabled configure the instance metadata client
+	Ec2MetadataEndpoint   string
+	Ec2MetadataTokenTTL   time.Duration
+	Ec2MetadataV1Disabled bool
+
+	// SourceFD is a file descriptor to read the credentials for the root of the chain from, instead of the keyring
+	SourceFD int
+
+	// SamlProviderARN is the ARN of the SAML provider in IAM, used with AssumeRoleWithSAML
+	SamlProviderARN string
+
+	// SamlAssertionCmd is a command that outputs the base64 encoded SAML assertion
+	SamlAssertionCmd string
+
+	// SamlAssertionFile is a file containing the base64 encoded SAML assertion
+	SamlAssertionFile string
+
+	// WebIdentityTokenFile is a file containing an OIDC token, used with AssumeRoleWithWebIdentity
+	WebIdentityTokenFile string
+
+	// SSOStartURL is the AWS SSO user portal URL, and SSORegion the region of the SSO service
+	SSOStartURL string
+	SSORegion   string
+
+	// SSOAccountID and SSORoleName are the account and role to get credentials for with SSO. When
+	// either isn't set they are chosen with the DefaultSSOPicker
+	SSOAccountID string
+	SSORoleName  string
+}
+
+// ValidateDurations checks the session durations are within the limits of STS
+func (c *Config) ValidateDurations() error {
+	if c.AssumeRoleDuration != 0 && (c.AssumeRoleDuration < 15*time.Minute || c.AssumeRoleDuration > 12*time.Hour) {
+		return fmt.Errorf("AssumeRole duration %s must be between 15m and 12h", c.AssumeRoleDuration)
+	}
+	if c.GetSessionTokenDuration != 0 && (c.GetSessionTokenDuration < 15*time.Minute || c.GetSessionTokenDuration > 36*time.Hour) {
+		return fmt.Errorf("GetSessionToken duration %s must be between 15m and 36h", c.GetSessionTokenDuration)
+	}
+	if c.AllowExpiredGrace > MaxExpiredGrace {
+		return fmt.Errorf("allow_expired_grace %s can't be longer than %s", c.AllowExpiredGrace, MaxExpiredGrace)
+	}
+	return nil
+}
+
+// Validate checks the config for settings that can't work together, without calling AWS
+func (c *Config) Validate() error {
+	if c.RoleARN == "" {
+		if c.ExternalID != "" {
+			return errors.New("external_id is set without a role_arn")
+		}
+		if c.RoleSessionName != "" {
+			return errors.New("role_session_name is set without a role_arn")
+		}
+	}
+	if err := c.ValidateDurations(); err != nil {
+		return err
+	}
+	switch c.AssumeRoleMfa {
+	case "", AssumeRoleMfaChained, AssumeRoleMfaRequired, AssumeRoleMfaNone:
+	default:
+		return fmt.Errorf("assume_role_mfa %q isn't valid, it must be %s, %s or %s", c.AssumeRoleMfa, AssumeRoleMfaChained, AssumeRoleMfaRequired, AssumeRoleMfaNone)
+	}
+	if c.AssumeRoleMfa != "" && c.RoleARN == "" {
+		return errors.New("assume_role_mfa is set without a role_arn")
+	}
+	switch c.GetSessionToken {
+	case "", GetSessionTokenAuto, GetSessionTokenRoot, GetSessionTokenNever:
+	default:
+		return fmt.Errorf("get_session_token %q isn't valid, it must be %s, %s or %s", c.GetSessionToken, GetSessionTokenAuto, GetSessionTokenRoot, GetSessionTokenNever)
+	}
+	if c.MfaPromptMethod != "" {
+		if _, ok := prompt.Methods[c.MfaPromptMethod]; !ok {
+			return fmt.Errorf("mfa_prompt %q isn't available, supported methods are: %s", c.MfaPromptMethod, strings.Join(prompt.Available(), ", "))
+		}
+	}
+	if c.SourceProfileName != "" && c.CredentialProcess != "" {
+		return errors.New("source_profile and credential_process can't both be set")
+	}
+	if c.SourceProfileName != "" && c.CredentialSource != "" {
+		return errors.New("source_profile and credential_source can't both be set")
+	}
+	if c.SamlProviderARN != "" {
+		if c.RoleARN == "" {
+			return errors.New("saml_provider_arn is set without a role_arn")
+		}
+		if c.SamlAssertionCmd == "" && c.SamlAssertionFile == "" {
+			return errors.New("saml_provider_arn is set without a saml_assertion_cmd or saml_assertion_file")
+		}
+		if c.SourceProfileName != "" {
+			return errors.New("source_profile and saml_provider_arn can't both be set")
+		}
+	}
+	if c.WebIdentityTokenFile != "" {
+		if c.RoleARN == "" {
+			return errors.New("web_identity_token_file is set without a role_arn")
+		}
+		if c.SourceProfileName != "" {
+			return errors.New("source_profile and web_identity_token_file can't both be set")
+		}
+	}
+	if c.SSOStartURL != "" {
+		if c.SSORegion == "" {
+			return errors.New("sso_start_url is set without an sso_region")
+		}
+		if c.SourceProfileName != "" {
+			return errors.New("source_profile and sso_start_url can't both be set")
+		}
+	}
+	return nil
+}
+
+// HTTPClient returns an HTTP client with the profile's http_* settings, or nil for the default client
+func (c *Config) HTTPClient() *http.Client {
+	if c.HTTPDialTimeout == 0 && c.HTTPTLSHandshakeTimeout == 0 && c.HTTPKeepAlive == 0 {
+		return nil
+	}
+
+	// the same defaults as http.DefaultTransport
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	if c.HTTPDialTimeout != 0 {
+		dialer.Timeout = c.HTTPDialTimeout
+	}
+	if c.HTTPKeepAlive != 0 {
+		dialer.KeepAlive = c.HTTPKeepAlive
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	if c.HTTPTLSHandshakeTimeout != 0 {
+		transport.TLSHandshakeTimeout = c.HTTPTLSHandshakeTimeout
+	}
+	return &http.Client{Transport: transport}
+}
+
+// HasSSOStartURL returns true if credentials come from AWS SSO
+func (c *Config) HasSSOStartURL() bool {
+	return c.SSOStartURL != ""
+}
+
+// HasSamlProvider returns true if credentials come from AssumeRoleWithSAML
+func (c *Config) HasSamlProvider() bool {
+	return c.SamlProviderARN != ""
+}
+
+// HasWebIdentity returns true if credentials come from AssumeRoleWithWebIdentity
+func (c *Config) HasWebIdentity() bool {
+	return c.WebIdentityTokenFile != ""
 }
 
 func (c *Config) IsChained() bool {
@@ -458,3 +1003,58 @@ func (c *Config) MfaAlreadyUsedInSourceProfile() bool {
 		c.MfaSerial != "" &&
 		c.SourceProfile.MfaSerial == c.MfaSerial
 }
+
+// The values of get_session_token
+const (
+	// GetSessionTokenAuto uses GetSessionToken for a profile used directly, or in a chain when the profile
+	// chained from has the same MFA serial. It's the default
+	GetSessionTokenAuto = "auto"
+
+	// GetSessionTokenRoot uses GetSessionToken only at the root of a chain, the profile with its own
+	// credentials, whatever the MFA serials of the profiles chained from it
+	GetSessionTokenRoot = "root"
+
+	// GetSessionTokenNever doesn't use GetSessionToken for the profile
+	GetSessionTokenNever = "never"
+)
+
+// The values of assume_role_mfa
+const (
+	// AssumeRoleMfaChained uses MFA unless the source profile already used the same MFA serial. It's the default
+	AssumeRoleMfaChained = "chained"
+
+	// AssumeRoleMfaRequired always uses the MFA serial, even if the source profile used the same one
+	AssumeRoleMfaRequired = "required"
+
+	// AssumeRoleMfaNone never uses MFA, the MFA serial is only used to chain to the source profile
+	AssumeRoleMfaNone = "none"
+)
+
+// SessionCacheIDUser is the session_cache_id that separates sessions by OS username
+const SessionCacheIDUser = "user"
+
+// SessionOwner returns who the sessions of this profile are cached for, empty unless session_cache_id is set.
+// Sessions cached for someone else aren't used
+func (c *Config) SessionOwner() string {
+	if c.SessionCacheID != SessionCacheIDUser {
+		return c.SessionCacheID
+	}
+	u, err := user.Current()
+	if err != nil {
+		log.Printf("Can't look up the OS user for session_cache_id, using $USER: %v", err)
+		return "user:" + os.Getenv("USER")
+	}
+	return "user:" + u.Username
+}
+
+// AssumeRoleNeedsMfa returns true if the AssumeRole call of this profile is made with its MFA serial,
+// so each hop in a chain can need MFA independently
+func (c *Config) AssumeRoleNeedsMfa() bool {
+	switch c.AssumeRoleMfa {
+	case AssumeRoleMfaNone:
+		return false
+	case AssumeRoleMfaRequired:
+		return c.HasMfaSerial()
+	}
+	return c.HasMfaSerial() && !c.MfaAlreadyUsedInSourceProfile()
+}
@@ -4,9 +4,12 @@ import (
 	"bytes"
 	"fmt"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/99designs/aws-vault/vault"
 	"github.com/google/go-cmp/cmp"
@@ -62,7 +65,7 @@ output=json
 
 `)
 
-func newConfigFile(t *testing.T, b []byte) string {
+func newConfigFile(t testing.TB, b []byte) string {
 	f, err := ioutil.TempFile("", "aws-config")
 	if err != nil {
 		t.Fatal(err)
@@ -311,3 +314,301 @@ func TestIniWithoutHeaderSavesWithHeader(t *testing.T) {
 		t.Fatalf("Expected:\n%q\nGot:\n%q", expected, b)
 	}
 }
+
+func TestAssumeRoleDurationAuto(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile withauto]
+role_arn=arn:aws:iam::123456789012:role/admin
+duration_seconds=auto
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config, err := configLoader.LoadFromProfile("withauto")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+
+	if !config.AssumeRoleDurationAuto {
+		t.Fatalf("Expected AssumeRoleDurationAuto to be set")
+	}
+	if config.AssumeRoleDuration != vault.DefaultSessionDuration {
+		t.Fatalf("Expected AssumeRoleDuration %s, got %s", vault.DefaultSessionDuration, config.AssumeRoleDuration)
+	}
+}
+
+func TestIncludeProfile(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile base]
+region=eu-west-1
+mfa_serial=arn:aws:iam::123456789012:mfa/jonsmith
+source_profile=master
+role_arn=arn:aws:iam::123456789012:role/base
+
+[profile master]
+
+[profile withinclude]
+include_profile=base
+role_arn=arn:aws:iam::123456789012:role/admin
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config, err := configLoader.LoadFromProfile("withinclude")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+
+	if config.Region != "eu-west-1" {
+		t.Fatalf("Expected region %q, got %q", "eu-west-1", config.Region)
+	}
+	if config.MfaSerial != "arn:aws:iam::123456789012:mfa/jonsmith" {
+		t.Fatalf("Expected mfa_serial to be included, got %q", config.MfaSerial)
+	}
+	if config.RoleARN != "arn:aws:iam::123456789012:role/admin" {
+		t.Fatalf("Expected role_arn %q, got %q", "arn:aws:iam::123456789012:role/admin", config.RoleARN)
+	}
+	if config.SourceProfileName != "" {
+		t.Fatalf("Expected source_profile not to be included, got %q", config.SourceProfileName)
+	}
+}
+
+func TestProfilesCanIncludeTheSameProfile(t *testing.T) {
+	f := newConfigFile(t, []byte(`[default]
+include_profile=base
+
+[profile base]
+region=eu-west-1
+mfa_serial=arn:aws:iam::123456789012:mfa/jonsmith
+
+[profile master]
+include_profile=base
+
+[profile a]
+include_profile=base
+source_profile=master
+role_arn=arn:aws:iam::123456789012:role/admin
+
+[profile loop]
+include_profile=loop-other
+
+[profile loop-other]
+include_profile=loop
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config, err := configLoader.LoadFromProfile("a")
+	if err != nil {
+		t.Fatalf("Expected profiles including the same profile to load, got %v", err)
+	}
+	if config.Region != "eu-west-1" || config.SourceProfile == nil || config.SourceProfile.MfaSerial != "arn:aws:iam::123456789012:mfa/jonsmith" {
+		t.Fatalf("Expected the settings of base to be included, got %+v", config)
+	}
+
+	if _, err = configLoader.LoadFromProfile("loop"); err == nil || !strings.Contains(err.Error(), "Loop detected") {
+		t.Fatalf("Expected a loop of include_profile to be detected, got %v", err)
+	}
+}
+
+func TestAssumeRoleMfaAtEachHop(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile source]
+mfa_serial=arn:aws:iam::111111111111:mfa/alice
+
+[profile intermediate]
+source_profile=source
+role_arn=arn:aws:iam::222222222222:role/intermediate
+mfa_serial=arn:aws:iam::111111111111:mfa/alice
+
+[profile leaf]
+source_profile=intermediate
+role_arn=arn:aws:iam::333333333333:role/leaf
+mfa_serial=arn:aws:iam::333333333333:mfa/alice
+
+[profile leaf-same-device]
+source_profile=intermediate
+role_arn=arn:aws:iam::333333333333:role/leaf
+mfa_serial=arn:aws:iam::111111111111:mfa/alice
+assume_role_mfa=required
+
+[profile intermediate-without-mfa]
+source_profile=source
+role_arn=arn:aws:iam::222222222222:role/intermediate
+mfa_serial=arn:aws:iam::333333333333:mfa/alice
+assume_role_mfa=none
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		profile  string
+		expected []bool
+	}{
+		// the intermediate role uses the MFA session of source, then the leaf needs its own device
+		{"leaf", []bool{true, false}},
+		// the leaf needs MFA again even though it's the same device
+		{"leaf-same-device", []bool{true, false}},
+		{"intermediate-without-mfa", []bool{false}},
+	}
+	for _, tt := range tests {
+		configLoader := &vault.ConfigLoader{File: configFile, ActiveProfile: tt.profile}
+		config, err := configLoader.LoadFromProfile(tt.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = config.Validate(); err != nil {
+			t.Fatal(err)
+		}
+
+		for i, expected := range tt.expected {
+			if actual := config.AssumeRoleNeedsMfa(); actual != expected {
+				t.Errorf("profile %s: expected %s to need MFA %v, got %v", tt.profile, config.ProfileName, expected, actual)
+			}
+			if i < len(tt.expected)-1 {
+				config = config.SourceProfile
+			}
+		}
+	}
+}
+
+func TestHTTPClientSettings(t *testing.T) {
+	f := newConfigFile(t, []byte(`[default]
+http_tls_handshake_timeout=45s
+
+[profile satellite]
+http_dial_timeout=1m
+http_keepalive=15s
+
+[profile plain]
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config, err := configLoader.LoadFromProfile("satellite")
+	if err != nil {
+		t.Fatalf("Should have found a profile: %v", err)
+	}
+	if config.HTTPDialTimeout != time.Minute || config.HTTPKeepAlive != 15*time.Second {
+		t.Fatalf("Expected the profile's settings, got dial timeout %s and keepalive %s", config.HTTPDialTimeout, config.HTTPKeepAlive)
+	}
+
+	client := config.HTTPClient()
+	if client == nil {
+		t.Fatal("Expected an HTTP client")
+	}
+	if timeout := client.Transport.(*http.Transport).TLSHandshakeTimeout; timeout != 45*time.Second {
+		t.Fatalf("Expected the TLS handshake timeout from [default], got %s", timeout)
+	}
+
+	configLoader = &vault.ConfigLoader{File: &vault.ConfigFile{}}
+	config, err = configLoader.LoadFromProfile("plain")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.HTTPClient() != nil {
+		t.Fatal("Expected the default HTTP client without any http_* settings")
+	}
+}
+
+func TestProfileSectionIsTheSameWithoutParsingTheWholeFile(t *testing.T) {
+	f := newConfigFile(t, []byte(`region=us-west-1
+
+[profile Team]
+mfa_serial=arn:aws:iam::111111111111:mfa/david
+s3=
+  max_concurrent_requests=10
+
+[profile team.dev]
+role_arn=arn:aws:iam::222222222222:role/dev ; the dev account
+
+[default]
+output=json
+
+[profile team.dev]
+region=eu-west-1
+`))
+	defer os.Remove(f)
+
+	lazy, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed.ProfileNames()
+
+	for _, name := range []string{"default", "team", "team.dev", "missing"} {
+		lazySection, lazyOk := lazy.ProfileSection(name)
+		parsedSection, parsedOk := parsed.ProfileSection(name)
+		if diff := cmp.Diff(parsedSection, lazySection); diff != "" || lazyOk != parsedOk {
+			t.Errorf("ProfileSection(%q) differs when only parsing the sections it needs (-parsed +lazy):\n%s", name, diff)
+		}
+	}
+
+	dev, _ := lazy.ProfileSection("team.dev")
+	if dev.MfaSerial != "arn:aws:iam::111111111111:mfa/david" || dev.Region != "eu-west-1" {
+		t.Fatalf("Expected team.dev to inherit from team and merge both sections, got %#v", dev)
+	}
+}
+
+// manyProfilesConfig returns a config with n profiles, each assuming a role from the same source profile
+func manyProfilesConfig(n int) []byte {
+	var b bytes.Buffer
+	b.WriteString("[default]\nregion=us-east-1\n\n[profile source]\nmfa_serial=arn:aws:iam::111111111111:mfa/user\n")
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, "\n[profile role%d]\nsource_profile=source\nrole_arn=arn:aws:iam::%012d:role/admin\nregion=eu-west-1\n", i, i)
+	}
+	return b.Bytes()
+}
+
+func benchmarkLoadFromProfile(b *testing.B, parseAll bool) {
+	f := newConfigFile(b, manyProfilesConfig(500))
+	defer os.Remove(f)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		configFile, err := vault.LoadConfig(f)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if parseAll {
+			configFile.ProfileNames()
+		}
+		configLoader := &vault.ConfigLoader{File: configFile}
+		if _, err = configLoader.LoadFromProfile("role250"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkLoadFromProfile(b *testing.B) {
+	benchmarkLoadFromProfile(b, false)
+}
+
+func BenchmarkLoadFromProfileParsingAllProfiles(b *testing.B) {
+	benchmarkLoadFromProfile(b, true)
+}
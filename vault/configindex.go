@@ -0,0 +1,79 @@
+package vault
+
+import (
+	"bytes"
+	"strings"
+)
+
+// sectionSpan is the byte range of a section in the config file, including its header
+type sectionSpan struct {
+	start, end int
+}
+
+// indexConfigSections finds where each section of the config file starts and ends, so that a
+// profile can be parsed without parsing every other profile. Section names are lower cased, as
+// the file is parsed case insensitively, and anything before the first section is part of the
+// default section. It returns false for anything it can't be sure splits the same way the ini
+// parser would, such as multi-line values, and the whole file should be parsed instead
+func indexConfigSections(b []byte) (map[string][]sectionSpan, bool) {
+	sections := map[string][]sectionSpan{}
+	name, start := defaultSectionName, 0
+
+	for pos := 0; pos < len(b); {
+		end := bytes.IndexByte(b[pos:], '\n') + pos + 1
+		if end == pos {
+			end = len(b)
+		}
+		line := bytes.TrimSpace(b[pos:end])
+		indented := len(line) > 0 && (b[pos] == ' ' || b[pos] == '\t')
+
+		switch {
+		case len(line) == 0 || line[0] == '#' || line[0] == ';':
+		case line[0] == '[':
+			closeIdx := bytes.LastIndexByte(line, ']')
+			if indented || closeIdx == -1 {
+				return nil, false
+			}
+			sections[name] = append(sections[name], sectionSpan{start, pos})
+			name, start = strings.ToLower(string(line[1:closeIdx])), pos
+		// anything else is a key, or a nested value of one, which needs to fit on a single line
+		case bytes.IndexAny(line, "=:") == -1,
+			bytes.Contains(line, []byte(`"""`)),
+			bytes.IndexByte(line, '`') != -1,
+			line[len(line)-1] == '\\':
+			return nil, false
+		}
+		pos = end
+	}
+	sections[name] = append(sections[name], sectionSpan{start, len(b)})
+
+	return sections, true
+}
+
+// sectionContents returns the parts of the config file needed to parse the section: the section
+// itself, and the sections it is a child of, which the ini parser falls back to for missing keys
+func sectionContents(b []byte, sections map[string][]sectionSpan, sectionName string) []byte {
+	names := []string{defaultSectionName}
+	for name := strings.ToLower(sectionName); name != ""; {
+		names = append(names, name)
+		if i := strings.LastIndex(name, "."); i > -1 {
+			name = name[:i]
+		} else {
+			name = ""
+		}
+	}
+
+	var contents []byte
+	seen := map[string]bool{}
+	for _, name := range names {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		for _, span := range sections[name] {
+			contents = append(contents, b[span.start:span.end]...)
+			contents = append(contents, '\n')
+		}
+	}
+	return contents
+}
@@ -0,0 +1,169 @@
+package vault
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// knownConfigKeys are keys used by the AWS CLI and SDKs that aws-vault ignores
+var knownConfigKeys = []string{
+	"aws_access_key_id",
+	"aws_secret_access_key",
+	"aws_session_token",
+	"output",
+	"ca_bundle",
+	"parameter_validation",
+	"max_attempts",
+	"retry_mode",
+	"sts_regional_endpoints",
+	"tcp_keepalive",
+	"metadata_service_timeout",
+	"metadata_service_num_attempts",
+	"endpoint_url",
+	"api_versions",
+	"s3",
+	"cli_pager",
+	"cli_history",
+	"cli_auto_prompt",
+	"cli_binary_format",
+	"cli_follow_urlparam",
+	"cli_timestamp_format",
+}
+
+// ConfigProblem is a problem found in a profile of the config file
+type ConfigProblem struct {
+	ProfileName string
+	Message     string
+}
+
+func (p ConfigProblem) String() string {
+	return fmt.Sprintf("profile %s: %s", p.ProfileName, p.Message)
+}
+
+// Lint checks every profile in the config file for dangling references, unknown keys,
+// cyclical chains and invalid settings. No calls are made to AWS
+func (c *ConfigFile) Lint() []ConfigProblem {
+	var problems []ConfigProblem
+	addProblem := func(profileName, format string, a ...interface{}) {
+		problems = append(problems, ConfigProblem{ProfileName: profileName, Message: fmt.Sprintf(format, a...)})
+	}
+
+	knownKeys := profileSectionKeys()
+	for _, key := range knownConfigKeys {
+		knownKeys[key] = true
+	}
+
+	for _, profile := range c.ProfileSections() {
+		broken := false
+
+		for _, key := range c.sectionKeys(profile.Name) {
+			if !knownKeys[key] {
+				addProblem(profile.Name, "unknown key %q", key)
+			}
+		}
+
+		references := []struct {
+			Key  string
+			Name string
+		}{
+			{"source_profile", profile.SourceProfile},
+			{"include_profile", profile.IncludeProfile},
+			{"parent_profile", profile.ParentProfile},
+		}
+		for _, ref := range references {
+			if ref.Name == "" {
+				continue
+			}
+			if _, ok := c.ProfileSection(ref.Name); !ok {
+				addProblem(profile.Name, "%s '%s' doesn't exist", ref.Key, ref.Name)
+				broken = true
+			}
+		}
+
+		if profile.RoleARN != "" && profile.RoleARNs != "" {
+			addProblem(profile.Name, "role_arn and role_arns can't both be set")
+		}
+
+		if chain, ok := c.findCycle(profile.Name); ok {
+			addProblem(profile.Name, "cyclical chain %s", strings.Join(chain, " -> "))
+			broken = true
+		}
+
+		// loading a profile with a broken chain would fail or never finish
+		if broken {
+			continue
+		}
+
+		loader := &ConfigLoader{File: c, ActiveProfile: profile.Name}
+		config, err := loader.LoadFromProfile(profile.Name)
+		if err != nil {
+			addProblem(profile.Name, "%v", err)
+			continue
+		}
+		if err = config.Validate(); err != nil {
+			addProblem(profile.Name, "%v", err)
+		}
+	}
+
+	return problems
+}
+
+// findCycle follows the source_profile, include_profile and parent_profile references from
+// profileName, returning the chain if it leads back to a profile already visited
+func (c *ConfigFile) findCycle(profileName string) ([]string, bool) {
+	var visit func(name string, chain []string) ([]string, bool)
+	visit = func(name string, chain []string) ([]string, bool) {
+		for _, visited := range chain {
+			if visited == name {
+				return append(chain, name), true
+			}
+		}
+		chain = append(chain, name)
+
+		profile, ok := c.ProfileSection(name)
+		if !ok {
+			return nil, false
+		}
+		for _, next := range []string{profile.SourceProfile, profile.IncludeProfile, profile.ParentProfile} {
+			if next == "" {
+				continue
+			}
+			if cycle, ok := visit(next, chain[:len(chain):len(chain)]); ok {
+				return cycle, true
+			}
+		}
+		return nil, false
+	}
+
+	return visit(profileName, nil)
+}
+
+// sectionKeys returns the keys set in the profile's section, sorted
+func (c *ConfigFile) sectionKeys(profileName string) []string {
+	sectionName := "profile " + profileName
+	if profileName == defaultSectionName {
+		sectionName = defaultSectionName
+	}
+	section, err := c.section(sectionName)
+	if err != nil {
+		return nil
+	}
+	keys := section.KeyStrings()
+	sort.Strings(keys)
+	return keys
+}
+
+// profileSectionKeys returns the config keys that map to ProfileSection fields
+func profileSectionKeys() map[string]bool {
+	keys := map[string]bool{}
+	t := reflect.TypeOf(ProfileSection{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("ini"), ",")[0]
+		if name != "" && name != "-" {
+			keys[name] = true
+		}
+	}
+	return keys
+}
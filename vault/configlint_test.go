@@ -0,0 +1,58 @@
+package vault_test
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+func TestConfigLint(t *testing.T) {
+	f := newConfigFile(t, []byte(`[default]
+region=us-west-2
+output=json
+
+[profile ok]
+source_profile=default
+role_arn=arn:aws:iam::123456789012:role/admin
+
+[profile dangling]
+source_profile=missing
+
+[profile typo]
+role_arn=arn:aws:iam::123456789012:role/admin
+mfa_seral=arn:aws:iam::123456789012:mfa/jonsmith
+
+[profile loop1]
+source_profile=loop2
+
+[profile loop2]
+source_profile=loop1
+
+[profile invalid]
+external_id=123
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var problems []string
+	for _, p := range configFile.Lint() {
+		problems = append(problems, p.String())
+	}
+
+	expected := []string{
+		"profile dangling: source_profile 'missing' doesn't exist",
+		`profile typo: unknown key "mfa_seral"`,
+		"profile loop1: cyclical chain loop1 -> loop2 -> loop1",
+		"profile loop2: cyclical chain loop2 -> loop1 -> loop2",
+		"profile invalid: external_id is set without a role_arn",
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected problems %#v, got %#v", expected, problems)
+	}
+}
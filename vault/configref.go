@@ -0,0 +1,120 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+)
+
+const (
+	secretsManagerRefPrefix = "secretsmanager://"
+	ssmRefPrefix            = "ssm://"
+)
+
+var resolvedConfigRefs = struct {
+	sync.Mutex
+	values map[string]string
+}{values: map[string]string{}}
+
+// isConfigRef returns whether a config value references a secret
+func isConfigRef(value string) bool {
+	return strings.HasPrefix(value, secretsManagerRefPrefix) || strings.HasPrefix(value, ssmRefPrefix)
+}
+
+// ResolveConfigRef resolves a config value that references a secret in Secrets Manager
+// (secretsmanager://name/key) or a parameter in SSM (ssm://name) using the given credentials.
+// Values that aren't references are returned unchanged, resolved values are cached for the
+// lifetime of the process
+func ResolveConfigRef(value string, sess *session.Session) (string, error) {
+	if !isConfigRef(value) {
+		return value, nil
+	}
+
+	resolvedConfigRefs.Lock()
+	defer resolvedConfigRefs.Unlock()
+
+	if resolved, ok := resolvedConfigRefs.values[value]; ok {
+		return resolved, nil
+	}
+
+	var resolved string
+	var err error
+	if strings.HasPrefix(value, ssmRefPrefix) {
+		resp, err := ssm.New(sess).GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(strings.TrimPrefix(value, ssmRefPrefix)),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("Failed to resolve %s: %w", value, err)
+		}
+		resolved = aws.StringValue(resp.Parameter.Value)
+	} else {
+		resolved, err = getSecretValue(secretsmanager.New(sess), strings.TrimPrefix(value, secretsManagerRefPrefix))
+		if err != nil {
+			return "", fmt.Errorf("Failed to resolve %s: %w", value, err)
+		}
+	}
+
+	log.Printf("Resolved %s to %q", value, resolved)
+	resolvedConfigRefs.values[value] = resolved
+
+	return resolved, nil
+}
+
+// roleARNResolver returns a resolver for a role_arn that references a secret, or nil if it doesn't
+func roleARNResolver(value string, sess *session.Session) func() (string, error) {
+	if !isConfigRef(value) {
+		return nil
+	}
+	return func() (string, error) {
+		return ResolveConfigRef(value, sess)
+	}
+}
+
+// getSecretValue returns the secret string for "name", or a single key of a JSON secret for "name/key".
+// Secret names and ARNs can contain slashes too, so when there's no secret with the name before the
+// last slash, the whole ref is tried as the name of the secret
+func getSecretValue(client *secretsmanager.SecretsManager, ref string) (string, error) {
+	name, key := ref, ""
+	if i := strings.LastIndex(ref, "/"); i >= 0 {
+		name, key = ref[:i], ref[i+1:]
+	}
+
+	resp, err := client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(name),
+	})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == secretsmanager.ErrCodeResourceNotFoundException && key != "" {
+		log.Printf("No secret named %s, trying %s", name, ref)
+		name, key = ref, ""
+		resp, err = client.GetSecretValue(&secretsmanager.GetSecretValueInput{
+			SecretId: aws.String(name),
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if key == "" {
+		return aws.StringValue(resp.SecretString), nil
+	}
+
+	var values map[string]string
+	if err = json.Unmarshal([]byte(aws.StringValue(resp.SecretString)), &values); err != nil {
+		return "", fmt.Errorf("Secret %s isn't a JSON object: %v", name, err)
+	}
+
+	v, ok := values[key]
+	if !ok {
+		return "", fmt.Errorf("Secret %s has no key %q", name, key)
+	}
+
+	return v, nil
+}
@@ -0,0 +1,122 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// newFakeSecretsManagerSession returns a session for a Secrets Manager that has the secrets, and
+// denies access to any secret named denied
+func newFakeSecretsManagerSession(t *testing.T, secrets map[string]string) (*session.Session, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if target := r.Header.Get("X-Amz-Target"); target != "secretsmanager.GetSecretValue" {
+			t.Fatalf("Unexpected target %q", target)
+		}
+		var input struct{ SecretId string }
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			t.Fatal(err)
+		}
+
+		w.Header().Set("Content-Type", "application/x-amz-json-1.1")
+		secret, ok := secrets[input.SecretId]
+		switch {
+		case input.SecretId == "denied":
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"AccessDeniedException","message":"not authorized to perform secretsmanager:GetSecretValue"}`)
+		case !ok:
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"__type":"ResourceNotFoundException","message":"Secrets Manager can't find the specified secret."}`)
+		default:
+			_ = json.NewEncoder(w).Encode(map[string]string{"Name": input.SecretId, "SecretString": secret})
+		}
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+	return sess, ts.Close
+}
+
+func TestResolveConfigRefWithSlashes(t *testing.T) {
+	const secretARN = "arn:aws:secretsmanager:us-east-1:123456789012:secret:team/roles-AbCdEf"
+	sess, closeServer := newFakeSecretsManagerSession(t, map[string]string{
+		"team/roles": `{"role_arn":"arn:aws:iam::123456789012:role/path/admin"}`,
+		secretARN:    `{"role_arn":"arn:aws:iam::123456789012:role/path/from-arn"}`,
+		"team/plain": "arn:aws:iam::123456789012:role/path/plain",
+	})
+	defer closeServer()
+
+	var testCases = []struct {
+		ref      string
+		resolved string
+	}{
+		{"secretsmanager://team/roles/role_arn", "arn:aws:iam::123456789012:role/path/admin"},
+		{"secretsmanager://" + secretARN + "/role_arn", "arn:aws:iam::123456789012:role/path/from-arn"},
+		{"secretsmanager://team/plain", "arn:aws:iam::123456789012:role/path/plain"},
+	}
+	for _, tc := range testCases {
+		resolved, err := vault.ResolveConfigRef(tc.ref, sess)
+		if err != nil {
+			t.Fatalf("Resolving %s: %v", tc.ref, err)
+		}
+		if resolved != tc.resolved {
+			t.Fatalf("Expected %s to resolve to %q, got %q", tc.ref, tc.resolved, resolved)
+		}
+	}
+
+	_, err := vault.ResolveConfigRef("secretsmanager://denied", sess)
+	if err == nil || !strings.Contains(err.Error(), "Failed to resolve secretsmanager://denied") || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Fatalf("Expected a clear error when access is denied, got %v", err)
+	}
+}
+
+func TestRoleARNIsOnlyResolvedForNewSessions(t *testing.T) {
+	const ref = "secretsmanager://team/cached/role_arn"
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	sessions := k.Sessions()
+	err := sessions.Store("llamas", "role_arn:"+ref, "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIACACHED"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &vault.CachedAssumeRoleProvider{
+		CredentialsName: "llamas",
+		Region:          "us-east-1",
+		Keyring:         k,
+		Provider: &vault.AssumeRoleProvider{
+			RoleARN: ref,
+			RoleARNResolver: func() (string, error) {
+				t.Fatal("Expected the role_arn not to be resolved for a cached session")
+				return "", nil
+			},
+		},
+	}
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIACACHED" {
+		t.Fatalf("Expected the cached session, got %q", val.AccessKeyID)
+	}
+}
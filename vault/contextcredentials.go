@@ -0,0 +1,109 @@
+package vault
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+// ContextProvider is a credentials.Provider that stops waiting for an MFA token or STS when a context is done
+type ContextProvider interface {
+	credentials.Provider
+	RetrieveWithContext(ctx context.Context) (credentials.Value, error)
+}
+
+// ContextCredentials are credentials.Credentials that can pass a context on to their provider, which
+// credentials.Credentials has no way to do
+type ContextCredentials struct {
+	*credentials.Credentials
+	provider *contextProvider
+	mu       sync.Mutex
+}
+
+// NewContextCredentials returns credentials for p, which is retrieved with the context passed to
+// GetWithContext if it's a ContextProvider
+func NewContextCredentials(p credentials.Provider) *ContextCredentials {
+	cp := &contextProvider{Provider: p}
+	var provider credentials.Provider = cp
+	// credentials.Credentials only reports an expiry for providers that have one
+	if _, ok := p.(credentials.Expirer); ok {
+		provider = contextExpirer{cp}
+	}
+	return &ContextCredentials{Credentials: credentials.NewCredentials(provider), provider: cp}
+}
+
+// GetWithContext is Get, but stops waiting for an MFA token or STS when ctx is done
+func (c *ContextCredentials) GetWithContext(ctx context.Context) (credentials.Value, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.provider.setContext(ctx)
+	defer c.provider.setContext(nil)
+
+	return c.Get()
+}
+
+// signWithContext makes the requests of sess retrieve c with the context of the request before
+// they're signed, so waiting for the source credentials of a chain is cancelled along with the request
+func (c *ContextCredentials) signWithContext(sess *session.Session) {
+	sess.Handlers.Sign.PushFront(func(r *request.Request) {
+		if _, err := c.GetWithContext(r.Context()); err != nil {
+			r.Error = err
+		}
+	})
+	// otherwise the signer retrieves the credentials again, without the context
+	sess.Handlers.Sign.AfterEachFn = request.HandlerListStopOnError
+}
+
+// contextProvider retrieves its provider with the context set by ContextCredentials.GetWithContext
+type contextProvider struct {
+	credentials.Provider
+	mu  sync.Mutex
+	ctx context.Context
+}
+
+func (p *contextProvider) setContext(ctx context.Context) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ctx = ctx
+}
+
+func (p *contextProvider) Retrieve() (credentials.Value, error) {
+	p.mu.Lock()
+	ctx := p.ctx
+	p.mu.Unlock()
+
+	if cp, ok := p.Provider.(ContextProvider); ok && ctx != nil {
+		return cp.RetrieveWithContext(ctx)
+	}
+	return p.Provider.Retrieve()
+}
+
+// contextExpirer is a contextProvider for a provider that's a credentials.Expirer
+type contextExpirer struct {
+	*contextProvider
+}
+
+func (p contextExpirer) ExpiresAt() time.Time {
+	return p.Provider.(credentials.Expirer).ExpiresAt()
+}
+
+// credentialsProvider is a provider for credentials.Credentials, so they can be used where
+// ContextCredentials are needed. They're retrieved without the context
+type credentialsProvider struct {
+	*credentials.Credentials
+}
+
+func (p credentialsProvider) Retrieve() (credentials.Value, error) {
+	return p.Get()
+}
+
+// ExpiresAt returns the zero time for credentials that don't expire
+func (p credentialsProvider) ExpiresAt() time.Time {
+	expiresAt, _ := p.Credentials.ExpiresAt()
+	return expiresAt
+}
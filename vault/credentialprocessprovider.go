@@ -0,0 +1,150 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// credentialProcessSessionPrefix is prepended to the command to form the MFA serial part of
+// the session key that credential_process output is cached under
+const credentialProcessSessionPrefix = "credential_process:"
+
+// credentialProcessOutput is the JSON a credential_process command writes to stdout
+// See https://docs.aws.amazon.com/cli/latest/topic/config-vars.html#sourcing-credentials-from-external-processes
+type credentialProcessOutput struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      *time.Time
+}
+
+// CredentialProcessProvider retrieves credentials by running a credential_process command, caching
+// the output in the keyring until it expires
+type CredentialProcessProvider struct {
+	Keyring         *CredentialKeyring
+	CredentialsName string
+	Command         string
+
+	// CacheTTL is how long to cache output that has no Expiration, zero means it isn't cached
+	CacheTTL     time.Duration
+	ExpiryWindow time.Duration
+
+	expiration time.Time
+}
+
+// IsExpired returns true when the credentials returned by the command have expired
+func (p *CredentialProcessProvider) IsExpired() bool {
+	return !p.expiration.IsZero() && time.Now().Add(p.ExpiryWindow).After(p.expiration)
+}
+
+// ExpiresAt returns when the credentials expire, or the zero time if they don't
+func (p *CredentialProcessProvider) ExpiresAt() time.Time {
+	return p.expiration
+}
+
+// Retrieve returns cached credentials from the keyring, or if none are cached runs the command
+func (p *CredentialProcessProvider) Retrieve() (credentials.Value, error) {
+	sessions := p.Keyring.Sessions()
+	cacheKey := credentialProcessSessionPrefix + p.Command
+
+	if Refresh {
+		log.Printf("Refreshing cached credentials for %s", p.CredentialsName)
+		if _, err := sessions.Delete(p.CredentialsName); err != nil {
+			return credentials.Value{}, err
+		}
+	} else if session, err := sessions.Retrieve(p.CredentialsName, cacheKey, ""); err == nil && time.Now().Add(p.ExpiryWindow).Before(*session.Expiration) {
+		log.Printf("Re-using cached credentials %s from credential_process, expires in %s", FormatKeyForDisplay(*session.AccessKeyId), time.Until(*session.Expiration).String())
+		p.expiration = *session.Expiration
+		return credentials.Value{
+			AccessKeyID:     *session.AccessKeyId,
+			SecretAccessKey: *session.SecretAccessKey,
+			SessionToken:    *session.SessionToken,
+		}, nil
+	}
+
+	if CacheOnly {
+		return credentials.Value{}, fmt.Errorf("profile %s: %w", p.CredentialsName, ErrNoCachedCredentials)
+	}
+
+	output, err := p.run()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	p.expiration = time.Time{}
+	if output.Expiration != nil {
+		p.expiration = *output.Expiration
+	} else if p.CacheTTL > 0 {
+		log.Printf("credential_process returned no Expiration, caching for %s", p.CacheTTL)
+		p.expiration = time.Now().Add(p.CacheTTL)
+	}
+
+	if !p.expiration.IsZero() {
+		err = sessions.Store(p.CredentialsName, cacheKey, "", &sts.Credentials{
+			AccessKeyId:     aws.String(output.AccessKeyID),
+			SecretAccessKey: aws.String(output.SecretAccessKey),
+			SessionToken:    aws.String(output.SessionToken),
+			Expiration:      aws.Time(p.expiration),
+		})
+		if err != nil {
+			return credentials.Value{}, err
+		}
+	}
+
+	return credentials.Value{
+		AccessKeyID:     output.AccessKeyID,
+		SecretAccessKey: output.SecretAccessKey,
+		SessionToken:    output.SessionToken,
+	}, nil
+}
+
+func (p *CredentialProcessProvider) run() (*credentialProcessOutput, error) {
+	cmd := shellCommand(p.Command)
+
+	// prevents an aws-vault credential_process from running credential_process itself
+	cmd.Env = append(os.Environ(), "AWS_VAULT_CREDENTIAL_PROCESS=1")
+	cmd.Stderr = os.Stderr
+	cmd.Stdin = os.Stdin
+
+	var stdout bytes.Buffer
+	cmd.Stdout = &stdout
+
+	log.Printf("Running credential_process for %s", p.CredentialsName)
+	defer traceStep("credential_process %s", p.CredentialsName)()
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("credential_process for %s failed: %w", p.CredentialsName, err)
+	}
+
+	return parseCredentialProcessOutput(stdout.Bytes(), "credential_process for "+p.CredentialsName)
+}
+
+// parseCredentialProcessOutput parses credential_process JSON, with source describing where it came from
+func parseCredentialProcessOutput(b []byte, source string) (*credentialProcessOutput, error) {
+	var output credentialProcessOutput
+	if err := json.Unmarshal(bytes.TrimSpace(b), &output); err != nil {
+		return nil, fmt.Errorf("Error parsing output of %s: %w", source, err)
+	}
+	if output.Version != 1 {
+		return nil, fmt.Errorf("%s returned unsupported Version %d", source, output.Version)
+	}
+	if output.AccessKeyID == "" || output.SecretAccessKey == "" {
+		return nil, fmt.Errorf("%s returned no credentials", source)
+	}
+
+	return &output, nil
+}
+
+// IsCredentialProcess returns true if the session caches credential_process output
+func (ks KeyringSession) IsCredentialProcess() bool {
+	return strings.HasPrefix(ks.MfaSerial, credentialProcessSessionPrefix)
+}
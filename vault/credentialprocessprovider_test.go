@@ -0,0 +1,93 @@
+package vault_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestCredentialProcessProviderCachesUntilExpiration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell command")
+	}
+
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	counter := filepath.Join(dir, "runs")
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	command := fmt.Sprintf(`echo run >> %s; echo '{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","SessionToken":"token","Expiration":"%s"}'`, counter, expiration)
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	for i := 0; i < 2; i++ {
+		p := &vault.CredentialProcessProvider{Keyring: k, CredentialsName: "llamas", Command: command}
+		val, err := p.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.AccessKeyID != "ASIAEXAMPLE" || val.SessionToken != "token" {
+			t.Fatalf("Unexpected credentials %#v", val)
+		}
+	}
+
+	runs, err := ioutil.ReadFile(counter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(runs), "run"); n != 1 {
+		t.Fatalf("Expected credential_process to run once, ran %d times", n)
+	}
+}
+
+func TestCredentialProcessProviderRefreshIgnoresCache(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell command")
+	}
+
+	vault.Refresh = true
+	defer func() { vault.Refresh = false }()
+
+	expiration := time.Now().Add(time.Hour).UTC().Format(time.RFC3339)
+	command := fmt.Sprintf(`echo '{"Version":1,"AccessKeyId":"ASIANEW","SecretAccessKey":"secret","SessionToken":"token","Expiration":"%s"}'`, expiration)
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err := k.Sessions().Store("llamas", "credential_process:"+command, "", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAOLD"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(2 * time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &vault.CredentialProcessProvider{Keyring: k, CredentialsName: "llamas", Command: command}
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIANEW" {
+		t.Fatalf("Expected the cached credentials to be ignored, got %s", val.AccessKeyID)
+	}
+
+	sessions, err := k.Sessions().Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected the cache to be replaced, got %d sessions", len(sessions))
+	}
+}
@@ -0,0 +1,130 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/mitchellh/go-homedir"
+	ini "gopkg.in/ini.v1"
+)
+
+// CredentialsFile is an abstraction over what is in ~/.aws/credentials
+type CredentialsFile struct {
+	Path    string
+	iniFile *ini.File
+}
+
+// CredentialsFilePath returns either $AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials
+func CredentialsFilePath() (string, error) {
+	file := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if file == "" {
+		home, err := homedir.Dir()
+		if err != nil {
+			return "", err
+		}
+		file = filepath.Join(home, "/.aws/credentials")
+	} else {
+		log.Printf("Using AWS_SHARED_CREDENTIALS_FILE value: %s", file)
+	}
+	return file, nil
+}
+
+// LoadCredentialsFile loads and parses a credentials file. No error is returned if the file doesn't exist
+func LoadCredentialsFile(path string) (*CredentialsFile, error) {
+	c := &CredentialsFile{
+		Path:    path,
+		iniFile: ini.Empty(),
+	}
+	if _, err := os.Stat(path); err != nil {
+		log.Printf("Credentials file %s doesn't exist", path)
+		return c, nil
+	}
+
+	log.Printf("Parsing credentials file %s", path)
+	// profile names are case sensitive, so the sections are too
+	f, err := ini.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing credentials file %q: %v", path, err)
+	}
+	c.iniFile = f
+	return c, nil
+}
+
+// ProfileNames returns the names of the profiles in the credentials file
+func (c *CredentialsFile) ProfileNames() []string {
+	var profileNames []string
+	for _, section := range c.iniFile.Sections() {
+		if section.Name() != ini.DefaultSection || len(section.Keys()) > 0 {
+			profileNames = append(profileNames, section.Name())
+		}
+	}
+	return profileNames
+}
+
+// Credentials returns the credentials for the profile, and false if there are none
+func (c *CredentialsFile) Credentials(profileName string) (credentials.Value, bool) {
+	section, err := c.iniFile.GetSection(profileName)
+	if err != nil {
+		return credentials.Value{}, false
+	}
+	// section.Key would add missing keys, which are then saved
+	value := func(name string) string {
+		if key, err := section.GetKey(name); err == nil {
+			return key.String()
+		}
+		return ""
+	}
+	val := credentials.Value{
+		AccessKeyID:     value("aws_access_key_id"),
+		SecretAccessKey: value("aws_secret_access_key"),
+		SessionToken:    value("aws_session_token"),
+	}
+	if val.AccessKeyID == "" || val.SecretAccessKey == "" {
+		return credentials.Value{}, false
+	}
+	return val, true
+}
+
+// SetCredentials replaces the credentials for the profile and saves the file
+func (c *CredentialsFile) SetCredentials(profileName string, val credentials.Value) error {
+	section, err := c.iniFile.GetSection(profileName)
+	if err != nil {
+		if section, err = c.iniFile.NewSection(profileName); err != nil {
+			return fmt.Errorf("Error creating section %q: %v", profileName, err)
+		}
+	}
+
+	section.Key("aws_access_key_id").SetValue(val.AccessKeyID)
+	section.Key("aws_secret_access_key").SetValue(val.SecretAccessKey)
+	if val.SessionToken != "" {
+		section.Key("aws_session_token").SetValue(val.SessionToken)
+	} else {
+		section.DeleteKey("aws_session_token")
+	}
+
+	return c.Save()
+}
+
+// Save writes the credentials file, which is only readable by the current user
+func (c *CredentialsFile) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.Path), 0700); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(c.Path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// the section for keys before the first profile is written with a header, even when it's empty
+	if len(c.iniFile.Section(ini.DefaultSection).Keys()) == 0 {
+		c.iniFile.DeleteSection(ini.DefaultSection)
+	}
+
+	_, err = c.iniFile.WriteTo(f)
+	return err
+}
@@ -0,0 +1,121 @@
+package vault_test
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+var exampleCredentialsFile = []byte(`[default]
+aws_access_key_id=AKIADEFAULT
+aws_secret_access_key=defaultsecret
+
+[work]
+aws_access_key_id=AKIAWORK
+aws_secret_access_key=worksecret
+aws_session_token=worktoken
+
+[nokeys]
+region=us-east-1
+`)
+
+func TestCredentialsFileProfiles(t *testing.T) {
+	f := newConfigFile(t, exampleCredentialsFile)
+	defer os.Remove(f)
+
+	cf, err := vault.LoadCredentialsFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectedNames := []string{"default", "work", "nokeys"}
+	if names := cf.ProfileNames(); !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("Expected profiles %v, got %v", expectedNames, names)
+	}
+
+	val, ok := cf.Credentials("work")
+	expected := credentials.Value{AccessKeyID: "AKIAWORK", SecretAccessKey: "worksecret", SessionToken: "worktoken"}
+	if !ok || val != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, val)
+	}
+
+	if _, ok = cf.Credentials("nokeys"); ok {
+		t.Fatalf("Expected no credentials for profile nokeys")
+	}
+}
+
+func TestCredentialsFileSetCredentials(t *testing.T) {
+	f := newConfigFile(t, exampleCredentialsFile)
+	defer os.Remove(f)
+
+	cf, err := vault.LoadCredentialsFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := credentials.Value{AccessKeyID: "ASIANEW", SecretAccessKey: "newsecret", SessionToken: "newtoken"}
+	if err = cf.SetCredentials("new", expected); err != nil {
+		t.Fatal(err)
+	}
+
+	cf, err = vault.LoadCredentialsFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val, ok := cf.Credentials("new"); !ok || val != expected {
+		t.Fatalf("Expected %+v, got %+v", expected, val)
+	}
+	if _, ok := cf.Credentials("default"); !ok {
+		t.Fatalf("Expected existing credentials to be kept")
+	}
+}
+
+func TestCredentialsFileKeepsTheCaseOfProfiles(t *testing.T) {
+	original := []byte(`[MyProfile]
+aws_access_key_id = AKIAMINE
+aws_secret_access_key = minesecret
+
+[work]
+aws_access_key_id = AKIAWORK
+aws_secret_access_key = worksecret
+`)
+	f := newConfigFile(t, original)
+	defer os.Remove(f)
+
+	cf, err := vault.LoadCredentialsFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectedNames := []string{"MyProfile", "work"}
+	if names := cf.ProfileNames(); !reflect.DeepEqual(names, expectedNames) {
+		t.Fatalf("Expected profiles %v, got %v", expectedNames, names)
+	}
+	if _, ok := cf.Credentials("MyProfile"); !ok {
+		t.Fatalf("Expected credentials for profile MyProfile")
+	}
+
+	val := credentials.Value{AccessKeyID: "AKIANEW", SecretAccessKey: "newsecret"}
+	if err = cf.SetCredentials("work", val); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[MyProfile]
+aws_access_key_id=AKIAMINE
+aws_secret_access_key=minesecret
+
+[work]
+aws_access_key_id=AKIANEW
+aws_secret_access_key=newsecret
+
+`
+	if string(b) != expected {
+		t.Fatalf("Expected the file to be saved as:\n%s\ngot:\n%s", expected, b)
+	}
+}
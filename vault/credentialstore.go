@@ -0,0 +1,69 @@
+package vault
+
+import (
+	"github.com/99designs/keyring"
+)
+
+// ErrStoreKeyNotFound is returned by a CredentialStore for a key it doesn't have
+var ErrStoreKeyNotFound = keyring.ErrKeyNotFound
+
+// CredentialStore is a secret store for embedders to keep credentials in instead of one of the keyring
+// backends. Master credentials, cached sessions and SSO tokens are all stored in it as opaque data
+type CredentialStore interface {
+	// Get returns the data stored for key, or ErrStoreKeyNotFound
+	Get(key string) ([]byte, error)
+
+	// Set stores data for key, replacing any existing data
+	Set(key string, data []byte) error
+
+	// Remove deletes key, or returns ErrStoreKeyNotFound
+	Remove(key string) error
+
+	// Keys returns all the stored keys
+	Keys() ([]string, error)
+
+	// Has returns true if key is stored
+	Has(key string) (bool, error)
+}
+
+// NewCredentialStoreKeyring returns a CredentialKeyring backed by store
+func NewCredentialStoreKeyring(store CredentialStore) *CredentialKeyring {
+	return &CredentialKeyring{Keyring: storeKeyring{store}}
+}
+
+// storeKeyring adapts a CredentialStore to a keyring.Keyring, so the sessions and SSO tokens kept
+// alongside credentials use it too
+type storeKeyring struct {
+	store CredentialStore
+}
+
+func (k storeKeyring) Get(key string) (keyring.Item, error) {
+	data, err := k.store.Get(key)
+	if err != nil {
+		return keyring.Item{}, err
+	}
+	return keyring.Item{Key: key, Data: data}, nil
+}
+
+func (k storeKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	ok, err := k.store.Has(key)
+	if err != nil {
+		return keyring.Metadata{}, err
+	}
+	if !ok {
+		return keyring.Metadata{}, ErrStoreKeyNotFound
+	}
+	return keyring.Metadata{Item: &keyring.Item{Key: key}}, nil
+}
+
+func (k storeKeyring) Set(item keyring.Item) error {
+	return k.store.Set(item.Key, item.Data)
+}
+
+func (k storeKeyring) Remove(key string) error {
+	return k.store.Remove(key)
+}
+
+func (k storeKeyring) Keys() ([]string, error) {
+	return k.store.Keys()
+}
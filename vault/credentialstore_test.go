@@ -0,0 +1,102 @@
+package vault_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+type mapStore map[string][]byte
+
+func (s mapStore) Get(key string) ([]byte, error) {
+	if data, ok := s[key]; ok {
+		return data, nil
+	}
+	return nil, vault.ErrStoreKeyNotFound
+}
+
+func (s mapStore) Set(key string, data []byte) error {
+	s[key] = data
+	return nil
+}
+
+func (s mapStore) Remove(key string) error {
+	if _, ok := s[key]; !ok {
+		return vault.ErrStoreKeyNotFound
+	}
+	delete(s, key)
+	return nil
+}
+
+func (s mapStore) Keys() ([]string, error) {
+	var keys []string
+	for k := range s {
+		keys = append(keys, k)
+	}
+	return keys, nil
+}
+
+func (s mapStore) Has(key string) (bool, error) {
+	_, ok := s[key]
+	return ok, nil
+}
+
+func TestCredentialStoreKeyring(t *testing.T) {
+	store := mapStore{}
+	ck := vault.NewCredentialStoreKeyring(store)
+
+	creds := credentials.Value{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"}
+	if err := ck.Set("llamas", creds); err != nil {
+		t.Fatal(err)
+	}
+	err := ck.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(store) != 2 {
+		t.Fatalf("Expected the credentials and session in the store, got %d keys", len(store))
+	}
+
+	if ok, err := ck.Has("llamas"); err != nil || !ok {
+		t.Fatalf("Expected llamas to be stored, got %v, %v", ok, err)
+	}
+	names, err := ck.CredentialsKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"llamas"}) {
+		t.Fatalf("Expected only the credentials, got %v", names)
+	}
+
+	got, err := ck.Get("llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != creds {
+		t.Fatalf("Expected %v, got %v", creds, got)
+	}
+	session, err := ck.Sessions().Retrieve("llamas", "", "us-east-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *session.AccessKeyId != "ASIAEXAMPLE" {
+		t.Fatalf("Expected the stored session, got %s", *session.AccessKeyId)
+	}
+
+	if err = ck.Remove("llamas"); err != nil {
+		t.Fatal(err)
+	}
+	if ok, _ := ck.Has("llamas"); ok {
+		t.Fatal("Expected llamas to be removed")
+	}
+}
@@ -0,0 +1,181 @@
+package vault
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+const (
+	// credentialSourceEc2InstanceMetadata is the credential_source for the EC2 instance role
+	credentialSourceEc2InstanceMetadata = "Ec2InstanceMetadata"
+
+	defaultEc2MetadataEndpoint = "http://169.254.169.254"
+	defaultEc2MetadataTokenTTL = 6 * time.Hour
+	ec2MetadataTokenTimeout    = time.Second
+)
+
+// Ec2MetadataProvider retrieves the credentials of the EC2 instance role from the instance metadata
+// service. IMDSv2 is used when a session token can be fetched, falling back to IMDSv1 unless V1Disabled
+// is set. Unlike the SDK's metadata client the endpoint and token TTL can be configured, which helps
+// in containers on EC2 where the default hop limit blocks the metadata service
+type Ec2MetadataProvider struct {
+	Endpoint     string
+	TokenTTL     time.Duration
+	V1Disabled   bool
+	ExpiryWindow time.Duration
+	Client       *http.Client
+	credentials.Expiry
+}
+
+type ec2RoleCredentials struct {
+	Code            string
+	Message         string
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+// NewEc2MetadataProvider returns a provider for the instance role configured by config
+func NewEc2MetadataProvider(config *Config) *Ec2MetadataProvider {
+	p := &Ec2MetadataProvider{
+		Endpoint:     config.Ec2MetadataEndpoint,
+		TokenTTL:     config.Ec2MetadataTokenTTL,
+		V1Disabled:   config.Ec2MetadataV1Disabled,
+		ExpiryWindow: defaultExpirationWindow,
+		Client:       &http.Client{Timeout: 5 * time.Second},
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = defaultEc2MetadataEndpoint
+	}
+	if p.TokenTTL == 0 {
+		p.TokenTTL = defaultEc2MetadataTokenTTL
+	}
+	return p
+}
+
+// Retrieve returns the instance role credentials from the metadata service
+func (p *Ec2MetadataProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.token()
+	if err != nil {
+		if p.V1Disabled {
+			return credentials.Value{}, fmt.Errorf("Error getting an IMDSv2 token from %s: %w", p.Endpoint, err)
+		}
+		log.Printf("Couldn't get an IMDSv2 token, falling back to IMDSv1: %v", err)
+	}
+
+	roles, err := p.get("/latest/meta-data/iam/security-credentials/", token)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Error getting the instance role from %s: %w", p.Endpoint, err)
+	}
+	roleName := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if roleName == "" {
+		return credentials.Value{}, fmt.Errorf("No instance role found at %s", p.Endpoint)
+	}
+
+	b, err := p.get("/latest/meta-data/iam/security-credentials/"+roleName, token)
+	if err != nil {
+		return credentials.Value{}, fmt.Errorf("Error getting credentials for instance role %s: %w", roleName, err)
+	}
+
+	var creds ec2RoleCredentials
+	if err = json.Unmarshal(b, &creds); err != nil {
+		return credentials.Value{}, fmt.Errorf("Error parsing credentials for instance role %s: %w", roleName, err)
+	}
+	if creds.Code != "Success" {
+		return credentials.Value{}, fmt.Errorf("Error getting credentials for instance role %s: %s %s", roleName, creds.Code, creds.Message)
+	}
+
+	log.Printf("Using credentials %s of instance role %s, expires in %s", FormatKeyForDisplay(creds.AccessKeyID), roleName, time.Until(creds.Expiration).String())
+	p.SetExpiration(creds.Expiration, p.ExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     creds.AccessKeyID,
+		SecretAccessKey: creds.SecretAccessKey,
+		SessionToken:    creds.Token,
+	}, nil
+}
+
+// Region returns the region of the instance from the metadata service
+func (p *Ec2MetadataProvider) Region() (string, error) {
+	token, err := p.token()
+	if err != nil {
+		// off EC2 there's nothing to fall back to, so don't wait for IMDSv1 too
+		if p.V1Disabled || isNetworkError(err) {
+			return "", err
+		}
+		log.Printf("Couldn't get an IMDSv2 token, falling back to IMDSv1: %v", err)
+	}
+
+	b, err := p.get("/latest/meta-data/placement/region", token)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// token returns an IMDSv2 session token. The response is dropped rather than refused when the hop
+// limit is too low, so it has a short timeout
+func (p *Ec2MetadataProvider) token() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ec2MetadataTokenTimeout)
+	defer cancel()
+
+	req, err := http.NewRequest("PUT", p.Endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", strconv.Itoa(int(p.TokenTTL.Seconds())))
+
+	return p.do(req)
+}
+
+func (p *Ec2MetadataProvider) get(path string, token string) ([]byte, error) {
+	req, err := http.NewRequest("GET", p.Endpoint+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if token != "" {
+		req.Header.Set("X-aws-ec2-metadata-token", token)
+	}
+
+	b, err := p.do(req)
+	return []byte(b), err
+}
+
+func (p *Ec2MetadataProvider) do(req *http.Request) (string, error) {
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s %s returned %s", req.Method, req.URL.Path, resp.Status)
+	}
+
+	return string(b), nil
+}
+
+// NewCredentialSourceProvider returns a provider for the profile's credential_source
+func NewCredentialSourceProvider(config *Config) (credentials.Provider, error) {
+	switch config.CredentialSource {
+	case credentialSourceEc2InstanceMetadata:
+		return NewEc2MetadataProvider(config), nil
+	default:
+		return nil, &ConfigError{fmt.Errorf("profile %s: credential_source %q isn't supported, only %s is", config.ProfileName, config.CredentialSource, credentialSourceEc2InstanceMetadata)}
+	}
+}
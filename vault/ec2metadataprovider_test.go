@@ -0,0 +1,94 @@
+package vault_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func newFakeMetadataServer(t *testing.T, supportsV2 bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if !supportsV2 {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, "imds-token")
+			return
+		}
+		if supportsV2 && r.Header.Get("X-aws-ec2-metadata-token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "instance-role")
+		case "/latest/meta-data/placement/region":
+			fmt.Fprint(w, "ap-southeast-2")
+		case "/latest/meta-data/iam/security-credentials/instance-role":
+			fmt.Fprintf(w, `{"Code":"Success","AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","Token":"token","Expiration":"%s"}`,
+				time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func TestEc2MetadataProvider(t *testing.T) {
+	for _, supportsV2 := range []bool{true, false} {
+		ts := newFakeMetadataServer(t, supportsV2)
+
+		p := vault.NewEc2MetadataProvider(&vault.Config{Ec2MetadataEndpoint: ts.URL})
+		val, err := p.Retrieve()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if val.AccessKeyID != "ASIAEXAMPLE" || val.SessionToken != "token" {
+			t.Fatalf("Unexpected credentials %#v", val)
+		}
+
+		p = vault.NewEc2MetadataProvider(&vault.Config{Ec2MetadataEndpoint: ts.URL, Ec2MetadataV1Disabled: true})
+		if _, err = p.Retrieve(); supportsV2 && err != nil {
+			t.Fatal(err)
+		} else if !supportsV2 && err == nil {
+			t.Fatal("Expected an error when IMDSv1 is disabled and IMDSv2 isn't available")
+		}
+
+		ts.Close()
+	}
+}
+
+func TestNewSessionUsesInstanceRegionWhenUnset(t *testing.T) {
+	ts := newFakeMetadataServer(t, true)
+	defer ts.Close()
+
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		defer os.Setenv(name, os.Getenv(name))
+		os.Unsetenv(name)
+	}
+	defer os.Unsetenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	os.Setenv("AWS_EC2_METADATA_SERVICE_ENDPOINT", ts.URL)
+
+	sess, err := vault.NewSession(credentials.AnonymousCredentials, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region := aws.StringValue(sess.Config.Region); region != "ap-southeast-2" {
+		t.Fatalf("Expected the region from the instance metadata, got %q", region)
+	}
+
+	sess, err = vault.NewSession(credentials.AnonymousCredentials, "eu-west-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if region := aws.StringValue(sess.Config.Region); region != "eu-west-1" {
+		t.Fatalf("Expected the configured region to be used, got %q", region)
+	}
+}
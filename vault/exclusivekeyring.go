@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/99designs/keyring"
+)
+
+// ExclusiveKeyring serializes access to a keyring across processes by holding a lock on LockPath
+// for each operation. The file backend needs this as it has no locking of its own, so concurrent
+// processes writing sessions can leave partially written items
+type ExclusiveKeyring struct {
+	keyring.Keyring
+	LockPath string
+}
+
+// withLock calls f while holding the lock file
+func (k ExclusiveKeyring) withLock(f func() error) error {
+	if err := os.MkdirAll(filepath.Dir(k.LockPath), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(k.LockPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = lockFile(file); err != nil {
+		return err
+	}
+	defer unlockFile(file)
+
+	return f()
+}
+
+func (k ExclusiveKeyring) Get(key string) (item keyring.Item, err error) {
+	err = k.withLock(func() error {
+		item, err = k.Keyring.Get(key)
+		return err
+	})
+	return item, err
+}
+
+func (k ExclusiveKeyring) GetMetadata(key string) (md keyring.Metadata, err error) {
+	err = k.withLock(func() error {
+		md, err = k.Keyring.GetMetadata(key)
+		return err
+	})
+	return md, err
+}
+
+func (k ExclusiveKeyring) Set(item keyring.Item) error {
+	return k.withLock(func() error {
+		return k.Keyring.Set(item)
+	})
+}
+
+func (k ExclusiveKeyring) Remove(key string) error {
+	return k.withLock(func() error {
+		return k.Keyring.Remove(key)
+	})
+}
+
+func (k ExclusiveKeyring) Keys() (keys []string, err error) {
+	err = k.withLock(func() error {
+		keys, err = k.Keyring.Keys()
+		return err
+	})
+	return keys, err
+}
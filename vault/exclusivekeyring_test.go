@@ -0,0 +1,61 @@
+package vault_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+// overlapDetectingKeyring fails a Set that runs while another Set is in progress
+type overlapDetectingKeyring struct {
+	keyring.Keyring
+	writers *int32
+}
+
+func (k overlapDetectingKeyring) Set(item keyring.Item) error {
+	if atomic.AddInt32(k.writers, 1) > 1 {
+		return errors.New("concurrent write")
+	}
+	defer atomic.AddInt32(k.writers, -1)
+	time.Sleep(time.Millisecond)
+	return k.Keyring.Set(item)
+}
+
+func TestExclusiveKeyringSerializesWrites(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var writers int32
+	backend := overlapDetectingKeyring{keyring.NewArrayKeyring(nil), &writers}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each writer has its own wrapper, as separate aws-vault processes would
+			k := vault.ExclusiveKeyring{Keyring: backend, LockPath: filepath.Join(dir, "keys.lock")}
+			if err := k.Set(keyring.Item{Key: "session", Data: []byte("{}")}); err != nil {
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,63 @@
+package vault
+
+import (
+	"errors"
+	"log"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// isExpiredTokenError returns whether STS rejected a session token as expired, which can happen
+// before its expiry time, e.g. when the clock is out of sync
+func isExpiredTokenError(err error) bool {
+	var aerr awserr.Error
+	if errors.As(err, &aerr) {
+		switch aerr.Code() {
+		case "ExpiredToken", "ExpiredTokenException":
+			return true
+		}
+	}
+	return false
+}
+
+// WithTempCredentials calls f with credentials for the config. If f fails because a session token
+// was rejected, the cached sessions for the profile chain are deleted and f is called once more with
+// freshly created credentials
+func WithTempCredentials(config *Config, k *CredentialKeyring, f func(*ContextCredentials) error) error {
+	creds, err := NewTempCredentialsWithContext(config, k)
+	if err != nil {
+		return err
+	}
+
+	err = f(creds)
+	if err == nil || !isExpiredTokenError(err) {
+		return err
+	}
+
+	log.Printf("Session token was rejected, refreshing: %v", err)
+
+	if err = deleteChainSessions(config, k); err != nil {
+		return err
+	}
+
+	creds, err = NewTempCredentialsWithContext(config, k)
+	if err != nil {
+		return err
+	}
+
+	return f(creds)
+}
+
+// deleteChainSessions deletes the cached sessions of the session owner for every profile in the chain
+func deleteChainSessions(config *Config, k *CredentialKeyring) error {
+	sessions := k.Sessions()
+	for c := config; c != nil; c = c.SourceProfile {
+		sessions.Owner = c.SessionOwner()
+		if n, err := sessions.Delete(c.ProfileName); err != nil {
+			return err
+		} else if n > 0 {
+			log.Printf("Deleted %d cached sessions for %s", n, c.ProfileName)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package vault_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// withRejectedTempCredentials calls WithTempCredentials for a profile with a cached session, where
+// the first call fails with errorCode, and returns the number of calls and the sessions left
+func withRejectedTempCredentials(t *testing.T, errorCode string) (int, []vault.KeyringSession) {
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"AKIAEXAMPLE","SecretAccessKey":"secret"}`)},
+	})}
+	err := k.Sessions().Store("llamas", "", "", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	calls := 0
+	err = vault.WithTempCredentials(&vault.Config{ProfileName: "llamas"}, k, func(creds *vault.ContextCredentials) error {
+		calls++
+		if calls == 1 {
+			return fmt.Errorf("Error calling STS: %w", awserr.New(errorCode, "The security token is rejected", nil))
+		}
+		return nil
+	})
+	if err != nil && calls > 1 {
+		t.Fatal(err)
+	}
+
+	sessions, err := k.Sessions().Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return calls, sessions
+}
+
+func TestWithTempCredentialsRetriesExpiredTokens(t *testing.T) {
+	calls, sessions := withRejectedTempCredentials(t, "ExpiredToken")
+
+	if calls != 2 {
+		t.Fatalf("Expected a retry, got %d calls", calls)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Expected the cached session to be deleted, got %d sessions", len(sessions))
+	}
+}
+
+func TestWithTempCredentialsDoesntRetryInvalidTokens(t *testing.T) {
+	calls, sessions := withRejectedTempCredentials(t, "InvalidClientTokenId")
+
+	if calls != 1 {
+		t.Fatalf("Expected no retry, got %d calls", calls)
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("Expected the cached session to be kept, got %d sessions", len(sessions))
+	}
+}
@@ -0,0 +1,110 @@
+package vault
+
+import (
+	"log"
+
+	"github.com/99designs/keyring"
+)
+
+// FallbackKeyring reads from each of a list of keyrings in turn until one succeeds, so items can
+// still be read when the preferred backend is unavailable, such as a locked keychain. Items are
+// only written to the primary keyring
+type FallbackKeyring struct {
+	// Keyring is the primary keyring, which is read and written first
+	keyring.Keyring
+
+	// Fallbacks are read in order when the primary keyring can't be read
+	Fallbacks []keyring.Keyring
+}
+
+func (k FallbackKeyring) keyrings() []keyring.Keyring {
+	return append([]keyring.Keyring{k.Keyring}, k.Fallbacks...)
+}
+
+func (k FallbackKeyring) Get(key string) (item keyring.Item, err error) {
+	var errs []error
+	for i, kr := range k.keyrings() {
+		if item, err = kr.Get(key); err == nil {
+			if i > 0 {
+				log.Printf("Read %s from fallback keyring %d", key, i)
+			}
+			return item, nil
+		}
+		errs = append(errs, err)
+	}
+	return item, firstKeyringError(errs)
+}
+
+func (k FallbackKeyring) GetMetadata(key string) (md keyring.Metadata, err error) {
+	var errs []error
+	for _, kr := range k.keyrings() {
+		if md, err = kr.GetMetadata(key); err == nil {
+			return md, nil
+		}
+		errs = append(errs, err)
+	}
+	return md, firstKeyringError(errs)
+}
+
+// Set writes the item to the primary keyring. It isn't written to a fallback when the primary can't
+// be written to, as credentials would end up in a backend the user didn't choose for them
+func (k FallbackKeyring) Set(item keyring.Item) error {
+	return k.Keyring.Set(item)
+}
+
+// Remove removes the item from every keyring, so that it can't be read from a fallback afterwards
+func (k FallbackKeyring) Remove(key string) error {
+	var errs []error
+	removed := false
+	for _, kr := range k.keyrings() {
+		if err := kr.Remove(key); err == nil {
+			removed = true
+		} else {
+			errs = append(errs, err)
+		}
+	}
+	if err := firstKeyringError(errs); err != nil && (!removed || err != keyring.ErrKeyNotFound) {
+		return err
+	}
+	return nil
+}
+
+// Keys returns the keys in all the keyrings. Keyrings that can't be listed are skipped, unless
+// none of them can be
+func (k FallbackKeyring) Keys() ([]string, error) {
+	var allKeys []string
+	var errs []error
+	seen := map[string]bool{}
+	for i, kr := range k.keyrings() {
+		keys, err := kr.Keys()
+		if err != nil {
+			log.Printf("Skipping keyring %d, listing keys failed: %v", i, err)
+			errs = append(errs, err)
+			continue
+		}
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				allKeys = append(allKeys, key)
+			}
+		}
+	}
+	if len(errs) == len(k.Fallbacks)+1 {
+		return nil, errs[0]
+	}
+	return allKeys, nil
+}
+
+// firstKeyringError returns the first error that isn't keyring.ErrKeyNotFound, as that says more
+// about why an item couldn't be read, or keyring.ErrKeyNotFound if no keyring had the item
+func firstKeyringError(errs []error) error {
+	for _, err := range errs {
+		if err != keyring.ErrKeyNotFound {
+			return err
+		}
+	}
+	if len(errs) > 0 {
+		return keyring.ErrKeyNotFound
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package vault_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestFallbackKeyringReadsFromTheFallbacks(t *testing.T) {
+	primary := keyring.NewArrayKeyring(nil)
+	fallback := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})
+	k := &vault.CredentialKeyring{Keyring: vault.FallbackKeyring{
+		Keyring:   lockedKeyring{primary},
+		Fallbacks: []keyring.Keyring{fallback},
+	}}
+
+	val, err := k.Get("llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ABC" {
+		t.Fatalf("Expected the credentials from the fallback, got %q", val.AccessKeyID)
+	}
+
+	has, err := k.Has("llamas")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !has {
+		t.Fatal("Expected the credentials in the fallback to be found")
+	}
+
+	if err = k.Set("alpacas", val); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = primary.Get("alpacas"); err != nil {
+		t.Fatalf("Expected credentials to be written to the primary keyring, got %v", err)
+	}
+	if _, err = fallback.Get("alpacas"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected credentials not to be written to the fallback, got %v", err)
+	}
+}
+
+func TestFallbackKeyringReturnsTheMostUsefulError(t *testing.T) {
+	k := vault.FallbackKeyring{
+		Keyring:   vault.LockAwareKeyring{Keyring: lockedKeyring{keyring.NewArrayKeyring(nil)}},
+		Fallbacks: []keyring.Keyring{keyring.NewArrayKeyring(nil)},
+	}
+
+	_, err := k.Get("llamas")
+	if !errors.Is(err, vault.ErrKeyringLocked) {
+		t.Fatalf("Expected ErrKeyringLocked rather than the fallback's error, got %v", err)
+	}
+
+	k.Keyring = keyring.NewArrayKeyring(nil)
+	_, err = k.Get("llamas")
+	if err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestFallbackKeyringRemovesFromEveryKeyring(t *testing.T) {
+	item := keyring.Item{Key: "llamas", Data: []byte(`{}`)}
+	primary := keyring.NewArrayKeyring([]keyring.Item{item})
+	fallback := keyring.NewArrayKeyring([]keyring.Item{item, {Key: "alpacas"}})
+	k := vault.FallbackKeyring{Keyring: primary, Fallbacks: []keyring.Keyring{fallback}}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("Expected the keys from both keyrings without duplicates, got %v", keys)
+	}
+
+	if err = k.Remove("llamas"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("llamas"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected the item to be removed from every keyring, got %v", err)
+	}
+	if err = k.Remove("alpacas"); err != nil {
+		t.Fatalf("Expected removing an item only in the fallback to succeed, got %v", err)
+	}
+}
+
+// unwritableKeyring fails every write, like a locked keychain that can't prompt
+type unwritableKeyring struct {
+	keyring.Keyring
+}
+
+func (k unwritableKeyring) Set(item keyring.Item) error {
+	return errors.New("User interaction is not allowed")
+}
+
+func TestFallbackKeyringOnlyWritesToThePrimary(t *testing.T) {
+	primary := keyring.NewArrayKeyring(nil)
+	fallback := keyring.NewArrayKeyring(nil)
+	k := &vault.CredentialKeyring{Keyring: vault.FallbackKeyring{
+		Keyring:   unwritableKeyring{primary},
+		Fallbacks: []keyring.Keyring{fallback},
+	}}
+
+	if err := k.Set("llamas", credentials.Value{AccessKeyID: "ABC", SecretAccessKey: "XYZ"}); err == nil || err.Error() != "User interaction is not allowed" {
+		t.Fatalf("Expected the primary keyring's error, got %v", err)
+	}
+	err := k.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err == nil {
+		t.Fatal("Expected an error storing a session when the primary keyring can't be written")
+	}
+	if keys, _ := fallback.Keys(); len(keys) != 0 {
+		t.Fatalf("Expected nothing to be written to the fallback, got keys %v", keys)
+	}
+}
@@ -0,0 +1,76 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// fdCredentials holds the credentials read from each file descriptor, as they can only be read once.
+// The files are kept too, as the descriptors belong to whoever passed them and the finalizer of a
+// garbage collected file would close them
+var fdCredentials = struct {
+	sync.Mutex
+	outputs map[int]*credentialProcessOutput
+	files   map[int]*os.File
+}{outputs: map[int]*credentialProcessOutput{}, files: map[int]*os.File{}}
+
+// FileDescriptorProvider provides source credentials that another process wrote to an inherited file
+// descriptor, in the credential_process JSON format. This lets a parent with keyring access hand
+// credentials to a less trusted child
+type FileDescriptorProvider struct {
+	FD     int
+	output *credentialProcessOutput
+}
+
+// NewFileDescriptorProvider reads the credentials from the file descriptor
+func NewFileDescriptorProvider(fd int) (*FileDescriptorProvider, error) {
+	fdCredentials.Lock()
+	defer fdCredentials.Unlock()
+
+	output, ok := fdCredentials.outputs[fd]
+	if !ok {
+		f := os.NewFile(uintptr(fd), fmt.Sprintf("fd%d", fd))
+		if f == nil {
+			return nil, fmt.Errorf("File descriptor %d isn't valid", fd)
+		}
+		fdCredentials.files[fd] = f
+
+		log.Printf("Reading source credentials from file descriptor %d", fd)
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading file descriptor %d: %w", fd, err)
+		}
+
+		output, err = parseCredentialProcessOutput(b, fmt.Sprintf("file descriptor %d", fd))
+		if err != nil {
+			return nil, err
+		}
+		fdCredentials.outputs[fd] = output
+	}
+
+	return &FileDescriptorProvider{FD: fd, output: output}, nil
+}
+
+// IsExpired returns true when the credentials have an expiration that has passed
+func (p *FileDescriptorProvider) IsExpired() bool {
+	return p.output.Expiration != nil && time.Now().After(*p.output.Expiration)
+}
+
+// Retrieve returns the credentials read from the file descriptor
+func (p *FileDescriptorProvider) Retrieve() (credentials.Value, error) {
+	if p.IsExpired() {
+		return credentials.Value{}, fmt.Errorf("Credentials from file descriptor %d expired at %s", p.FD, p.output.Expiration.Format(time.RFC3339))
+	}
+
+	return credentials.Value{
+		AccessKeyID:     p.output.AccessKeyID,
+		SecretAccessKey: p.output.SecretAccessKey,
+		SessionToken:    p.output.SessionToken,
+	}, nil
+}
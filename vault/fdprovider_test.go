@@ -0,0 +1,42 @@
+package vault_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func TestSourceFDIsUsedInsteadOfKeyring(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = w.WriteString(`{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","SessionToken":"token"}`); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})}
+	config := &vault.Config{ProfileName: "llamas", SourceFD: int(r.Fd())}
+
+	creds, err := vault.NewTempCredentials(config, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := creds.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIAEXAMPLE" || val.SessionToken != "token" {
+		t.Fatalf("Expected the credentials from the file descriptor, got %#v", val)
+	}
+
+	// the descriptor belongs to whoever passed it, so it's left open
+	if err = r.Close(); err != nil {
+		t.Fatalf("Expected the file descriptor to still be open, got %v", err)
+	}
+}
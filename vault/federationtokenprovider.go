@@ -1,7 +1,11 @@
 package vault
 
 import (
+	"context"
+	"fmt"
+	"io/ioutil"
 	"log"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -17,6 +21,11 @@ type FederationTokenProvider struct {
 	Name         string
 	Duration     time.Duration
 	ExpiryWindow time.Duration
+	Hook         Hook
+
+	// Policy scopes down the session. It's either inline JSON, a file:// path to JSON, or comma-separated
+	// managed policy ARNs. Defaults to allowing everything the IAM user can do
+	Policy string
 	credentials.Expiry
 }
 
@@ -29,17 +38,27 @@ func (f *FederationTokenProvider) name() string {
 }
 
 // Retrieve generates a new set of temporary credentials using STS GetFederationToken
-func (f *FederationTokenProvider) Retrieve() (val credentials.Value, err error) {
-	resp, err := f.StsClient.GetFederationToken(&sts.GetFederationTokenInput{
+func (f *FederationTokenProvider) Retrieve() (credentials.Value, error) {
+	return f.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext is Retrieve, but stops waiting for STS when ctx is done
+func (f *FederationTokenProvider) RetrieveWithContext(ctx context.Context) (val credentials.Value, err error) {
+	input := &sts.GetFederationTokenInput{
 		Name:            aws.String(f.name()),
 		DurationSeconds: aws.Int64(int64(f.Duration.Seconds())),
-		Policy:          aws.String(allowAllIAMPolicy),
-	})
+	}
+	if err = f.setPolicy(input); err != nil {
+		return val, err
+	}
+
+	resp, err := f.StsClient.GetFederationTokenWithContext(ctx, input)
 	if err != nil {
 		return val, err
 	}
 
 	log.Printf("Generated credentials %s using GetFederationToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	notifyHook(f.Hook, HookEventRefresh)
 
 	f.SetExpiration(*resp.Credentials.Expiration, f.ExpiryWindow)
 	return credentials.Value{
@@ -48,3 +67,23 @@ func (f *FederationTokenProvider) Retrieve() (val credentials.Value, err error)
 		SessionToken:    *resp.Credentials.SessionToken,
 	}, nil
 }
+
+func (f *FederationTokenProvider) setPolicy(input *sts.GetFederationTokenInput) error {
+	switch {
+	case f.Policy == "":
+		input.Policy = aws.String(allowAllIAMPolicy)
+	case strings.HasPrefix(f.Policy, "arn:"):
+		for _, policyARN := range strings.Split(f.Policy, ",") {
+			input.PolicyArns = append(input.PolicyArns, &sts.PolicyDescriptorType{Arn: aws.String(strings.TrimSpace(policyARN))})
+		}
+	case strings.HasPrefix(f.Policy, "file://"):
+		b, err := ioutil.ReadFile(strings.TrimPrefix(f.Policy, "file://"))
+		if err != nil {
+			return fmt.Errorf("Error reading federation_policy: %w", err)
+		}
+		input.Policy = aws.String(string(b))
+	default:
+		input.Policy = aws.String(f.Policy)
+	}
+	return nil
+}
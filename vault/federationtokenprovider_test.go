@@ -0,0 +1,68 @@
+package vault_test
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestFederationTokenPolicy(t *testing.T) {
+	var testCases = []struct {
+		Policy       string
+		InlinePolicy string
+		PolicyARN    string
+	}{
+		{"", `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Action":"*","Resource":"*"}]}`, ""},
+		{"arn:aws:iam::aws:policy/ReadOnlyAccess", "", "arn:aws:iam::aws:policy/ReadOnlyAccess"},
+		{`{"Version":"2012-10-17","Statement":[]}`, `{"Version":"2012-10-17","Statement":[]}`, ""},
+	}
+
+	for _, tc := range testCases {
+		var form url.Values
+		sess, done := newFakeAWSSession(t, "", &form)
+
+		p := &vault.FederationTokenProvider{
+			StsClient: sts.New(sess),
+			Name:      "alice",
+			Duration:  time.Hour,
+			Policy:    tc.Policy,
+		}
+		if _, err := p.Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		done()
+
+		if policy := form.Get("Policy"); policy != tc.InlinePolicy {
+			t.Fatalf("Expected inline policy %q, got %q", tc.InlinePolicy, policy)
+		}
+		if policyARN := form.Get("PolicyArns.member.1.arn"); policyARN != tc.PolicyARN {
+			t.Fatalf("Expected policy ARN %q, got %q", tc.PolicyARN, policyARN)
+		}
+	}
+}
+
+func TestFederationTokenWithCancelledContext(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	p := &vault.FederationTokenProvider{
+		StsClient: sts.New(sess),
+		Name:      "alice",
+		Duration:  time.Hour,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := p.RetrieveWithContext(ctx)
+	if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != request.CanceledErrorCode {
+		t.Fatalf("Expected the request to be cancelled, got %v", err)
+	}
+}
@@ -0,0 +1,48 @@
+package vault
+
+import (
+	"sync"
+
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// flightCall is a call in progress, shared by everyone asking for the same key
+type flightCall struct {
+	wg      sync.WaitGroup
+	session *sts.Credentials
+	err     error
+}
+
+// flightGroup coalesces concurrent calls for the same key into one, so that many goroutines asking
+// for the same profile make a single keyring read or STS call
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// Do runs fn for key, unless a call for key is already in progress in which case it waits for and
+// returns that call's result
+func (g *flightGroup) Do(key string, fn func() (*sts.Credentials, error)) (*sts.Credentials, error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = map[string]*flightCall{}
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.session, c.err
+	}
+	c := &flightCall{}
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	c.session, c.err = fn()
+	c.wg.Done()
+
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+
+	return c.session, c.err
+}
@@ -5,6 +5,7 @@ import (
 	"regexp"
 	"strings"
 
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/iam"
 )
@@ -31,8 +32,12 @@ func GetUsernameFromSession(sess *session.Session) (string, error) {
 	}
 
 	if resp.User.Arn != nil {
-		arnParts := strings.Split(*resp.User.Arn, ":")
-		return arnParts[len(arnParts)-1], nil
+		// the user name is the last part of the resource, after any path
+		userARN, err := arn.Parse(*resp.User.Arn)
+		if err != nil {
+			return "", err
+		}
+		return userARN.Resource[strings.LastIndex(userARN.Resource, "/")+1:], nil
 	}
 
 	return "", fmt.Errorf("Couldn't determine current username")
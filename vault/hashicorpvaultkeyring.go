@@ -0,0 +1,229 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/99designs/keyring"
+)
+
+// HashiCorpVaultBackend is the --backend name of HashiCorpVaultKeyring
+const HashiCorpVaultBackend = "vault"
+
+// HashiCorpVaultKeyring stores items in a KV version 2 secrets engine of HashiCorp Vault, so
+// credentials can be managed and audited centrally. Each item is a secret named after its key
+// under Prefix in Mount
+type HashiCorpVaultKeyring struct {
+	// Address is the URL of the Vault server, e.g. https://vault.example.com:8200
+	Address string
+	Mount   string
+	Prefix  string
+
+	// Token authenticates requests. When it's empty, RoleID and SecretID are used to log in with AppRole
+	Token    string
+	RoleID   string
+	SecretID string
+
+	Client *http.Client
+
+	mu sync.Mutex
+}
+
+// hashiCorpVaultSecret is the data of a secret the keyring writes
+type hashiCorpVaultSecret struct {
+	Data        string `json:"data"`
+	Label       string `json:"label,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Get returns the item stored under key
+func (k *HashiCorpVaultKeyring) Get(key string) (keyring.Item, error) {
+	var resp struct {
+		Data struct {
+			Data hashiCorpVaultSecret `json:"data"`
+		} `json:"data"`
+	}
+	if err := k.request("GET", k.secretPath("data", key), nil, &resp); err != nil {
+		return keyring.Item{}, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(resp.Data.Data.Data)
+	if err != nil {
+		return keyring.Item{}, fmt.Errorf("Invalid data in Vault secret for %s: %w", key, err)
+	}
+
+	return keyring.Item{
+		Key:         key,
+		Data:        data,
+		Label:       resp.Data.Data.Label,
+		Description: resp.Data.Data.Description,
+	}, nil
+}
+
+// GetMetadata returns when the item stored under key was last updated
+func (k *HashiCorpVaultKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	var resp struct {
+		Data struct {
+			UpdatedTime time.Time `json:"updated_time"`
+		} `json:"data"`
+	}
+	if err := k.request("GET", k.secretPath("metadata", key), nil, &resp); err != nil {
+		return keyring.Metadata{}, err
+	}
+
+	return keyring.Metadata{ModificationTime: resp.Data.UpdatedTime}, nil
+}
+
+// Set writes a new version of the secret for the item
+func (k *HashiCorpVaultKeyring) Set(item keyring.Item) error {
+	body := struct {
+		Data hashiCorpVaultSecret `json:"data"`
+	}{hashiCorpVaultSecret{
+		Data:        base64.StdEncoding.EncodeToString(item.Data),
+		Label:       item.Label,
+		Description: item.Description,
+	}}
+
+	return k.request("POST", k.secretPath("data", item.Key), body, nil)
+}
+
+// Remove deletes every version of the secret for key, so expired sessions don't linger
+func (k *HashiCorpVaultKeyring) Remove(key string) error {
+	return k.request("DELETE", k.secretPath("metadata", key), nil, nil)
+}
+
+// Keys lists the secrets under Prefix
+func (k *HashiCorpVaultKeyring) Keys() ([]string, error) {
+	var resp struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	err := k.request("LIST", k.secretPath("metadata", ""), nil, &resp)
+	if err == keyring.ErrKeyNotFound {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	for _, key := range resp.Data.Keys {
+		// keys ending in / are folders, which aws-vault doesn't create
+		if strings.HasSuffix(key, "/") {
+			continue
+		}
+		if unescaped, err := url.PathUnescape(key); err == nil {
+			key = unescaped
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (k *HashiCorpVaultKeyring) secretPath(kind, key string) string {
+	path := fmt.Sprintf("/v1/%s/%s/%s", strings.Trim(k.Mount, "/"), kind, strings.Trim(k.Prefix, "/"))
+	if key != "" {
+		path += "/" + url.PathEscape(key)
+	}
+	return path
+}
+
+// token returns the token to authenticate with, logging in with AppRole the first time if needed
+func (k *HashiCorpVaultKeyring) token() (string, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.Token != "" {
+		return k.Token, nil
+	}
+	if k.RoleID == "" {
+		return "", fmt.Errorf("No Vault token, set VAULT_TOKEN or VAULT_ROLE_ID and VAULT_SECRET_ID")
+	}
+
+	var resp struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	body := map[string]string{"role_id": k.RoleID, "secret_id": k.SecretID}
+	if err := k.do("POST", "/v1/auth/approle/login", "", body, &resp); err != nil {
+		return "", fmt.Errorf("Vault AppRole login failed: %w", err)
+	}
+
+	log.Printf("Logged in to Vault at %s with AppRole", k.Address)
+	k.Token = resp.Auth.ClientToken
+	return k.Token, nil
+}
+
+func (k *HashiCorpVaultKeyring) request(method, path string, body, result interface{}) error {
+	token, err := k.token()
+	if err != nil {
+		return err
+	}
+	return k.do(method, path, token, body, result)
+}
+
+// do makes a request to the Vault API, decoding the response into result. A 404 is returned as
+// keyring.ErrKeyNotFound
+func (k *HashiCorpVaultKeyring) do(method, path, token string, body, result interface{}) error {
+	var reqBody bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&reqBody).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, strings.TrimRight(k.Address, "/")+path, &reqBody)
+	if err != nil {
+		return err
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := k.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	log.Printf("Vault %s %s", method, path)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return keyring.ErrKeyNotFound
+	case resp.StatusCode >= 300:
+		var errResp struct {
+			Errors []string `json:"errors"`
+		}
+		if json.Unmarshal(b, &errResp) == nil && len(errResp.Errors) > 0 {
+			return fmt.Errorf("Vault %s %s returned %s: %s", method, path, resp.Status, strings.Join(errResp.Errors, ", "))
+		}
+		return fmt.Errorf("Vault %s %s returned %s", method, path, resp.Status)
+	case result != nil && len(b) > 0:
+		return json.Unmarshal(b, result)
+	}
+
+	return nil
+}
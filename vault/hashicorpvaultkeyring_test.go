@@ -0,0 +1,140 @@
+package vault_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+// newFakeHashiCorpVault returns a fake Vault server with a KV version 2 engine at secret/ and an
+// AppRole that logs in with role_id "role" and secret_id "secret"
+func newFakeHashiCorpVault(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	secrets := map[string]json.RawMessage{}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.URL.Path == "/v1/auth/approle/login" {
+			var body map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body["role_id"] != "role" || body["secret_id"] != "secret" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			w.Write([]byte(`{"auth":{"client_token":"approle-token"}}`))
+			return
+		}
+
+		if token := r.Header.Get("X-Vault-Token"); token != "root-token" && token != "approle-token" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"errors":["permission denied"]}`))
+			return
+		}
+
+		switch {
+		case r.Method == "LIST" && r.URL.Path == "/v1/secret/metadata/aws-vault":
+			if len(secrets) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			var keys []string
+			for name := range secrets {
+				keys = append(keys, name)
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case strings.HasPrefix(r.URL.Path, "/v1/secret/data/aws-vault/"):
+			name := strings.TrimPrefix(r.URL.EscapedPath(), "/v1/secret/data/aws-vault/")
+			if r.Method == "POST" {
+				var body struct{ Data json.RawMessage }
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					t.Fatal(err)
+				}
+				secrets[name] = body.Data
+				w.Write([]byte(`{"data":{"version":1}}`))
+				return
+			}
+			data, ok := secrets[name]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{"data": data}})
+		case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/v1/secret/metadata/aws-vault/"):
+			delete(secrets, strings.TrimPrefix(r.URL.EscapedPath(), "/v1/secret/metadata/aws-vault/"))
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Fatalf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+}
+
+func TestHashiCorpVaultKeyring(t *testing.T) {
+	ts := newFakeHashiCorpVault(t)
+	defer ts.Close()
+
+	k := &vault.HashiCorpVaultKeyring{Address: ts.URL, Mount: "secret", Prefix: "aws-vault", Token: "root-token"}
+
+	keys, err := k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("Expected no keys, got %v", keys)
+	}
+
+	for _, key := range []string{"work", "session,d29yaw,,1572281751"} {
+		if err = k.Set(keyring.Item{Key: key, Data: []byte(`{"AccessKeyID":"AKIAEXAMPLE"}`), Label: "aws-vault (" + key + ")"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	item, err := k.Get("work")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(item.Data) != `{"AccessKeyID":"AKIAEXAMPLE"}` || item.Label != "aws-vault (work)" {
+		t.Fatalf("Unexpected item %+v", item)
+	}
+
+	keys, err = k.Keys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(keys)
+	if strings.Join(keys, " ") != "session,d29yaw,,1572281751 work" {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+
+	if err = k.Remove("work"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = k.Get("work"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound, got %v", err)
+	}
+}
+
+func TestHashiCorpVaultKeyringAppRole(t *testing.T) {
+	ts := newFakeHashiCorpVault(t)
+	defer ts.Close()
+
+	k := &vault.HashiCorpVaultKeyring{Address: ts.URL, Mount: "secret", Prefix: "aws-vault", RoleID: "role", SecretID: "secret"}
+	if err := k.Set(keyring.Item{Key: "work", Data: []byte("{}")}); err != nil {
+		t.Fatal(err)
+	}
+
+	k = &vault.HashiCorpVaultKeyring{Address: ts.URL, Mount: "secret", Prefix: "aws-vault", Token: "wrong"}
+	if _, err := k.Get("work"); err == nil || !strings.Contains(err.Error(), "permission denied") {
+		t.Fatalf("Expected a permission denied error, got %v", err)
+	}
+}
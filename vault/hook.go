@@ -0,0 +1,106 @@
+package vault
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+// HookEvent is an event that a Hook is notified of
+type HookEvent string
+
+const (
+	// HookEventRefresh is sent when new temporary credentials are generated
+	HookEventRefresh HookEvent = "refresh"
+
+	// HookEventMfaPrompt is sent before prompting for an MFA token
+	HookEventMfaPrompt HookEvent = "mfa-prompt"
+
+	// HookEventRotate is sent to on_rotate_cmd when rotate has created a new access key
+	HookEventRotate HookEvent = "rotate"
+)
+
+// Hook is notified by providers when credentials are refreshed or an MFA token is prompted for
+type Hook interface {
+	Notify(event HookEvent)
+}
+
+// NewHook returns the hook configured for the profile, or nil if there isn't one
+func NewHook(config *Config) Hook {
+	if config.OnRefreshCmd == "" {
+		return nil
+	}
+	return &CommandHook{
+		Command:     config.OnRefreshCmd,
+		ProfileName: config.ProfileName,
+	}
+}
+
+func notifyHook(h Hook, event HookEvent) {
+	if h != nil {
+		h.Notify(event)
+	}
+}
+
+// CommandHook runs a shell command for each event, passing the event details in the environment
+type CommandHook struct {
+	Command     string
+	ProfileName string
+}
+
+// Notify runs the command. Failures are logged but otherwise ignored
+func (h *CommandHook) Notify(event HookEvent) {
+	cmd := shellCommand(h.Command)
+	cmd.Env = append(os.Environ(),
+		"AWS_VAULT_HOOK_EVENT="+string(event),
+		"AWS_VAULT_HOOK_PROFILE="+h.ProfileName,
+	)
+	cmd.Stderr = os.Stderr
+
+	log.Printf("Running on_refresh_cmd for %s event on profile %s", event, h.ProfileName)
+	if err := cmd.Run(); err != nil {
+		log.Printf("on_refresh_cmd failed: %v", err)
+	}
+}
+
+// RunRotateHook runs on_rotate_cmd with the new access key on stdin as credential_process JSON, so
+// it can be copied to other stores. Unlike on_refresh_cmd, a failure is returned
+func RunRotateHook(command, profileName string, val credentials.Value) error {
+	b, err := json.Marshal(struct {
+		Version         int
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+	}{1, val.AccessKeyID, val.SecretAccessKey})
+	if err != nil {
+		return err
+	}
+
+	cmd := shellCommand(command)
+	cmd.Env = append(os.Environ(),
+		"AWS_VAULT_HOOK_EVENT="+string(HookEventRotate),
+		"AWS_VAULT_HOOK_PROFILE="+profileName,
+	)
+	cmd.Stdin = bytes.NewReader(b)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	log.Printf("Running on_rotate_cmd for profile %s", profileName)
+	if err = cmd.Run(); err != nil {
+		return fmt.Errorf("on_rotate_cmd failed: %w", err)
+	}
+	return nil
+}
+
+// shellCommand returns a command that runs command with the platform's shell
+func shellCommand(command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.Command("cmd", "/C", command)
+	}
+	return exec.Command("/bin/sh", "-c", command)
+}
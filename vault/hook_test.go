@@ -0,0 +1,44 @@
+package vault_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+)
+
+func TestRunRotateHookPassesTheNewCredentials(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell command")
+	}
+
+	dir, err := ioutil.TempDir("", "aws-vault-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	out := filepath.Join(dir, "out")
+	err = vault.RunRotateHook(`(echo "$AWS_VAULT_HOOK_EVENT $AWS_VAULT_HOOK_PROFILE"; cat) > `+out, "llamas",
+		credentials.Value{AccessKeyID: "AKIAEXAMPLE", SecretAccessKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "rotate llamas\n" + `{"Version":1,"AccessKeyId":"AKIAEXAMPLE","SecretAccessKey":"secret"}`
+	if string(b) != expected {
+		t.Fatalf("Expected %q, got %q", expected, b)
+	}
+
+	if err = vault.RunRotateHook("exit 1", "llamas", credentials.Value{}); err == nil {
+		t.Fatal("Expected a failing on_rotate_cmd to return an error")
+	}
+}
@@ -2,7 +2,9 @@ package vault
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
 	"github.com/99designs/keyring"
 	"github.com/aws/aws-sdk-go/aws/credentials"
@@ -18,7 +20,7 @@ func (ck *CredentialKeyring) CredentialsKeys() (credentialsNames []string, err e
 		return credentialsNames, err
 	}
 	for _, keyName := range allKeys {
-		if !IsSessionKey(keyName) {
+		if !IsSessionKey(keyName) && !IsSSOTokenKey(keyName) {
 			credentialsNames = append(credentialsNames, keyName)
 		}
 	}
@@ -30,6 +32,15 @@ func (ck *CredentialKeyring) Sessions() *KeyringSessions {
 }
 
 func (ck *CredentialKeyring) Has(credentialsName string) (bool, error) {
+	// backends that can look up a single item's metadata save listing every key. Some backends
+	// return empty metadata whether or not the item exists, so only metadata with something in it counts
+	md, err := ck.Keyring.GetMetadata(credentialsName)
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return false, nil
+	} else if err == nil && (md.Item != nil || !md.ModificationTime.IsZero()) {
+		return true, nil
+	}
+
 	allKeys, err := ck.Keyring.Keys()
 	if err != nil {
 		return false, err
@@ -42,19 +53,50 @@ func (ck *CredentialKeyring) Has(credentialsName string) (bool, error) {
 	return false, nil
 }
 
+// storedCredentials is the data stored in the keyring for credentials
+type storedCredentials struct {
+	credentials.Value
+
+	// Expiration is set for temporary credentials that include a session token
+	Expiration *time.Time `json:",omitempty"`
+}
+
 func (ck *CredentialKeyring) Get(credentialsName string) (val credentials.Value, err error) {
+	val, _, err = ck.GetWithExpiration(credentialsName)
+	return val, err
+}
+
+// GetWithExpiration returns the stored credentials, and their expiration if they are temporary
+func (ck *CredentialKeyring) GetWithExpiration(credentialsName string) (val credentials.Value, expiration time.Time, err error) {
+	defer traceStep("keyring read %s", credentialsName)()
+
 	item, err := ck.Keyring.Get(credentialsName)
 	if err != nil {
-		return val, err
+		return val, expiration, err
 	}
-	if err = json.Unmarshal(item.Data, &val); err != nil {
-		return val, fmt.Errorf("Invalid data in keyring: %v", err)
+	var stored storedCredentials
+	if err = json.Unmarshal(item.Data, &stored); err != nil {
+		return val, expiration, fmt.Errorf("Invalid data in keyring: %v", err)
 	}
-	return val, err
+	if stored.Expiration != nil {
+		expiration = *stored.Expiration
+	}
+	return stored.Value, expiration, nil
 }
 
 func (ck *CredentialKeyring) Set(credentialsName string, val credentials.Value) error {
-	bytes, err := json.Marshal(val)
+	return ck.SetWithExpiration(credentialsName, val, time.Time{})
+}
+
+// SetWithExpiration stores credentials, along with an expiration for temporary credentials. A zero
+// expiration is not stored
+func (ck *CredentialKeyring) SetWithExpiration(credentialsName string, val credentials.Value, expiration time.Time) error {
+	stored := storedCredentials{Value: val}
+	if !expiration.IsZero() {
+		stored.Expiration = &expiration
+	}
+
+	bytes, err := json.Marshal(stored)
 	if err != nil {
 		return err
 	}
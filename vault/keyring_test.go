@@ -0,0 +1,95 @@
+package vault_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+// listingKeyring can't look up metadata, so CredentialKeyring.Has has to list every key
+type listingKeyring struct {
+	keyring.Keyring
+}
+
+func (k listingKeyring) GetMetadata(string) (keyring.Metadata, error) {
+	return keyring.Metadata{}, keyring.ErrMetadataNeedsCredentials
+}
+
+func TestCredentialKeyringHas(t *testing.T) {
+	for _, ck := range []*vault.CredentialKeyring{
+		vault.NewCredentialStoreKeyring(mapStore{"llamas": nil}),
+		{Keyring: listingKeyring{keyring.NewArrayKeyring([]keyring.Item{{Key: "llamas"}})}},
+	} {
+		if ok, err := ck.Has("llamas"); err != nil || !ok {
+			t.Fatalf("Expected llamas to be stored, got %v, %v", ok, err)
+		}
+		if ok, err := ck.Has("alpacas"); err != nil || ok {
+			t.Fatalf("Expected alpacas not to be stored, got %v, %v", ok, err)
+		}
+	}
+}
+
+func benchmarkCredentialKeyringHas(b *testing.B, wrap func(keyring.Keyring) keyring.Keyring) {
+	dir, err := ioutil.TempDir("", "aws-vault-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	kr, err := keyring.Open(keyring.Config{
+		AllowedBackends:  []keyring.BackendType{keyring.FileBackend},
+		FileDir:          dir,
+		FilePasswordFunc: func(string) (string, error) { return "passphrase", nil },
+	})
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Has doesn't read the items, so they don't need to be encrypted
+	for i := 0; i < 200; i++ {
+		if err = ioutil.WriteFile(filepath.Join(dir, fmt.Sprintf("profile%d", i)), nil, 0600); err != nil {
+			b.Fatal(err)
+		}
+	}
+	ck := &vault.CredentialKeyring{Keyring: wrap(kr)}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if ok, err := ck.Has("profile100"); err != nil || !ok {
+			b.Fatalf("Expected profile100 to be stored, got %v, %v", ok, err)
+		}
+	}
+}
+
+// wrappingKeyring wraps the error for a missing item, and can't list its keys
+type wrappingKeyring struct {
+	keyring.Keyring
+}
+
+func (k wrappingKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	return keyring.Metadata{}, fmt.Errorf("Can't read %s: %w", key, keyring.ErrKeyNotFound)
+}
+
+func (k wrappingKeyring) Keys() ([]string, error) {
+	return nil, errors.New("Listing keys isn't supported")
+}
+
+func TestCredentialKeyringHasWithAWrappedKeyNotFound(t *testing.T) {
+	ck := &vault.CredentialKeyring{Keyring: wrappingKeyring{keyring.NewArrayKeyring(nil)}}
+	if ok, err := ck.Has("alpacas"); err != nil || ok {
+		t.Fatalf("Expected alpacas not to be stored, got %v, %v", ok, err)
+	}
+}
+
+func BenchmarkCredentialKeyringHas(b *testing.B) {
+	benchmarkCredentialKeyringHas(b, func(kr keyring.Keyring) keyring.Keyring { return kr })
+}
+
+func BenchmarkCredentialKeyringHasListingKeys(b *testing.B) {
+	benchmarkCredentialKeyringHas(b, func(kr keyring.Keyring) keyring.Keyring { return listingKeyring{kr} })
+}
@@ -1,22 +1,66 @@
 package vault
 
 import (
+	"fmt"
 	"log"
+	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 // KeyringProvider stores and retrieves master credentials
 type KeyringProvider struct {
 	Keyring         *CredentialKeyring
 	CredentialsName string
+
+	// ValidateSession, if set, is used to check the credentials work with GetCallerIdentity
+	// before they are returned
+	ValidateSession *session.Session
+
+	// expiration is set when the stored credentials are temporary
+	expiration time.Time
 }
 
 func (p *KeyringProvider) IsExpired() bool {
-	return false
+	return !p.expiration.IsZero() && time.Now().After(p.expiration)
 }
 
 func (p *KeyringProvider) Retrieve() (val credentials.Value, err error) {
 	log.Printf("Looking up keyring for '%s'", p.CredentialsName)
-	return p.Keyring.Get(p.CredentialsName)
+	val, p.expiration, err = p.Keyring.GetWithExpiration(p.CredentialsName)
+	if err != nil {
+		return val, err
+	}
+
+	if p.IsExpired() {
+		return credentials.Value{}, fmt.Errorf("Stored credentials for '%s' expired at %s", p.CredentialsName, p.expiration.Format(time.RFC3339))
+	}
+
+	if p.ValidateSession != nil {
+		if err = p.validate(val); err != nil {
+			return credentials.Value{}, err
+		}
+	}
+
+	return val, nil
+}
+
+// validate calls GetCallerIdentity with the credentials, so revoked credentials fail with a clear
+// error rather than a signature error from somewhere further along the chain
+func (p *KeyringProvider) validate(val credentials.Value) error {
+	defer traceStep("validate stored credentials for %s", p.CredentialsName)()
+
+	stsClient := sts.New(p.ValidateSession, &aws.Config{Credentials: credentials.NewStaticCredentialsFromCreds(val)})
+	identity, err := stsClient.GetCallerIdentity(&sts.GetCallerIdentityInput{})
+	if isNetworkError(err) {
+		return fmt.Errorf("Couldn't validate the stored credentials for profile %s: %w", p.CredentialsName, err)
+	} else if err != nil {
+		return fmt.Errorf("stored credentials for profile %s are invalid (revoked?): %w", p.CredentialsName, err)
+	}
+
+	log.Printf("Validated the stored credentials for %s as %s", p.CredentialsName, aws.StringValue(identity.Arn))
+	return nil
 }
@@ -0,0 +1,67 @@
+package vault_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+func TestKeyringProviderValidatesTheStoredCredentials(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		if action := r.PostForm.Get("Action"); action != "GetCallerIdentity" {
+			t.Fatalf("Unexpected action %q", action)
+		}
+		if !strings.Contains(r.Header.Get("Authorization"), "AKIAREVOKED") {
+			fmt.Fprint(w, `<GetCallerIdentityResponse><GetCallerIdentityResult>
+<Arn>arn:aws:iam::123456789012:user/alice</Arn><Account>123456789012</Account><UserId>AIDAEXAMPLE</UserId>
+</GetCallerIdentityResult></GetCallerIdentityResponse>`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<ErrorResponse><Error><Code>InvalidClientTokenId</Code><Message>The security token included in the request is invalid.</Message></Error></ErrorResponse>`)
+	}))
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.AnonymousCredentials,
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	ck := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "valid", Data: []byte(`{"AccessKeyID":"AKIAEXAMPLE","SecretAccessKey":"secret"}`)},
+		{Key: "revoked", Data: []byte(`{"AccessKeyID":"AKIAREVOKED","SecretAccessKey":"secret"}`)},
+	})}
+
+	p := vault.NewMasterCredentialsProvider(ck, "valid")
+	p.ValidateSession = sess
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "AKIAEXAMPLE" {
+		t.Fatalf("Expected the stored credentials, got %q", val.AccessKeyID)
+	}
+
+	p = vault.NewMasterCredentialsProvider(ck, "revoked")
+	p.ValidateSession = sess
+	_, err = p.Retrieve()
+	if err == nil || !strings.Contains(err.Error(), "stored credentials for profile revoked are invalid (revoked?)") {
+		t.Fatalf("Expected an error saying the stored credentials are invalid, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "InvalidClientTokenId") {
+		t.Fatalf("Expected the STS error to be included, got %v", err)
+	}
+}
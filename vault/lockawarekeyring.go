@@ -0,0 +1,64 @@
+package vault
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/99designs/keyring"
+)
+
+// ErrKeyringLocked is returned when the keyring is locked and wasn't unlocked
+var ErrKeyringLocked = errors.New("keyring is locked; unlock it and retry")
+
+// keyringLockedMessages are found in the errors backends return when the keyring is locked
+var keyringLockedMessages = []string{
+	// Secret Service, e.g. gnome-keyring when the unlock prompt is dismissed
+	"org.freedesktop.Secret.Error.IsLocked",
+	"Cannot get secret of a locked object",
+
+	// macOS keychain when it's locked and can't prompt, e.g. over ssh
+	"User interaction is not allowed",
+}
+
+// LockAwareKeyring wraps a keyring so that errors caused by the keyring being locked are
+// returned as ErrKeyringLocked, rather than the backend's own error
+type LockAwareKeyring struct {
+	keyring.Keyring
+}
+
+func (k LockAwareKeyring) Get(key string) (keyring.Item, error) {
+	item, err := k.Keyring.Get(key)
+	return item, lockedError(err)
+}
+
+func (k LockAwareKeyring) GetMetadata(key string) (keyring.Metadata, error) {
+	md, err := k.Keyring.GetMetadata(key)
+	return md, lockedError(err)
+}
+
+func (k LockAwareKeyring) Set(item keyring.Item) error {
+	return lockedError(k.Keyring.Set(item))
+}
+
+func (k LockAwareKeyring) Remove(key string) error {
+	return lockedError(k.Keyring.Remove(key))
+}
+
+func (k LockAwareKeyring) Keys() ([]string, error) {
+	keys, err := k.Keyring.Keys()
+	return keys, lockedError(err)
+}
+
+// lockedError returns ErrKeyringLocked, wrapping the backend error, if err was caused by the keyring being locked
+func lockedError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, msg := range keyringLockedMessages {
+		if strings.Contains(err.Error(), msg) {
+			return fmt.Errorf("%w (%v)", ErrKeyringLocked, err)
+		}
+	}
+	return err
+}
@@ -0,0 +1,33 @@
+package vault_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+type lockedKeyring struct {
+	keyring.Keyring
+}
+
+func (k lockedKeyring) Get(key string) (keyring.Item, error) {
+	return keyring.Item{}, errors.New("Cannot get secret of a locked object")
+}
+
+func TestLockAwareKeyringReturnsErrKeyringLocked(t *testing.T) {
+	k := &vault.CredentialKeyring{Keyring: vault.LockAwareKeyring{
+		Keyring: lockedKeyring{keyring.NewArrayKeyring(nil)},
+	}}
+
+	_, err := k.Get("llamas")
+	if !errors.Is(err, vault.ErrKeyringLocked) {
+		t.Fatalf("Expected ErrKeyringLocked, got %v", err)
+	}
+
+	_, err = k.Keyring.Keys()
+	if err != nil {
+		t.Fatalf("Expected other calls to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,59 @@
+package vault
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+)
+
+// isAutoMfaSerial returns whether an mfa_serial asks for the MFA device to be discovered, with
+// the value auto or Automatic
+func isAutoMfaSerial(value string) bool {
+	return strings.EqualFold(value, "auto") || strings.EqualFold(value, "automatic")
+}
+
+// mfaSerialResolver returns a resolver for an mfa_serial that has to be looked up in AWS with the
+// session's credentials, or nil if it can be used as it is. When it's auto, the MFA device of the
+// IAM user is discovered, and references are resolved with ResolveConfigRef
+func mfaSerialResolver(value string, sess *session.Session) func() (string, error) {
+	switch {
+	case isAutoMfaSerial(value):
+		return func() (string, error) {
+			serial, err := DiscoverMfaSerial(iam.New(sess))
+			if err != nil {
+				return "", fmt.Errorf("mfa_serial is %s: %w", value, err)
+			}
+			return serial, nil
+		}
+	case isConfigRef(value):
+		return func() (string, error) {
+			return ResolveConfigRef(value, sess)
+		}
+	default:
+		return nil
+	}
+}
+
+// DiscoverMfaSerial returns the serial of the MFA device of the IAM user the client's credentials
+// belong to, with ListMFADevices
+func DiscoverMfaSerial(client *iam.IAM) (string, error) {
+	resp, err := client.ListMFADevices(&iam.ListMFADevicesInput{})
+	if err != nil {
+		return "", fmt.Errorf("Failed to discover the MFA device: %w", err)
+	}
+
+	switch len(resp.MFADevices) {
+	case 0:
+		return "", &ConfigError{fmt.Errorf("no MFA device is attached to the IAM user")}
+	case 1:
+		serial := aws.StringValue(resp.MFADevices[0].SerialNumber)
+		log.Printf("Discovered MFA device %s", serial)
+		return serial, nil
+	default:
+		return "", &ConfigError{fmt.Errorf("the IAM user has %d MFA devices, set mfa_serial to one of them", len(resp.MFADevices))}
+	}
+}
@@ -0,0 +1,142 @@
+package vault_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func newFakeMfaSession(t *testing.T, serials []string, serialNumber *string) (*session.Session, func()) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Fatal(err)
+		}
+		switch r.PostForm.Get("Action") {
+		case "ListMFADevices":
+			var devices string
+			for _, serial := range serials {
+				devices += fmt.Sprintf(`<member><UserName>alice</UserName><SerialNumber>%s</SerialNumber>
+<EnableDate>2020-01-01T00:00:00Z</EnableDate></member>`, serial)
+			}
+			fmt.Fprintf(w, `<ListMFADevicesResponse><ListMFADevicesResult><MFADevices>%s</MFADevices>
+<IsTruncated>false</IsTruncated></ListMFADevicesResult></ListMFADevicesResponse>`, devices)
+		case "GetCallerIdentity":
+			fmt.Fprint(w, callerIdentityResponse("arn:aws:iam::123456789012:user/alice"))
+		case "GetSessionToken":
+			*serialNumber = r.PostForm.Get("SerialNumber")
+			fmt.Fprintf(w, `<GetSessionTokenResponse><GetSessionTokenResult><Credentials>
+<AccessKeyId>ASIANEW</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			t.Fatalf("Unexpected action %q", r.PostForm.Get("Action"))
+		}
+	}))
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+	return sess, ts.Close
+}
+
+func TestDiscoverMfaSerial(t *testing.T) {
+	const serial = "arn:aws:iam::123456789012:mfa/alice"
+
+	var serialNumber string
+	sess, closeServer := newFakeMfaSession(t, []string{serial}, &serialNumber)
+	defer closeServer()
+	discovered, err := vault.DiscoverMfaSerial(iam.New(sess))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovered != serial {
+		t.Fatalf("Expected %q, got %q", serial, discovered)
+	}
+
+	for _, serials := range [][]string{nil, {serial, serial + "-2"}} {
+		sess, closeServer := newFakeMfaSession(t, serials, &serialNumber)
+		defer closeServer()
+		_, err = vault.DiscoverMfaSerial(iam.New(sess))
+		var configErr *vault.ConfigError
+		if !errors.As(err, &configErr) {
+			t.Fatalf("Expected a ConfigError with %d MFA devices, got %v", len(serials), err)
+		}
+	}
+}
+
+func TestMfaSerialIsOnlyResolvedForNewSessions(t *testing.T) {
+	const serial = "arn:aws:iam::123456789012:mfa/alice"
+
+	var serialNumber string
+	sess, closeServer := newFakeMfaSession(t, []string{serial}, &serialNumber)
+	defer closeServer()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err := k.Sessions().Store("llamas", "auto", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIACACHED"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolves := 0
+	p := &vault.CachedSessionTokenProvider{
+		CredentialsName: "llamas",
+		Region:          "us-east-1",
+		Keyring:         k,
+		Provider: &vault.SessionTokenProvider{
+			StsClient: sts.New(sess),
+			Duration:  time.Hour,
+			Mfa: vault.Mfa{
+				MfaSerial: "auto",
+				MfaToken:  "123456",
+				MfaSerialResolver: func() (string, error) {
+					resolves++
+					return vault.DiscoverMfaSerial(iam.New(sess))
+				},
+			},
+		},
+	}
+
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIACACHED" || resolves != 0 {
+		t.Fatalf("Expected the cached session without resolving the MFA serial, got %q after %d resolves", val.AccessKeyID, resolves)
+	}
+
+	vault.Refresh = true
+	defer func() { vault.Refresh = false }()
+	if val, err = p.Retrieve(); err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIANEW" || resolves != 1 {
+		t.Fatalf("Expected a new session after resolving the MFA serial once, got %q after %d resolves", val.AccessKeyID, resolves)
+	}
+	if serialNumber != serial {
+		t.Fatalf("Expected GetSessionToken with the discovered serial %q, got %q", serial, serialNumber)
+	}
+	vault.Refresh = false
+
+	// the new session is cached under the configured mfa_serial, so it's found again without resolving it
+	if _, err = k.Sessions().Retrieve("llamas", "auto", "us-east-1"); err != nil {
+		t.Fatalf("Expected the session to be cached under the configured mfa_serial, got %v", err)
+	}
+}
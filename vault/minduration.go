@@ -0,0 +1,71 @@
+package vault
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// NewTempCredentialsWithMinDuration returns credentials for the config that are valid for at least
+// minDuration. If cached sessions expire sooner they are deleted and new sessions are created, and an
+// error is returned if even those can't last long enough. Waiting for an MFA token or STS stops when ctx is done
+func NewTempCredentialsWithMinDuration(ctx context.Context, config *Config, k *CredentialKeyring, minDuration time.Duration) (*ContextCredentials, error) {
+	for c := config; c != nil; c = c.SourceProfile {
+		if c.AssumeRoleDuration < minDuration {
+			c.AssumeRoleDuration = minDuration
+		}
+		if c.GetSessionTokenDuration < minDuration {
+			c.GetSessionTokenDuration = minDuration
+		}
+		if c.ChainedGetSessionTokenDuration < minDuration {
+			c.ChainedGetSessionTokenDuration = minDuration
+		}
+	}
+
+	creds, err := NewTempCredentialsWithContext(config, k)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err := remainingLifetime(ctx, creds)
+	if err != nil || remaining >= minDuration {
+		return creds, err
+	}
+
+	log.Printf("Credentials for %s expire in %s, less than the minimum of %s, refreshing", config.ProfileName, remaining.Round(time.Second), minDuration)
+	if err = deleteChainSessions(config, k); err != nil {
+		return nil, err
+	}
+
+	creds, err = NewTempCredentialsWithContext(config, k)
+	if err != nil {
+		return nil, err
+	}
+
+	remaining, err = remainingLifetime(ctx, creds)
+	if err != nil {
+		return nil, err
+	}
+	if remaining < minDuration {
+		return nil, fmt.Errorf("Credentials for %s expire in %s, which is less than the minimum duration of %s. The role's maximum session duration may be too low",
+			config.ProfileName, remaining.Round(time.Second), minDuration)
+	}
+
+	return creds, nil
+}
+
+// remainingLifetime returns how long the credentials are valid for. Credentials that don't expire
+// return the maximum duration
+func remainingLifetime(ctx context.Context, creds *ContextCredentials) (time.Duration, error) {
+	if _, err := creds.GetWithContext(ctx); err != nil {
+		return 0, err
+	}
+
+	expiresAt, err := creds.ExpiresAt()
+	if err != nil || expiresAt.IsZero() {
+		return time.Duration(1<<63 - 1), nil
+	}
+
+	return time.Until(expiresAt), nil
+}
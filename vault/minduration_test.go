@@ -0,0 +1,37 @@
+package vault_test
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func credentialProcessExpiringIn(d time.Duration) string {
+	return fmt.Sprintf(`echo '{"Version":1,"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","SessionToken":"token","Expiration":"%s"}'`,
+		time.Now().Add(d).UTC().Format(time.RFC3339))
+}
+
+func TestNewTempCredentialsWithMinDuration(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell command")
+	}
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	config := &vault.Config{ProfileName: "long", CredentialProcess: credentialProcessExpiringIn(2 * time.Hour)}
+	if _, err := vault.NewTempCredentialsWithMinDuration(context.Background(), config, k, 50*time.Minute); err != nil {
+		t.Fatalf("Expected credentials lasting 2h to meet a minimum of 50m: %v", err)
+	}
+
+	config = &vault.Config{ProfileName: "short", CredentialProcess: credentialProcessExpiringIn(20 * time.Minute)}
+	_, err := vault.NewTempCredentialsWithMinDuration(context.Background(), config, k, 50*time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "less than the minimum duration") {
+		t.Fatalf("Expected credentials lasting 20m to fail a minimum of 50m, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/arn"
+)
+
+// RoleARN is a parsed IAM role ARN
+type RoleARN struct {
+	AccountID string
+
+	// Path is the role's path, e.g. /team/dev/ for arn:aws:iam::123456789012:role/team/dev/Admin
+	Path string
+
+	// Name is the role name without its path
+	Name string
+}
+
+// ParseRoleARN parses an IAM role ARN, which can include a path
+func ParseRoleARN(s string) (RoleARN, error) {
+	a, err := arn.Parse(s)
+	if err != nil {
+		return RoleARN{}, err
+	}
+	if a.Service != "iam" || !strings.HasPrefix(a.Resource, "role/") {
+		return RoleARN{}, fmt.Errorf("%s isn't a role ARN", s)
+	}
+
+	resource := strings.TrimPrefix(a.Resource, "role")
+	i := strings.LastIndex(resource, "/")
+
+	return RoleARN{
+		AccountID: a.AccountID,
+		Path:      resource[:i+1],
+		Name:      resource[i+1:],
+	}, nil
+}
@@ -0,0 +1,40 @@
+package vault_test
+
+import (
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+)
+
+func TestParseRoleARN(t *testing.T) {
+	var testCases = []struct {
+		ARN  string
+		Role vault.RoleARN
+	}{
+		{"arn:aws:iam::123456789012:role/Admin", vault.RoleARN{AccountID: "123456789012", Path: "/", Name: "Admin"}},
+		{"arn:aws:iam::123456789012:role/team/dev/Admin", vault.RoleARN{AccountID: "123456789012", Path: "/team/dev/", Name: "Admin"}},
+		{"arn:aws-cn:iam::123456789012:role/service-role/app", vault.RoleARN{AccountID: "123456789012", Path: "/service-role/", Name: "app"}},
+	}
+
+	for _, tc := range testCases {
+		role, err := vault.ParseRoleARN(tc.ARN)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != tc.Role {
+			t.Fatalf("Expected %s to parse as %+v, got %+v", tc.ARN, tc.Role, role)
+		}
+	}
+}
+
+func TestParseRoleARNRejectsOtherARNs(t *testing.T) {
+	for _, s := range []string{
+		"arn:aws:iam::123456789012:user/team/alice",
+		"arn:aws:sts::123456789012:assumed-role/Admin/alice",
+		"role/Admin",
+	} {
+		if _, err := vault.ParseRoleARN(s); err == nil {
+			t.Fatalf("Expected an error parsing %s", s)
+		}
+	}
+}
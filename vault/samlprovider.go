@@ -0,0 +1,93 @@
+package vault
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// SamlProvider retrieves temporary credentials from STS using AssumeRoleWithSAML
+type SamlProvider struct {
+	StsClient    *sts.STS
+	RoleARN      string
+	PrincipalARN string
+	Duration     time.Duration
+	ExpiryWindow time.Duration
+
+	// AssertionCmd is a command that outputs the base64 encoded SAML assertion
+	AssertionCmd string
+
+	// AssertionFile is read for the base64 encoded SAML assertion when AssertionCmd isn't set
+	AssertionFile string
+
+	Hook Hook
+	credentials.Expiry
+}
+
+// Retrieve generates a new set of temporary credentials using STS AssumeRoleWithSAML
+func (p *SamlProvider) Retrieve() (credentials.Value, error) {
+	assertion, err := p.assertion()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	defer traceStep("sts:AssumeRoleWithSAML %s", p.RoleARN)()
+	resp, err := p.StsClient.AssumeRoleWithSAML(&sts.AssumeRoleWithSAMLInput{
+		RoleArn:         aws.String(p.RoleARN),
+		PrincipalArn:    aws.String(p.PrincipalARN),
+		SAMLAssertion:   aws.String(assertion),
+		DurationSeconds: aws.Int64(int64(p.Duration.Seconds())),
+	})
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	log.Printf("Generated credentials %s using AssumeRoleWithSAML, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	notifyHook(p.Hook, HookEventRefresh)
+
+	p.SetExpiration(*resp.Credentials.Expiration, p.ExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+	}, nil
+}
+
+func (p *SamlProvider) assertion() (string, error) {
+	var b []byte
+	var err error
+
+	if p.AssertionCmd != "" {
+		var stdout bytes.Buffer
+		cmd := shellCommand(p.AssertionCmd)
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+
+		log.Printf("Running saml_assertion_cmd for %s", p.RoleARN)
+		if err = cmd.Run(); err != nil {
+			return "", fmt.Errorf("saml_assertion_cmd failed: %w", err)
+		}
+		b = stdout.Bytes()
+	} else {
+		log.Printf("Reading SAML assertion from %s", p.AssertionFile)
+		if b, err = ioutil.ReadFile(p.AssertionFile); err != nil {
+			return "", fmt.Errorf("Error reading saml_assertion_file: %w", err)
+		}
+	}
+
+	assertion := strings.TrimSpace(string(b))
+	if assertion == "" {
+		return "", fmt.Errorf("No SAML assertion was provided for %s", p.RoleARN)
+	}
+
+	return assertion, nil
+}
@@ -0,0 +1,47 @@
+package vault_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+)
+
+func TestSamlProviderIsUsedForSamlProfiles(t *testing.T) {
+	f := newConfigFile(t, []byte(`[profile saml]
+region=us-east-1
+role_arn=arn:aws:iam::123456789012:role/admin
+saml_provider_arn=arn:aws:iam::123456789012:saml-provider/okta
+saml_assertion_cmd=get-saml-assertion
+`))
+	defer os.Remove(f)
+
+	configFile, err := vault.LoadConfig(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	configLoader := &vault.ConfigLoader{File: configFile}
+	config, err := configLoader.LoadFromProfile("saml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	provider, err := vault.NewTempCredentialsProvider(config, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, ok := provider.(*vault.SamlProvider)
+	if !ok {
+		t.Fatalf("Expected a SamlProvider, got %T", provider)
+	}
+	if p.PrincipalARN != "arn:aws:iam::123456789012:saml-provider/okta" {
+		t.Fatalf("Unexpected principal ARN %q", p.PrincipalARN)
+	}
+	if p.AssertionCmd != "get-saml-assertion" {
+		t.Fatalf("Unexpected assertion command %q", p.AssertionCmd)
+	}
+}
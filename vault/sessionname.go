@@ -0,0 +1,139 @@
+package vault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// maxRoleSessionNameLength is the longest RoleSessionName accepted by AssumeRole
+const maxRoleSessionNameLength = 64
+
+var invalidRoleSessionNameChars = regexp.MustCompile(`[^\w+=,.@-]`)
+
+// defaultRoleSessionName is the role session name used without a role_session_name, like
+// alice@account-alias, naming the identity of the source credentials and its account
+const defaultRoleSessionName = "{{.CallerName}}@{{.AccountAlias}}"
+
+// roleSessionNameData is what a role_session_name template is expanded with. The identity of the
+// source credentials is only looked up if the template uses it
+type roleSessionNameData struct {
+	Env       map[string]string
+	AccountID string
+	RoleName  string
+
+	ctx       context.Context
+	stsClient *sts.STS
+	iamClient *iam.IAM
+	caller    *arn.ARN
+}
+
+// callerARN returns the ARN of the identity of the source credentials
+func (d *roleSessionNameData) callerARN() (arn.ARN, error) {
+	if d.caller != nil {
+		return *d.caller, nil
+	}
+	if d.stsClient == nil {
+		return arn.ARN{}, errors.New("no STS client to look up the caller identity")
+	}
+
+	identity, err := d.stsClient.GetCallerIdentityWithContext(d.ctx, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return arn.ARN{}, err
+	}
+	callerARN, err := arn.Parse(aws.StringValue(identity.Arn))
+	if err != nil {
+		return arn.ARN{}, err
+	}
+	d.caller = &callerARN
+	return callerARN, nil
+}
+
+// CallerName returns the user name of the source credentials, or the session name of an assumed role
+func (d *roleSessionNameData) CallerName() (string, error) {
+	callerARN, err := d.callerARN()
+	if err != nil {
+		return "", err
+	}
+
+	// the last part of the resource is the user name, or the session name of an assumed role
+	resourceParts := strings.Split(callerARN.Resource, "/")
+	return resourceParts[len(resourceParts)-1], nil
+}
+
+// AccountAlias returns the alias of the account of the source credentials. The account id is used
+// when the alias can't be listed
+func (d *roleSessionNameData) AccountAlias() (string, error) {
+	callerARN, err := d.callerARN()
+	if err != nil {
+		return "", err
+	}
+
+	if d.iamClient != nil {
+		aliases, err := d.iamClient.ListAccountAliasesWithContext(d.ctx, &iam.ListAccountAliasesInput{})
+		if err == nil && len(aliases.AccountAliases) > 0 {
+			return aws.StringValue(aliases.AccountAliases[0]), nil
+		}
+	}
+	return callerARN.AccountID, nil
+}
+
+// ValidateRoleSessionName checks name is a RoleSessionName that AssumeRole accepts
+func ValidateRoleSessionName(name string) error {
+	if len(name) < 2 || len(name) > maxRoleSessionNameLength {
+		return fmt.Errorf("role session name %q must be 2 to %d characters", name, maxRoleSessionNameLength)
+	}
+	if invalidRoleSessionNameChars.MatchString(name) {
+		return fmt.Errorf("role session name %q can only contain letters, numbers and =,.@-_+", name)
+	}
+	return nil
+}
+
+// sanitizeRoleSessionName replaces characters AssumeRole doesn't accept and truncates the name to the maximum length
+func sanitizeRoleSessionName(name string) string {
+	name = invalidRoleSessionNameChars.ReplaceAllString(name, "-")
+	if len(name) > maxRoleSessionNameLength {
+		name = name[:maxRoleSessionNameLength]
+	}
+	return name
+}
+
+// expandRoleSessionName expands a role_session_name template, e.g. {{.Env.BUILD_ID}} is replaced by
+// the BUILD_ID environment variable or nothing if it isn't set, then sanitizes the result. The
+// account id and name of the role being assumed are available as {{.AccountID}} and {{.RoleName}},
+// and the identity of the source credentials as {{.CallerName}} and {{.AccountAlias}}
+func expandRoleSessionName(ctx context.Context, text string, roleARN string, stsClient *sts.STS, iamClient *iam.IAM) (string, error) {
+	tmpl, err := template.New("role_session_name").Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("Error parsing role_session_name template: %w", err)
+	}
+
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		if parts := strings.SplitN(kv, "=", 2); len(parts) == 2 {
+			env[parts[0]] = parts[1]
+		}
+	}
+
+	data := &roleSessionNameData{Env: env, ctx: ctx, stsClient: stsClient, iamClient: iamClient}
+	if role, err := ParseRoleARN(roleARN); err == nil {
+		data.AccountID = role.AccountID
+		data.RoleName = role.Name
+	}
+
+	var b strings.Builder
+	if err = tmpl.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("Error expanding role_session_name template: %w", err)
+	}
+
+	return sanitizeRoleSessionName(b.String()), nil
+}
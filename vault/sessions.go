@@ -80,8 +80,21 @@ func (ks KeyringSession) IsExpired() bool {
 	return time.Now().After(ks.Expiration)
 }
 
+// MaxExpiredGrace is the longest allow_expired_grace can be. Expired sessions are kept in the keyring
+// for this long whoever is reading it, so a session kept for one profile's grace period isn't
+// removed by other commands before it's needed
+const MaxExpiredGrace = 24 * time.Hour
+
 type KeyringSessions struct {
 	keyring keyring.Keyring
+
+	// ExpiredGrace is how long after expiring a session is returned by Sessions, so it can be
+	// returned by RetrieveExpired. It can't be longer than MaxExpiredGrace
+	ExpiredGrace time.Duration
+
+	// Owner is stored with sessions, and sessions stored for a different owner aren't retrieved. It
+	// keeps the sessions of people sharing a profile and keyring apart
+	Owner string
 }
 
 func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
@@ -96,13 +109,16 @@ func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
 	for _, k := range keys {
 		if IsSessionKey(k) {
 			ks, err := parseSessionKey(k)
-			if err != nil || ks.IsExpired() {
+			if err != nil || time.Since(ks.Expiration) > MaxExpiredGrace {
 				log.Printf("Session %s is expired, deleting", k)
 				if err := s.keyring.Remove(k); err != nil {
 					log.Printf("Error deleting session: %v", err)
 				}
 				continue
 			}
+			if ks.IsExpired() && time.Since(ks.Expiration) > s.ExpiredGrace {
+				continue
+			}
 
 			sessions = append(sessions, ks)
 		}
@@ -111,8 +127,61 @@ func (s *KeyringSessions) Sessions() ([]KeyringSession, error) {
 	return sessions, nil
 }
 
-// Retrieve searches sessions for specific profile, expects the profile to be provided, not the source
-func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds *sts.Credentials, err error) {
+// AllSessions returns every session in the keyring, including expired ones. Unlike Sessions, nothing is removed
+func (s *KeyringSessions) AllSessions() ([]KeyringSession, error) {
+	keys, err := s.keyring.Keys()
+	if err != nil {
+		return nil, err
+	}
+
+	var sessions []KeyringSession
+	for _, k := range keys {
+		if ks, err := parseSessionKey(k); err == nil {
+			sessions = append(sessions, ks)
+		}
+	}
+	return sessions, nil
+}
+
+// sessionCacheVersion is the version of the data stored for a session, increased when the
+// format changes in a way older versions of aws-vault can't read
+const sessionCacheVersion = 1
+
+// cachedSession is the data stored in the keyring for a session
+type cachedSession struct {
+	sts.Credentials
+
+	// Region is the region of the STS endpoint the session was created with, empty for older sessions
+	Region string `json:",omitempty"`
+
+	// Version is the sessionCacheVersion the session was stored with, zero for sessions stored
+	// before it was added
+	Version int `json:",omitempty"`
+
+	// Owner is the KeyringSessions.Owner the session was stored for
+	Owner string `json:",omitempty"`
+}
+
+// migrateCachedSession upgrades a session stored by an earlier version of aws-vault. It returns
+// false if the session can't be used and should be discarded
+func migrateCachedSession(cached *cachedSession) bool {
+	if cached.Version > sessionCacheVersion {
+		return false
+	}
+	if cached.AccessKeyId == nil || cached.SecretAccessKey == nil || cached.SessionToken == nil || cached.Expiration == nil {
+		return false
+	}
+
+	// version 0 sessions are the same apart from the version, their empty Region matches any region
+	cached.Version = sessionCacheVersion
+	return true
+}
+
+// Retrieve searches sessions for specific profile, expects the profile to be provided, not the source.
+// Sessions created for a different region, or that can't be read, are deleted and the search continues
+func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string, region string) (creds *sts.Credentials, err error) {
+	defer traceStep("session cache lookup %s", profileName)()
+
 	log.Printf("Looking for sessions for %s", profileName)
 	sessions, err := s.Sessions()
 	if err != nil {
@@ -120,15 +189,34 @@ func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds
 	}
 
 	for _, session := range sessions {
-		if session.ProfileName == profileName && session.MfaSerial == mfaSerial {
+		// expired sessions kept for RetrieveExpired aren't returned
+		if session.ProfileName == profileName && session.MfaSerial == mfaSerial && !session.IsExpired() {
 			item, err := s.keyring.Get(session.Key)
 			if err != nil {
 				return creds, err
 			}
 
-			if err = json.Unmarshal(item.Data, &creds); err != nil {
-				return creds, err
+			var cached cachedSession
+			if err = json.Unmarshal(item.Data, &cached); err != nil || !migrateCachedSession(&cached) {
+				log.Printf("Session %q has data this version of aws-vault can't read, deleting", session.Key)
+				if err = s.keyring.Remove(session.Key); err != nil {
+					return nil, err
+				}
+				continue
+			}
+			if cached.Owner != s.Owner {
+				log.Printf("Session %q belongs to someone else, skipping", session.Key)
+				continue
+			}
+
+			if cached.Region != "" && cached.Region != region {
+				log.Printf("Session %q was created in region %q, not %q, deleting", session.Key, cached.Region, region)
+				if err = s.keyring.Remove(session.Key); err != nil {
+					return nil, err
+				}
+				continue
 			}
+			creds = &cached.Credentials
 
 			// double check the actual expiry time
 			if creds.Expiration.Before(time.Now()) {
@@ -145,13 +233,51 @@ func (s *KeyringSessions) Retrieve(profileName string, mfaSerial string) (creds
 	return creds, keyring.ErrKeyNotFound
 }
 
+// RetrieveExpired returns the most recent session for a profile that expired less than ExpiredGrace
+// ago, for when a new session can't be created
+func (s *KeyringSessions) RetrieveExpired(profileName string, mfaSerial string, region string) (*sts.Credentials, error) {
+	sessions, err := s.Sessions()
+	if err != nil {
+		return nil, err
+	}
+
+	var latest *KeyringSession
+	var latestCached cachedSession
+	for i, session := range sessions {
+		if session.ProfileName != profileName || session.MfaSerial != mfaSerial || !session.IsExpired() {
+			continue
+		}
+		if latest != nil && !session.Expiration.After(latest.Expiration) {
+			continue
+		}
+		item, err := s.keyring.Get(session.Key)
+		if err != nil {
+			return nil, err
+		}
+		var cached cachedSession
+		if err = json.Unmarshal(item.Data, &cached); err != nil || !migrateCachedSession(&cached) || cached.Owner != s.Owner {
+			continue
+		}
+		latest = &sessions[i]
+		latestCached = cached
+	}
+	if latest == nil {
+		return nil, keyring.ErrKeyNotFound
+	}
+	if latestCached.Region != "" && latestCached.Region != region {
+		return nil, keyring.ErrKeyNotFound
+	}
+
+	return &latestCached.Credentials, nil
+}
+
 // Store stores a sessions for a specific profile, expects the profile to be provided, not the source
-func (s *KeyringSessions) Store(profileName string, mfaSerial string, session *sts.Credentials) error {
+func (s *KeyringSessions) Store(profileName string, mfaSerial string, region string, session *sts.Credentials) error {
 	if profileName == "" {
 		return fmt.Errorf("Profile name not provided")
 	}
 
-	bytes, err := json.Marshal(session)
+	bytes, err := json.Marshal(cachedSession{Credentials: *session, Region: region, Version: sessionCacheVersion, Owner: s.Owner})
 	if err != nil {
 		return err
 	}
@@ -170,22 +296,60 @@ func (s *KeyringSessions) Store(profileName string, mfaSerial string, session *s
 	})
 }
 
-// Delete deletes any sessions for a specific profile, expects the profile to be provided, not the source
+// Delete deletes the sessions stored for Owner for a specific profile, including expired ones,
+// expects the profile to be provided, not the source
 func (s *KeyringSessions) Delete(profileName string) (n int, err error) {
 	log.Printf("Looking for sessions for %s", profileName)
-	sessions, err := s.Sessions()
+	return s.delete(func(session KeyringSession) bool {
+		return session.ProfileName == profileName
+	}, false)
+}
+
+// DeleteForAllOwners is Delete for the sessions of every owner, for when none of them can be used,
+// such as when they've been revoked
+func (s *KeyringSessions) DeleteForAllOwners(profileName string) (n int, err error) {
+	log.Printf("Looking for sessions for %s", profileName)
+	return s.delete(func(session KeyringSession) bool {
+		return session.ProfileName == profileName
+	}, true)
+}
+
+// DeleteReplaced deletes the sessions stored for Owner for a specific profile and MFA serial, apart
+// from current, once current has been stored to replace them
+func (s *KeyringSessions) DeleteReplaced(profileName string, mfaSerial string, current *sts.Credentials) (n int, err error) {
+	currentKey := formatSessionKey(profileName, mfaSerial, current.Expiration)
+	return s.delete(func(session KeyringSession) bool {
+		return session.ProfileName == profileName && session.MfaSerial == mfaSerial && session.Key != currentKey
+	}, false)
+}
+
+func (s *KeyringSessions) delete(match func(KeyringSession) bool, allOwners bool) (n int, err error) {
+	sessions, err := s.AllSessions()
 	if err != nil {
 		return n, err
 	}
 
 	for _, session := range sessions {
-		if session.ProfileName == profileName {
-			log.Printf("Session %q matches profile %q", session.Key, profileName)
-			if err = s.keyring.Remove(session.Key); err != nil {
+		if !match(session) {
+			continue
+		}
+		if !allOwners {
+			item, err := s.keyring.Get(session.Key)
+			if err != nil {
 				return n, err
 			}
-			n++
+			// sessions that can't be read are of no use to anyone, so they're deleted whoever stored them
+			var cached cachedSession
+			if err = json.Unmarshal(item.Data, &cached); err == nil && cached.Owner != s.Owner {
+				log.Printf("Session %q belongs to someone else, skipping", session.Key)
+				continue
+			}
+		}
+		log.Printf("Session %q matches profile %q", session.Key, session.ProfileName)
+		if err = s.keyring.Remove(session.Key); err != nil {
+			return n, err
 		}
+		n++
 	}
 
 	return
@@ -1,9 +1,16 @@
 package vault_test
 
 import (
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"testing"
+	"time"
 
 	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 func TestIsSessionKey(t *testing.T) {
@@ -26,3 +33,227 @@ func TestIsSessionKey(t *testing.T) {
 		}
 	}
 }
+
+func TestSessionRegionMismatchIsDeleted(t *testing.T) {
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	sessions := k.Sessions()
+
+	err := sessions.Store("llamas", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAEXAMPLE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := sessions.Retrieve("llamas", "", "us-east-1")
+	if err != nil {
+		t.Fatalf("Expected session for the same region, got %v", err)
+	}
+	if *creds.AccessKeyId != "ASIAEXAMPLE" {
+		t.Fatalf("Expected access key %q, got %q", "ASIAEXAMPLE", *creds.AccessKeyId)
+	}
+
+	if _, err = sessions.Retrieve("llamas", "", "us-west-2"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound for a different region, got %v", err)
+	}
+	if _, err = sessions.Retrieve("llamas", "", "us-east-1"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected the session to have been deleted, got %v", err)
+	}
+}
+
+func TestSessionsAreSeparatedByOwner(t *testing.T) {
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	alice := k.Sessions()
+	alice.Owner = "user:alice"
+	err := alice.Store("shared", "", "us-east-1", &sts.Credentials{
+		AccessKeyId:     aws.String("ASIAALICE"),
+		SecretAccessKey: aws.String("secret"),
+		SessionToken:    aws.String("token"),
+		Expiration:      aws.Time(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob := k.Sessions()
+	bob.Owner = "user:bob"
+	if _, err = bob.Retrieve("shared", "", "us-east-1"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound for another owner's session, got %v", err)
+	}
+	if _, err = k.Sessions().Retrieve("shared", "", "us-east-1"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected ErrKeyNotFound without an owner, got %v", err)
+	}
+
+	creds, err := alice.Retrieve("shared", "", "us-east-1")
+	if err != nil {
+		t.Fatalf("Expected the owner's session to still be cached, got %v", err)
+	}
+	if *creds.AccessKeyId != "ASIAALICE" {
+		t.Fatalf("Expected access key %q, got %q", "ASIAALICE", *creds.AccessKeyId)
+	}
+}
+
+func TestDeleteOnlyDeletesTheOwnersSessions(t *testing.T) {
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+
+	for i, owner := range []string{"user:alice", "user:bob"} {
+		sessions := k.Sessions()
+		sessions.Owner = owner
+		err := sessions.Store("shared", "", "us-east-1", &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(time.Now().Add(time.Duration(i+1) * time.Hour)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alice := k.Sessions()
+	alice.Owner = "user:alice"
+	if n, err := alice.Delete("shared"); err != nil || n != 1 {
+		t.Fatalf("Expected 1 session to be deleted, got %d, %v", n, err)
+	}
+	if _, err := alice.Retrieve("shared", "", "us-east-1"); err != keyring.ErrKeyNotFound {
+		t.Fatalf("Expected the owner's session to be deleted, got %v", err)
+	}
+
+	bob := k.Sessions()
+	bob.Owner = "user:bob"
+	if _, err := bob.Retrieve("shared", "", "us-east-1"); err != nil {
+		t.Fatalf("Expected another owner's session to be kept, got %v", err)
+	}
+
+	if n, err := alice.DeleteForAllOwners("shared"); err != nil || n != 1 {
+		t.Fatalf("Expected another owner's session to be deleted, got %d, %v", n, err)
+	}
+}
+
+func TestCacheOnlyFailsWithoutCachedSession(t *testing.T) {
+	vault.CacheOnly = true
+	defer func() { vault.CacheOnly = false }()
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring([]keyring.Item{
+		{Key: "llamas", Data: []byte(`{"AccessKeyID":"ABC","SecretAccessKey":"XYZ"}`)},
+	})}
+
+	creds, err := vault.NewTempCredentials(&vault.Config{ProfileName: "llamas"}, k)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = creds.Get()
+	if !errors.Is(err, vault.ErrNoCachedCredentials) {
+		t.Fatalf("Expected ErrNoCachedCredentials, got %v", err)
+	}
+}
+
+func TestSessionCacheVersionMigration(t *testing.T) {
+	expiration := time.Now().Add(time.Hour)
+	key := func(profileName string) string {
+		return fmt.Sprintf("session,%s,,%d", base64.RawURLEncoding.EncodeToString([]byte(profileName)), expiration.Unix())
+	}
+	data := func(extra string) []byte {
+		return []byte(fmt.Sprintf(`{"AccessKeyId":"ASIAEXAMPLE","SecretAccessKey":"secret","SessionToken":"token","Expiration":%q%s}`,
+			expiration.UTC().Format(time.RFC3339), extra))
+	}
+
+	kr := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: key("unversioned"), Data: data("")},
+		{Key: key("newer"), Data: data(`,"Version":99`)},
+		{Key: key("garbage"), Data: []byte("not json")},
+		{Key: key("incomplete"), Data: []byte(`{"AccessKeyId":"ASIAEXAMPLE"}`)},
+	})
+	sessions := (&vault.CredentialKeyring{Keyring: kr}).Sessions()
+
+	creds, err := sessions.Retrieve("unversioned", "", "us-east-1")
+	if err != nil {
+		t.Fatalf("Expected a session stored before versioning to be used, got %v", err)
+	}
+	if *creds.AccessKeyId != "ASIAEXAMPLE" {
+		t.Fatalf("Expected access key %q, got %q", "ASIAEXAMPLE", *creds.AccessKeyId)
+	}
+
+	for _, profileName := range []string{"newer", "garbage", "incomplete"} {
+		if _, err = sessions.Retrieve(profileName, "", "us-east-1"); err != keyring.ErrKeyNotFound {
+			t.Fatalf("%s: expected ErrKeyNotFound, got %v", profileName, err)
+		}
+		if _, err = kr.Get(key(profileName)); err != keyring.ErrKeyNotFound {
+			t.Fatalf("%s: expected the session to be deleted, got %v", profileName, err)
+		}
+	}
+}
+
+func TestRetrieveSkipsSessionsItCantUse(t *testing.T) {
+	key := func(expiration time.Time) string {
+		return fmt.Sprintf("session,%s,,%d", base64.RawURLEncoding.EncodeToString([]byte("llamas")), expiration.Unix())
+	}
+	data := func(accessKeyID string, expiration time.Time, region string) []byte {
+		return []byte(fmt.Sprintf(`{"AccessKeyId":%q,"SecretAccessKey":"secret","SessionToken":"token","Expiration":%q,"Region":%q,"Version":1}`,
+			accessKeyID, expiration.UTC().Format(time.RFC3339), region))
+	}
+
+	now := time.Now()
+	kr := keyring.NewArrayKeyring([]keyring.Item{
+		{Key: key(now.Add(10 * time.Minute)), Data: []byte("not json")},
+		{Key: key(now.Add(20 * time.Minute)), Data: data("ASIAUSWEST2", now.Add(20*time.Minute), "us-west-2")},
+		{Key: key(now.Add(30 * time.Minute)), Data: data("ASIAUSEAST1", now.Add(30*time.Minute), "us-east-1")},
+	})
+	sessions := (&vault.CredentialKeyring{Keyring: kr}).Sessions()
+
+	creds, err := sessions.Retrieve("llamas", "", "us-east-1")
+	if err != nil {
+		t.Fatalf("Expected the session for us-east-1, got %v", err)
+	}
+	if *creds.AccessKeyId != "ASIAUSEAST1" {
+		t.Fatalf("Expected access key %q, got %q", "ASIAUSEAST1", *creds.AccessKeyId)
+	}
+
+	if _, err = kr.Get(key(now.Add(30 * time.Minute))); err != nil {
+		t.Fatalf("Expected the session for us-east-1 to be kept, got %v", err)
+	}
+}
+
+func TestExpiredSessionsAreKeptForTheMaxGracePeriod(t *testing.T) {
+	kr := keyring.NewArrayKeyring(nil)
+	k := &vault.CredentialKeyring{Keyring: kr}
+
+	for _, expiration := range []time.Time{
+		time.Now().Add(-10 * time.Minute),
+		time.Now().Add(-vault.MaxExpiredGrace - time.Minute),
+	} {
+		err := k.Sessions().Store("llamas", "", "us-east-1", &sts.Credentials{
+			AccessKeyId:     aws.String("ASIAEXAMPLE"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(expiration),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// a caller without a grace period, like list, doesn't see the expired sessions
+	sessions, err := k.Sessions().Sessions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 0 {
+		t.Fatalf("Expected no sessions without a grace period, got %v", sessions)
+	}
+
+	// but only the one older than MaxExpiredGrace is removed
+	if keys, _ := kr.Keys(); len(keys) != 1 {
+		t.Fatalf("Expected the session within the grace period to be kept, got %v", keys)
+	}
+	withGrace := k.Sessions()
+	withGrace.ExpiredGrace = time.Hour
+	if _, err = withGrace.RetrieveExpired("llamas", "", "us-east-1"); err != nil {
+		t.Fatalf("Expected the session within the grace period, got %v", err)
+	}
+}
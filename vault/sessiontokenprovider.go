@@ -1,10 +1,13 @@
 package vault
 
 import (
+	"context"
+	"fmt"
 	"log"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
@@ -20,7 +23,12 @@ type SessionTokenProvider struct {
 
 // Retrieve generates a new set of temporary credentials using STS GetSessionToken
 func (p *SessionTokenProvider) Retrieve() (credentials.Value, error) {
-	session, err := p.GetSessionToken()
+	return p.RetrieveWithContext(context.Background())
+}
+
+// RetrieveWithContext is Retrieve, but stops waiting for the MFA token or STS when ctx is done
+func (p *SessionTokenProvider) RetrieveWithContext(ctx context.Context) (credentials.Value, error) {
+	session, err := p.GetSessionTokenWithContext(ctx)
 	if err != nil {
 		return credentials.Value{}, err
 	}
@@ -35,26 +43,61 @@ func (p *SessionTokenProvider) Retrieve() (credentials.Value, error) {
 
 // GetSessionToken generates a new set of temporary credentials using STS GetSessionToken
 func (p *SessionTokenProvider) GetSessionToken() (*sts.Credentials, error) {
-	var err error
+	return p.GetSessionTokenWithContext(context.Background())
+}
 
+// GetSessionTokenWithContext is GetSessionToken, but stops waiting for the MFA token or STS when ctx is done
+func (p *SessionTokenProvider) GetSessionTokenWithContext(ctx context.Context) (*sts.Credentials, error) {
+	// checked before prompting for an MFA token, as it would be wasted
+	if err := p.checkNotRootCredentials(ctx); err != nil {
+		return nil, err
+	}
+
+	var err error
 	input := &sts.GetSessionTokenInput{
 		DurationSeconds: aws.Int64(int64(p.Duration.Seconds())),
 	}
 
 	if p.MfaSerial != "" {
-		input.SerialNumber = aws.String(p.MfaSerial)
-		input.TokenCode, err = p.GetMfaToken()
+		if err = p.resolveMfaSerial(); err != nil {
+			return nil, err
+		}
+		input.SerialNumber = aws.String(p.serial())
+		input.TokenCode, err = p.GetMfaTokenWithContext(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	resp, err := p.StsClient.GetSessionToken(input)
+	done := traceStep("sts:GetSessionToken")
+	resp, err := p.StsClient.GetSessionTokenWithContext(ctx, input)
+	done()
 	if err != nil {
 		return nil, err
 	}
 
 	log.Printf("Generated credentials %s using GetSessionToken, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	notifyHook(p.Hook, HookEventRefresh)
 
 	return resp.Credentials, nil
 }
+
+// checkNotRootCredentials returns an error if the credentials are the root user's, as sessions of
+// the root user behave differently to those of IAM users, e.g. they can't assume roles
+func (p *SessionTokenProvider) checkNotRootCredentials(ctx context.Context) error {
+	done := traceStep("sts:GetCallerIdentity")
+	identity, err := p.StsClient.GetCallerIdentityWithContext(ctx, &sts.GetCallerIdentityInput{})
+	done()
+	if err != nil {
+		// GetSessionToken fails the same way, with an error that's just as useful
+		log.Printf("Can't check whether the credentials are the root user's: %v", err)
+		return nil
+	}
+	callerARN, err := arn.Parse(aws.StringValue(identity.Arn))
+	if err != nil || callerARN.Resource != "root" {
+		return nil
+	}
+	return fmt.Errorf("The credentials are the root user's access keys for account %s. "+
+		"Root credentials shouldn't be used with aws-vault, their sessions don't behave like an IAM user's, "+
+		"so add an IAM user's access keys instead", callerARN.AccountID)
+}
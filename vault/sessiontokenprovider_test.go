@@ -0,0 +1,91 @@
+package vault_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// callerIdentityResponse is the response of GetCallerIdentity for the caller callerARN
+func callerIdentityResponse(callerARN string) string {
+	return fmt.Sprintf(`<GetCallerIdentityResponse><GetCallerIdentityResult>
+<Arn>%s</Arn><Account>123456789012</Account><UserId>AIDAEXAMPLE</UserId>
+</GetCallerIdentityResult></GetCallerIdentityResponse>`, callerARN)
+}
+
+// getSessionTokenAs calls GetSessionToken with the credentials of callerARN, and returns the actions
+// that were called and the error
+func getSessionTokenAs(callerARN string) ([]string, error) {
+	var mu sync.Mutex
+	var actions []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// failing the test is left to the test's goroutine, via the actions that were called
+		_ = r.ParseForm()
+		action := r.PostForm.Get("Action")
+		mu.Lock()
+		actions = append(actions, action)
+		mu.Unlock()
+
+		switch action {
+		case "GetCallerIdentity":
+			fmt.Fprint(w, callerIdentityResponse(callerARN))
+		case "GetSessionToken":
+			fmt.Fprintf(w, `<GetSessionTokenResponse><GetSessionTokenResult><Credentials>
+<AccessKeyId>ASIAEXAMPLE</AccessKeyId><SecretAccessKey>secret</SecretAccessKey><SessionToken>token</SessionToken>
+<Expiration>%s</Expiration></Credentials></GetSessionTokenResult></GetSessionTokenResponse>`, time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer ts.Close()
+
+	sess := session.Must(session.NewSession(&aws.Config{
+		Credentials: credentials.NewStaticCredentials("AKIAEXAMPLE", "secret", ""),
+		Endpoint:    aws.String(ts.URL),
+		Region:      aws.String("us-east-1"),
+		MaxRetries:  aws.Int(0),
+	}))
+
+	p := &vault.SessionTokenProvider{
+		StsClient: sts.New(sess),
+		Duration:  time.Hour,
+		Mfa:       vault.Mfa{MfaSerial: "arn:aws:iam::123456789012:mfa/root-account-mfa-device", MfaToken: "123456"},
+	}
+	_, err := p.Retrieve()
+
+	mu.Lock()
+	defer mu.Unlock()
+	return actions, err
+}
+
+func TestGetSessionTokenRefusesRootCredentials(t *testing.T) {
+	actions, err := getSessionTokenAs("arn:aws:iam::123456789012:root")
+
+	if err == nil || !strings.Contains(err.Error(), "root user's access keys for account 123456789012") {
+		t.Fatalf("Expected an error explaining the credentials are the root user's, got %v", err)
+	}
+	if len(actions) != 1 || actions[0] != "GetCallerIdentity" {
+		t.Fatalf("Expected only GetCallerIdentity to be called, got %v", actions)
+	}
+}
+
+func TestGetSessionTokenWithAnIAMUser(t *testing.T) {
+	actions, err := getSessionTokenAs("arn:aws:iam::123456789012:user/alice")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(actions, ",") != "GetCallerIdentity,GetSessionToken" {
+		t.Fatalf("Expected GetCallerIdentity and then GetSessionToken, got %v", actions)
+	}
+}
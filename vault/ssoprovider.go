@@ -0,0 +1,319 @@
+package vault
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sso"
+	"github.com/aws/aws-sdk-go/service/ssooidc"
+	"github.com/skratchdot/open-golang/open"
+)
+
+// ssoTokenKeyPrefix is the prefix of keyring keys that SSO access tokens are stored under
+const ssoTokenKeyPrefix = "sso-token,"
+
+// SSOPicker chooses the account and role for a profile that doesn't set sso_account_id or sso_role_name
+type SSOPicker interface {
+	// Pick returns the index of the option chosen
+	Pick(title string, options []string) (int, error)
+
+	// Remember is called with the account and role chosen for the profile
+	Remember(profileName, accountID, roleName string) error
+}
+
+// DefaultSSOPicker is used when an SSO profile doesn't set sso_account_id or sso_role_name. When
+// it's nil, the profile must set both
+var DefaultSSOPicker SSOPicker
+
+// SSOToken is an SSO access token, cached in the keyring until it expires
+type SSOToken struct {
+	AccessToken string
+	Expiration  time.Time
+}
+
+// SSORoleCredentialsProvider retrieves credentials for an account and role with AWS SSO. The SSO
+// access token is obtained with the OIDC device authorization flow in a browser, and cached in
+// the keyring
+type SSORoleCredentialsProvider struct {
+	OIDCClient   *ssooidc.SSOOIDC
+	Client       *sso.SSO
+	Keyring      *CredentialKeyring
+	ProfileName  string
+	StartURL     string
+	AccountID    string
+	RoleName     string
+	ExpiryWindow time.Duration
+	Picker       SSOPicker
+
+	// TokenCache shares the access token with the AWS CLI when it's set, see SSOTokenCache
+	TokenCache *SSOTokenCache
+	Region     string
+
+	credentials.Expiry
+}
+
+// Retrieve returns credentials for the role using GetRoleCredentials
+func (p *SSORoleCredentialsProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.accessToken()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	if p.AccountID == "" || p.RoleName == "" {
+		if err = p.pick(token); err != nil {
+			return credentials.Value{}, err
+		}
+	}
+
+	done := traceStep("sso:GetRoleCredentials %s/%s", p.AccountID, p.RoleName)
+	resp, err := p.Client.GetRoleCredentials(&sso.GetRoleCredentialsInput{
+		AccessToken: aws.String(token.AccessToken),
+		AccountId:   aws.String(p.AccountID),
+		RoleName:    aws.String(p.RoleName),
+	})
+	done()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	expiration := aws.MillisecondsTimeValue(resp.RoleCredentials.Expiration)
+	log.Printf("Got credentials %s for SSO role %s in account %s, expires in %s", FormatKeyForDisplay(aws.StringValue(resp.RoleCredentials.AccessKeyId)), p.RoleName, p.AccountID, time.Until(expiration).String())
+	p.SetExpiration(expiration, p.ExpiryWindow)
+
+	return credentials.Value{
+		AccessKeyID:     aws.StringValue(resp.RoleCredentials.AccessKeyId),
+		SecretAccessKey: aws.StringValue(resp.RoleCredentials.SecretAccessKey),
+		SessionToken:    aws.StringValue(resp.RoleCredentials.SessionToken),
+	}, nil
+}
+
+// accessToken returns the cached SSO access token for the start URL, or logs in for a new one
+func (p *SSORoleCredentialsProvider) accessToken() (*SSOToken, error) {
+	token, err := p.Keyring.GetSSOToken(p.StartURL)
+	if err == nil && time.Now().Add(p.ExpiryWindow).Before(token.Expiration) {
+		log.Printf("Re-using cached SSO token for %s, expires in %s", p.StartURL, time.Until(token.Expiration).String())
+		return token, nil
+	}
+
+	if p.TokenCache != nil {
+		token, err = p.TokenCache.Get(p.StartURL)
+		if err == nil && time.Now().Add(p.ExpiryWindow).Before(token.Expiration) {
+			log.Printf("Re-using SSO token for %s from %s, expires in %s", p.StartURL, p.TokenCache.Dir, time.Until(token.Expiration).String())
+			return token, p.Keyring.SetSSOToken(p.StartURL, token)
+		} else if err != nil && !os.IsNotExist(err) {
+			log.Printf("Ignoring the AWS CLI SSO token cache: %v", err)
+		}
+	}
+
+	if CacheOnly {
+		return nil, fmt.Errorf("profile %s: %w, the SSO token needs renewing", p.ProfileName, ErrNoCachedCredentials)
+	}
+
+	if token, err = p.newAccessToken(); err != nil {
+		return nil, err
+	}
+	if err = p.Keyring.SetSSOToken(p.StartURL, token); err != nil {
+		return nil, err
+	}
+	if p.TokenCache != nil {
+		if err = p.TokenCache.Set(p.StartURL, p.Region, token); err != nil {
+			log.Printf("Failed to write the SSO token to the AWS CLI cache: %v", err)
+		}
+	}
+
+	return token, nil
+}
+
+// newAccessToken logs in to the start URL using the OIDC device authorization flow
+func (p *SSORoleCredentialsProvider) newAccessToken() (*SSOToken, error) {
+	client, err := p.OIDCClient.RegisterClient(&ssooidc.RegisterClientInput{
+		ClientName: aws.String("aws-vault"),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	auth, err := p.OIDCClient.StartDeviceAuthorization(&ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     client.ClientId,
+		ClientSecret: client.ClientSecret,
+		StartUrl:     aws.String(p.StartURL),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	url := aws.StringValue(auth.VerificationUriComplete)
+	fmt.Fprintf(os.Stderr, "Opening the SSO authorization page in your browser, if it doesn't open visit:\n\n%s\n\n", url)
+	if err = open.Run(url); err != nil {
+		log.Printf("Failed to open browser: %v", err)
+	}
+
+	interval := time.Duration(aws.Int64Value(auth.Interval)) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+
+	for {
+		resp, err := p.OIDCClient.CreateToken(&ssooidc.CreateTokenInput{
+			ClientId:     client.ClientId,
+			ClientSecret: client.ClientSecret,
+			DeviceCode:   auth.DeviceCode,
+			GrantType:    aws.String("urn:ietf:params:oauth:grant-type:device_code"),
+		})
+		if err != nil {
+			if aerr, ok := err.(awserr.Error); ok {
+				switch aerr.Code() {
+				case ssooidc.ErrCodeSlowDownException:
+					interval += 5 * time.Second
+					fallthrough
+				case ssooidc.ErrCodeAuthorizationPendingException:
+					time.Sleep(interval)
+					continue
+				}
+			}
+			return nil, err
+		}
+
+		log.Printf("Got SSO token for %s", p.StartURL)
+		return &SSOToken{
+			AccessToken: aws.StringValue(resp.AccessToken),
+			Expiration:  time.Now().Add(time.Duration(aws.Int64Value(resp.ExpiresIn)) * time.Second),
+		}, nil
+	}
+}
+
+// pick chooses the account and role that aren't set in the profile using the Picker
+func (p *SSORoleCredentialsProvider) pick(token *SSOToken) error {
+	if p.Picker == nil {
+		return &ConfigError{fmt.Errorf("profile %s: sso_account_id and sso_role_name must be set", p.ProfileName)}
+	}
+
+	if p.AccountID == "" {
+		var accounts []*sso.AccountInfo
+		err := p.Client.ListAccountsPages(&sso.ListAccountsInput{AccessToken: aws.String(token.AccessToken)},
+			func(page *sso.ListAccountsOutput, lastPage bool) bool {
+				accounts = append(accounts, page.AccountList...)
+				return true
+			})
+		if err != nil {
+			return fmt.Errorf("Error listing SSO accounts: %w", err)
+		}
+		if len(accounts) == 0 {
+			return fmt.Errorf("No accounts are available with SSO at %s", p.StartURL)
+		}
+
+		options := make([]string, len(accounts))
+		for i, a := range accounts {
+			options[i] = fmt.Sprintf("%s (%s)", aws.StringValue(a.AccountName), aws.StringValue(a.AccountId))
+		}
+		i, err := p.Picker.Pick("Choose an account", options)
+		if err != nil {
+			return err
+		}
+		p.AccountID = aws.StringValue(accounts[i].AccountId)
+	}
+
+	if p.RoleName == "" {
+		var roles []*sso.RoleInfo
+		err := p.Client.ListAccountRolesPages(&sso.ListAccountRolesInput{AccessToken: aws.String(token.AccessToken), AccountId: aws.String(p.AccountID)},
+			func(page *sso.ListAccountRolesOutput, lastPage bool) bool {
+				roles = append(roles, page.RoleList...)
+				return true
+			})
+		if err != nil {
+			return fmt.Errorf("Error listing SSO roles for account %s: %w", p.AccountID, err)
+		}
+		if len(roles) == 0 {
+			return fmt.Errorf("No roles are available with SSO in account %s", p.AccountID)
+		}
+
+		options := make([]string, len(roles))
+		for i, r := range roles {
+			options[i] = aws.StringValue(r.RoleName)
+		}
+		i, err := p.Picker.Pick("Choose a role", options)
+		if err != nil {
+			return err
+		}
+		p.RoleName = aws.StringValue(roles[i].RoleName)
+	}
+
+	return p.Picker.Remember(p.ProfileName, p.AccountID, p.RoleName)
+}
+
+// NewSSORoleCredentialsProvider returns a provider for the profile's SSO account and role
+func NewSSORoleCredentialsProvider(k *CredentialKeyring, config *Config) (*SSORoleCredentialsProvider, error) {
+	// the SSO APIs are authorized with the access token rather than signed
+	sess, err := newSession(credentials.AnonymousCredentials, config.SSORegion, config.HTTPClient())
+	if err != nil {
+		return nil, err
+	}
+
+	tokenCache, err := DefaultSSOTokenCache()
+	if err != nil {
+		log.Printf("Not sharing the SSO token with the AWS CLI: %v", err)
+	}
+
+	return &SSORoleCredentialsProvider{
+		OIDCClient:   ssooidc.New(sess),
+		Client:       sso.New(sess),
+		Keyring:      k,
+		ProfileName:  config.ProfileName,
+		StartURL:     config.SSOStartURL,
+		AccountID:    config.SSOAccountID,
+		RoleName:     config.SSORoleName,
+		ExpiryWindow: defaultExpirationWindow,
+		Picker:       DefaultSSOPicker,
+		TokenCache:   tokenCache,
+		Region:       config.SSORegion,
+	}, nil
+}
+
+// IsSSOTokenKey returns true if the keyring key stores an SSO access token
+func IsSSOTokenKey(s string) bool {
+	return strings.HasPrefix(s, ssoTokenKeyPrefix)
+}
+
+func ssoTokenKey(startURL string) string {
+	return ssoTokenKeyPrefix + base64Encoding.EncodeToString([]byte(startURL))
+}
+
+// GetSSOToken returns the SSO access token stored for the start URL
+func (ck *CredentialKeyring) GetSSOToken(startURL string) (*SSOToken, error) {
+	item, err := ck.Keyring.Get(ssoTokenKey(startURL))
+	if err != nil {
+		return nil, err
+	}
+	var token SSOToken
+	if err = json.Unmarshal(item.Data, &token); err != nil {
+		return nil, fmt.Errorf("Invalid data in keyring: %v", err)
+	}
+	return &token, nil
+}
+
+// SetSSOToken stores the SSO access token for the start URL
+func (ck *CredentialKeyring) SetSSOToken(startURL string, token *SSOToken) error {
+	bytes, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	return ck.Keyring.Set(keyring.Item{
+		Key:         ssoTokenKey(startURL),
+		Label:       "aws-vault SSO token for " + startURL,
+		Description: "aws-vault SSO token for " + startURL,
+		Data:        bytes,
+
+		// specific Keychain settings
+		KeychainNotTrustApplication: false,
+	})
+}
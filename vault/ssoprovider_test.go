@@ -0,0 +1,140 @@
+package vault_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/99designs/keyring"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sso"
+)
+
+type fakeSSOPicker struct {
+	picked     []string
+	remembered string
+}
+
+func (p *fakeSSOPicker) Pick(title string, options []string) (int, error) {
+	p.picked = append(p.picked, options[len(options)-1])
+	return len(options) - 1, nil
+}
+
+func (p *fakeSSOPicker) Remember(profileName, accountID, roleName string) error {
+	p.remembered = fmt.Sprintf("%s %s %s", profileName, accountID, roleName)
+	return nil
+}
+
+func TestSSORoleCredentialsProviderPicksAccountAndRole(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("x-amz-sso_bearer_token") != "token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch r.URL.Path {
+		case "/assignment/accounts":
+			fmt.Fprint(w, `{"accountList":[{"accountId":"111111111111","accountName":"dev"},{"accountId":"222222222222","accountName":"prod"}]}`)
+		case "/assignment/roles":
+			fmt.Fprintf(w, `{"roleList":[{"accountId":"%s","roleName":"ReadOnly"},{"accountId":"%[1]s","roleName":"Admin"}]}`, r.URL.Query().Get("account_id"))
+		case "/federation/credentials":
+			if r.URL.Query().Get("account_id") != "222222222222" || r.URL.Query().Get("role_name") != "Admin" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprintf(w, `{"roleCredentials":{"accessKeyId":"ASIASSO","secretAccessKey":"secret","sessionToken":"session","expiration":%d}}`,
+				time.Now().Add(time.Hour).Unix()*1000)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	sess := session.Must(session.NewSession(aws.NewConfig().
+		WithRegion("us-east-1").
+		WithEndpoint(server.URL).
+		WithCredentials(credentials.AnonymousCredentials)))
+
+	k := &vault.CredentialKeyring{Keyring: keyring.NewArrayKeyring(nil)}
+	err := k.SetSSOToken("https://example.awsapps.com/start", &vault.SSOToken{AccessToken: "token", Expiration: time.Now().Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	picker := &fakeSSOPicker{}
+	p := &vault.SSORoleCredentialsProvider{
+		Client:      sso.New(sess),
+		Keyring:     k,
+		ProfileName: "sso",
+		StartURL:    "https://example.awsapps.com/start",
+		Picker:      picker,
+	}
+
+	val, err := p.Retrieve()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if val.AccessKeyID != "ASIASSO" {
+		t.Fatalf("Unexpected access key %q", val.AccessKeyID)
+	}
+	if fmt.Sprint(picker.picked) != "[prod (222222222222) Admin]" {
+		t.Fatalf("Unexpected options picked %v", picker.picked)
+	}
+	if picker.remembered != "sso 222222222222 Admin" {
+		t.Fatalf("Unexpected choice remembered %q", picker.remembered)
+	}
+
+	keys, err := k.CredentialsKeys()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("Expected the SSO token not to be listed as credentials, got %v", keys)
+	}
+}
+
+func TestSSOTokenCacheIsSharedWithTheAWSCLI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "aws-vault-sso-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// written by "aws sso login", named after the SHA1 hash of the start URL
+	err = ioutil.WriteFile(filepath.Join(dir, "e8be5486177c5b5392bd9aa76563515b29358e6e.json"), []byte(`{
+  "startUrl": "https://example.awsapps.com/start",
+  "region": "us-east-1",
+  "accessToken": "cli-token",
+  "expiresAt": "`+time.Now().Add(time.Hour).UTC().Format("2006-01-02T15:04:05UTC")+`"
+}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cache := &vault.SSOTokenCache{Dir: dir}
+	token, err := cache.Get("https://example.awsapps.com/start")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "cli-token" {
+		t.Fatalf("Unexpected token %q", token.AccessToken)
+	}
+
+	if err = cache.Set("https://example.awsapps.com/other", "eu-west-1", &vault.SSOToken{AccessToken: "vault-token", Expiration: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+	token, err = cache.Get("https://example.awsapps.com/other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "vault-token" || time.Until(token.Expiration) < 59*time.Minute {
+		t.Fatalf("Unexpected token %+v", token)
+	}
+}
@@ -0,0 +1,102 @@
+package vault
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/go-homedir"
+)
+
+// ssoCacheTimeFormats are the formats of expiresAt written by versions of the AWS CLI
+var ssoCacheTimeFormats = []string{time.RFC3339, "2006-01-02T15:04:05UTC"}
+
+// SSOTokenCache is the directory the AWS CLI caches SSO access tokens in, so a token from
+// "aws sso login" can be used by aws-vault and the other way around
+type SSOTokenCache struct {
+	Dir string
+}
+
+// ssoCachedToken is the JSON format of a token in the AWS CLI cache
+type ssoCachedToken struct {
+	StartURL    string `json:"startUrl"`
+	Region      string `json:"region"`
+	AccessToken string `json:"accessToken"`
+	ExpiresAt   string `json:"expiresAt"`
+}
+
+// DefaultSSOTokenCache returns the cache in ~/.aws/sso/cache
+func DefaultSSOTokenCache() (*SSOTokenCache, error) {
+	home, err := homedir.Dir()
+	if err != nil {
+		return nil, err
+	}
+	return &SSOTokenCache{Dir: filepath.Join(home, ".aws", "sso", "cache")}, nil
+}
+
+// path returns the file for the start URL, which the AWS CLI names after the SHA1 hash of the URL
+func (c *SSOTokenCache) path(startURL string) string {
+	hash := sha1.Sum([]byte(startURL))
+	return filepath.Join(c.Dir, hex.EncodeToString(hash[:])+".json")
+}
+
+// Get returns the token cached for the start URL
+func (c *SSOTokenCache) Get(startURL string) (*SSOToken, error) {
+	b, err := ioutil.ReadFile(c.path(startURL))
+	if err != nil {
+		return nil, err
+	}
+
+	var cached ssoCachedToken
+	if err = json.Unmarshal(b, &cached); err != nil {
+		return nil, fmt.Errorf("Invalid SSO token cache %s: %w", c.path(startURL), err)
+	}
+	if cached.StartURL != startURL || cached.AccessToken == "" {
+		return nil, fmt.Errorf("SSO token cache %s isn't for %s", c.path(startURL), startURL)
+	}
+
+	for _, format := range ssoCacheTimeFormats {
+		if expiration, err := time.Parse(format, cached.ExpiresAt); err == nil {
+			return &SSOToken{AccessToken: cached.AccessToken, Expiration: expiration}, nil
+		}
+	}
+	return nil, fmt.Errorf("Invalid expiresAt %q in SSO token cache %s", cached.ExpiresAt, c.path(startURL))
+}
+
+// Set caches the token for the start URL, readable only by the user like the AWS CLI's files
+func (c *SSOTokenCache) Set(startURL, region string, token *SSOToken) error {
+	b, err := json.Marshal(ssoCachedToken{
+		StartURL:    startURL,
+		Region:      region,
+		AccessToken: token.AccessToken,
+		ExpiresAt:   token.Expiration.UTC().Format(time.RFC3339),
+	})
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(c.Dir, 0700); err != nil {
+		return err
+	}
+
+	// write then rename so the AWS CLI never reads a partial file
+	tmp, err := ioutil.TempFile(c.Dir, strings.TrimSuffix(filepath.Base(c.path(startURL)), ".json")+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.path(startURL))
+}
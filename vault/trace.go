@@ -0,0 +1,24 @@
+package vault
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Trace is written a line with the duration of each step of resolving credentials, such as keyring
+// reads, STS calls and MFA prompts. Tracing is off when it's nil
+var Trace io.Writer
+
+// traceStep starts timing a step, returning a func that writes its duration to Trace
+func traceStep(format string, a ...interface{}) func() {
+	if Trace == nil {
+		return func() {}
+	}
+
+	step := fmt.Sprintf(format, a...)
+	start := time.Now()
+	return func() {
+		fmt.Fprintf(Trace, "trace: %-60s %s\n", step, time.Since(start).Round(time.Millisecond))
+	}
+}
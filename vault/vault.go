@@ -1,25 +1,112 @@
 package vault
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/99designs/aws-vault/prompt"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/arn"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
 const defaultExpirationWindow = 5 * time.Minute
 
+// defaultPromptMethod is used when no prompt method is configured for a profile or in AWS_VAULT_PROMPT
+const defaultPromptMethod = "terminal"
+
 var UseSession = true
 var UseSessionCache = true
 
+// CacheOnly makes providers fail with ErrNoCachedCredentials rather than calling STS or running commands
+var CacheOnly = false
+
+// Refresh makes providers ignore cached credentials, creating and caching new ones
+var Refresh = false
+
+// ValidateStoredCredentials makes providers check stored credentials with GetCallerIdentity before using them
+var ValidateStoredCredentials = false
+
+// ErrNoCachedCredentials is returned in CacheOnly mode when credentials would have to be created
+var ErrNoCachedCredentials = errors.New("no valid cached credentials")
+
+// ErrCredentialsMissing is returned when there is no source of credentials for a profile
+var ErrCredentialsMissing = errors.New("credentials missing")
+
 func NewSession(creds *credentials.Credentials, region string) (*session.Session, error) {
-	return session.NewSession(aws.NewConfig().WithRegion(region).WithCredentials(creds))
+	return newSession(creds, region, nil)
+}
+
+// NewProfileSession is NewSession for the profile's region, using the HTTP client from its http_* settings
+func NewProfileSession(creds *credentials.Credentials, config *Config) (*session.Session, error) {
+	return newSession(creds, config.Region, config.HTTPClient())
+}
+
+func newSession(creds *credentials.Credentials, region string, client *http.Client) (*session.Session, error) {
+	if region == "" {
+		region = defaultRegion()
+	}
+	awsConfig := aws.NewConfig().WithRegion(region).WithCredentials(creds)
+	if client != nil {
+		awsConfig = awsConfig.WithHTTPClient(client)
+	}
+	return session.NewSession(awsConfig)
+}
+
+var (
+	// metadataRegions caches the region from each metadata endpoint, including failures, so a chain
+	// of profiles off EC2 only waits for the metadata service once
+	metadataRegions   = map[string]string{}
+	metadataRegionsMu sync.Mutex
+)
+
+// defaultRegion is the region used when none is configured. On AWS compute it's the region set by ECS
+// or Lambda in the environment, or else the region of the EC2 instance from the metadata service
+func defaultRegion() string {
+	for _, name := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(name); region != "" {
+			return region
+		}
+	}
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return ""
+	}
+
+	p := &Ec2MetadataProvider{
+		Endpoint: os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT"),
+		TokenTTL: time.Minute,
+		Client:   &http.Client{Timeout: ec2MetadataTokenTimeout},
+	}
+	if p.Endpoint == "" {
+		p.Endpoint = defaultEc2MetadataEndpoint
+	}
+
+	metadataRegionsMu.Lock()
+	defer metadataRegionsMu.Unlock()
+
+	region, ok := metadataRegions[p.Endpoint]
+	if !ok {
+		var err error
+		if region, err = p.Region(); err != nil {
+			log.Printf("No region is configured and it couldn't be read from the instance metadata: %v", err)
+		} else {
+			log.Printf("No region is configured, using %s from the instance metadata", region)
+		}
+		metadataRegions[p.Endpoint] = region
+	}
+	return region
 }
 
 func FormatKeyForDisplay(k string) string {
@@ -31,26 +118,164 @@ type Mfa struct {
 	MfaToken        string
 	MfaPromptMethod string
 	MfaSerial       string
+
+	// MfaSerialResolver, if set, looks up the serial of the MFA device the first time a new session
+	// needs MFA, for an MfaSerial such as auto that has to be resolved by calling AWS. Sessions are
+	// still cached under MfaSerial
+	MfaSerialResolver func() (string, error)
+	resolvedSerial    string
+
+	// MfaTokenCmd is run for each token needed, so a stale token is never reused
+	MfaTokenCmd string
+
+	// Hook is notified of MFA prompts and credential refreshes
+	Hook Hook
+}
+
+// MfaError is returned when an MFA token can't be read
+type MfaError struct {
+	Err error
+}
+
+func (e *MfaError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *MfaError) Unwrap() error {
+	return e.Err
+}
+
+// resolveMfaSerial resolves the serial of the MFA device with MfaSerialResolver, if it hasn't been already
+func (m *Mfa) resolveMfaSerial() error {
+	if m.MfaSerialResolver == nil || m.resolvedSerial != "" {
+		return nil
+	}
+	serial, err := m.MfaSerialResolver()
+	if err != nil {
+		return err
+	}
+	m.resolvedSerial = serial
+	return nil
+}
+
+// serial returns the serial of the MFA device, once it's been resolved
+func (m *Mfa) serial() string {
+	if m.resolvedSerial != "" {
+		return m.resolvedSerial
+	}
+	return m.MfaSerial
 }
 
 // GetMfaToken returns the MFA token
 func (m *Mfa) GetMfaToken() (*string, error) {
+	return m.GetMfaTokenWithContext(context.Background())
+}
+
+// GetMfaTokenWithContext is GetMfaToken, but returns ctx.Err() if ctx is done before there's a token.
+// mfa_token_cmd is killed, but a prompt can't be interrupted so it's left to be answered or closed
+func (m *Mfa) GetMfaTokenWithContext(ctx context.Context) (*string, error) {
 	if m.MfaToken != "" {
 		return aws.String(m.MfaToken), nil
 	}
 
-	if m.MfaPromptMethod != "" {
-		promptFunc := prompt.Method(m.MfaPromptMethod)
-		token, err := promptFunc(fmt.Sprintf("Enter token for %s: ", m.MfaSerial))
-		return aws.String(token), err
+	defer traceStep("MFA token for %s", m.serial())()
+
+	if m.MfaTokenCmd != "" {
+		return m.runMfaTokenCmd(ctx)
+	}
+
+	promptMethod := m.MfaPromptMethod
+	if promptMethod == "" {
+		promptMethod = os.Getenv("AWS_VAULT_PROMPT")
+	}
+	if promptMethod == "" {
+		promptMethod = defaultPromptMethod
+	}
+
+	promptFunc, ok := prompt.Methods[promptMethod]
+	if !ok {
+		return nil, &ConfigError{fmt.Errorf("Prompt method %q doesn't exist", promptMethod)}
 	}
 
-	return nil, errors.New("No prompt found")
+	notifyHook(m.Hook, HookEventMfaPrompt)
+	type result struct {
+		token string
+		err   error
+	}
+	results := make(chan result, 1)
+	go func() {
+		token, err := promptFunc(fmt.Sprintf("Enter token for %s: ", m.serial()))
+		results <- result{token, err}
+	}()
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case r := <-results:
+		if r.err != nil {
+			return nil, &MfaError{r.err}
+		}
+		return aws.String(r.token), nil
+	}
+}
+
+// runMfaTokenCmd returns the MFA token output by MfaTokenCmd
+func (m *Mfa) runMfaTokenCmd(ctx context.Context) (*string, error) {
+	var stdout bytes.Buffer
+	cmd := shellCommand(m.MfaTokenCmd)
+	cmd.Env = append(os.Environ(), "AWS_VAULT_MFA_SERIAL="+m.serial())
+	if uri := otpauthURI(m.serial()); uri != "" {
+		cmd.Env = append(cmd.Env, "AWS_VAULT_MFA_OTPAUTH_URI="+uri)
+	}
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = &stdout
+	cmd.Stderr = os.Stderr
+
+	notifyHook(m.Hook, HookEventMfaPrompt)
+	log.Printf("Running mfa_token_cmd for %s", m.serial())
+	if err := cmd.Start(); err != nil {
+		return nil, &MfaError{fmt.Errorf("mfa_token_cmd failed: %w", err)}
+	}
+
+	// the command is killed when ctx is done, but Wait isn't waited for as any children it started
+	// may still have stdout open
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	select {
+	case <-ctx.Done():
+		_ = cmd.Process.Kill()
+		return nil, ctx.Err()
+	case err := <-exited:
+		if err != nil {
+			return nil, &MfaError{fmt.Errorf("mfa_token_cmd failed: %w", err)}
+		}
+	}
+
+	token := strings.TrimSpace(stdout.String())
+	if token == "" {
+		return nil, &MfaError{fmt.Errorf("mfa_token_cmd didn't output a token for %s", m.serial())}
+	}
+	return aws.String(token), nil
+}
+
+// otpauthURI returns the otpauth URI of a virtual MFA device without its secret, with the label and issuer
+// that the QR code shown by AWS has. OTP apps and password managers can use it to find the device's entry.
+// It's empty for hardware devices, which don't have an ARN
+func otpauthURI(mfaSerial string) string {
+	a, err := arn.Parse(mfaSerial)
+	if err != nil || !strings.HasPrefix(a.Resource, "mfa/") {
+		return ""
+	}
+	name := a.Resource[strings.LastIndex(a.Resource, "/")+1:]
+
+	const issuer = "Amazon Web Services"
+	return fmt.Sprintf("otpauth://totp/%s:%s?issuer=%s",
+		url.PathEscape(issuer), url.PathEscape(name+"@"+a.AccountID), url.PathEscape(issuer))
 }
 
 // NewMasterCredentialsProvider creates a provider for the master credentials
 func NewMasterCredentialsProvider(k *CredentialKeyring, credentialsName string) *KeyringProvider {
-	return &KeyringProvider{k, credentialsName}
+	return &KeyringProvider{Keyring: k, CredentialsName: credentialsName}
 }
 
 func NewMasterCredentials(k *CredentialKeyring, credentialsName string) *credentials.Credentials {
@@ -58,27 +283,54 @@ func NewMasterCredentials(k *CredentialKeyring, credentialsName string) *credent
 }
 
 func NewSessionTokenProvider(creds *credentials.Credentials, k *CredentialKeyring, config *Config) (credentials.Provider, error) {
-	sess, err := NewSession(creds, config.Region)
+	return NewSessionTokenProviderWithContext(NewContextCredentials(credentialsProvider{creds}), k, config)
+}
+
+// NewSessionTokenProviderWithContext is NewSessionTokenProvider, but waiting for creds is cancelled along
+// with the GetSessionToken call
+func NewSessionTokenProviderWithContext(creds *ContextCredentials, k *CredentialKeyring, config *Config) (credentials.Provider, error) {
+	sess, err := NewProfileSession(creds.Credentials, config)
 	if err != nil {
 		return nil, err
 	}
+	creds.signWithContext(sess)
 
+	mfaSerial := config.MfaSerial
 	sessionTokenProvider := &SessionTokenProvider{
 		StsClient:    sts.New(sess),
 		Duration:     config.GetSessionTokenDuration,
 		ExpiryWindow: defaultExpirationWindow,
 		Mfa: Mfa{
-			MfaToken:        config.MfaToken,
-			MfaPromptMethod: config.MfaPromptMethod,
-			MfaSerial:       config.MfaSerial,
+			MfaToken:          config.MfaToken,
+			MfaPromptMethod:   config.MfaPromptMethod,
+			MfaTokenCmd:       config.MfaTokenCmd,
+			MfaSerial:         mfaSerial,
+			MfaSerialResolver: mfaSerialResolver(mfaSerial, sess),
+			Hook:              NewHook(config),
 		},
 	}
 
+	if !UseSessionCache && CacheOnly {
+		return nil, fmt.Errorf("profile %s: %w, the session cache is disabled", config.ProfileName, ErrNoCachedCredentials)
+	}
+
+	if config.NoCacheWithMfa && mfaSerial != "" {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, no_cache_with_mfa is set", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: not caching the session, no_cache_with_mfa is set", config.ProfileName)
+		return sessionTokenProvider, nil
+	}
+
 	if UseSessionCache {
 		return &CachedSessionTokenProvider{
 			Keyring:         k,
 			CredentialsName: config.ProfileName,
+			Region:          config.Region,
 			ExpiryWindow:    defaultExpirationWindow,
+			ExpiredGrace:    config.AllowExpiredGrace,
+			VerifyMfa:       config.VerifyMfaSession,
+			Owner:           config.SessionOwner(),
 			Provider:        sessionTokenProvider,
 		}, nil
 	}
@@ -86,56 +338,187 @@ func NewSessionTokenProvider(creds *credentials.Credentials, k *CredentialKeyrin
 	return sessionTokenProvider, nil
 }
 
+// NewSamlProvider returns a provider that generates credentials using AssumeRoleWithSAML
+func NewSamlProvider(config *Config) (*SamlProvider, error) {
+	if config.RoleARN == "" {
+		return nil, &ConfigError{fmt.Errorf("profile %s: saml_provider_arn requires a role_arn", config.ProfileName)}
+	}
+	if config.SamlAssertionCmd == "" && config.SamlAssertionFile == "" {
+		return nil, &ConfigError{fmt.Errorf("profile %s: saml_provider_arn requires a saml_assertion_cmd or saml_assertion_file", config.ProfileName)}
+	}
+
+	// AssumeRoleWithSAML doesn't need to be signed
+	sess, err := NewProfileSession(credentials.AnonymousCredentials, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SamlProvider{
+		StsClient:     sts.New(sess),
+		RoleARN:       config.RoleARN,
+		PrincipalARN:  config.SamlProviderARN,
+		Duration:      config.AssumeRoleDuration,
+		ExpiryWindow:  defaultExpirationWindow,
+		AssertionCmd:  config.SamlAssertionCmd,
+		AssertionFile: config.SamlAssertionFile,
+		Hook:          NewHook(config),
+	}, nil
+}
+
+// NewWebIdentityProvider returns a provider that generates credentials using AssumeRoleWithWebIdentity
+func NewWebIdentityProvider(config *Config) (*WebIdentityProvider, error) {
+	if config.RoleARN == "" {
+		return nil, &ConfigError{fmt.Errorf("profile %s: web_identity_token_file requires a role_arn", config.ProfileName)}
+	}
+
+	// AssumeRoleWithWebIdentity doesn't need to be signed
+	sess, err := NewProfileSession(credentials.AnonymousCredentials, config)
+	if err != nil {
+		return nil, err
+	}
+
+	return &WebIdentityProvider{
+		StsClient:       sts.New(sess),
+		RoleARN:         config.RoleARN,
+		RoleSessionName: config.RoleSessionName,
+		Duration:        config.AssumeRoleDuration,
+		ExpiryWindow:    defaultExpirationWindow,
+		TokenFile:       config.WebIdentityTokenFile,
+		Hook:            NewHook(config),
+	}, nil
+}
+
 // NewAssumeRoleProvider returns a provider that generates credentials using AssumeRole
 func NewAssumeRoleProvider(creds *credentials.Credentials, config *Config, noMfa bool) (*AssumeRoleProvider, error) {
-	sess, err := NewSession(creds, config.Region)
+	return NewAssumeRoleProviderWithContext(NewContextCredentials(credentialsProvider{creds}), config, noMfa)
+}
+
+// NewAssumeRoleProviderWithContext is NewAssumeRoleProvider, but waiting for creds is cancelled along
+// with the AssumeRole call
+func NewAssumeRoleProviderWithContext(creds *ContextCredentials, config *Config, noMfa bool) (*AssumeRoleProvider, error) {
+	sess, err := NewProfileSession(creds.Credentials, config)
 	if err != nil {
 		return nil, err
 	}
+	creds.signWithContext(sess)
 
-	mfa := config.MfaSerial
-	if noMfa {
-		mfa = ""
+	mfa := ""
+	if !noMfa {
+		mfa = config.MfaSerial
+	}
+
+	var sourceCreds *ContextCredentials
+	if config.AssumeRoleDurationAuto {
+		sourceCreds = creds
 	}
 
 	return &AssumeRoleProvider{
 		StsClient:       sts.New(sess),
+		IamClient:       iam.New(sess),
 		RoleARN:         config.RoleARN,
+		RoleARNResolver: roleARNResolver(config.RoleARN, sess),
 		RoleSessionName: config.RoleSessionName,
 		ExternalID:      config.ExternalID,
 		Duration:        config.AssumeRoleDuration,
 		ExpiryWindow:    defaultExpirationWindow,
+		SourceCreds:     sourceCreds,
 		Mfa: Mfa{
-			MfaSerial:       mfa,
-			MfaToken:        config.MfaToken,
-			MfaPromptMethod: config.MfaPromptMethod,
+			MfaSerial:         mfa,
+			MfaSerialResolver: mfaSerialResolver(mfa, sess),
+			MfaToken:          config.MfaToken,
+			MfaPromptMethod:   config.MfaPromptMethod,
+			MfaTokenCmd:       config.MfaTokenCmd,
+			Hook:              NewHook(config),
 		},
 	}, nil
 }
 
 // Provider creates a credential provider for the given config. To chain the MFA serial with a source credential, pass the MFA serial in chainMfaSerial
 func NewTempCredentialsProvider(config *Config, keyring *CredentialKeyring) (credentials.Provider, error) {
+	defer traceStep("build provider for %s", config.ProfileName)()
+
 	var sourceCredProvider credentials.Provider
 
-	hasStoredCredentials, err := keyring.Has(config.ProfileName)
-	if err != nil {
-		return nil, err
+	if config.HasSamlProvider() {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, AssumeRoleWithSAML credentials aren't cached", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: using AssumeRoleWithSAML", config.ProfileName)
+		return NewSamlProvider(config)
+	}
+
+	if config.HasWebIdentity() {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, AssumeRoleWithWebIdentity credentials aren't cached", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: using AssumeRoleWithWebIdentity", config.ProfileName)
+		return NewWebIdentityProvider(config)
 	}
 
-	if hasStoredCredentials {
+	// the root of the chain uses credentials from the file descriptor, and the keyring isn't used at all
+	useSourceFD := config.SourceFD != 0 && !config.HasSourceProfile()
+
+	var hasStoredCredentials, sourceFromProfile bool
+	var err error
+	if config.SourceFD == 0 {
+		hasStoredCredentials, err = keyring.Has(config.ProfileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if useSourceFD {
+		log.Printf("profile %s: using credentials from file descriptor %d", config.ProfileName, config.SourceFD)
+		sourceCredProvider, err = NewFileDescriptorProvider(config.SourceFD)
+		if err != nil {
+			return nil, err
+		}
+	} else if hasStoredCredentials {
+		if config.StrictSourceProfile && config.HasSourceProfile() {
+			return nil, &ConfigError{fmt.Errorf("profile %s: has both stored credentials and a source_profile of %s, "+
+				"remove one of them, or unset strict_source_profile to ignore the source_profile", config.ProfileName, config.SourceProfileName)}
+		}
 		log.Printf("profile %s: using stored credentials %s", config.ProfileName, logSourceDetails(config))
-		sourceCredProvider = NewMasterCredentialsProvider(keyring, config.ProfileName)
+		masterProvider := NewMasterCredentialsProvider(keyring, config.ProfileName)
+		if ValidateStoredCredentials && !CacheOnly {
+			masterProvider.ValidateSession, err = NewProfileSession(credentials.AnonymousCredentials, config)
+			if err != nil {
+				return nil, err
+			}
+		}
+		sourceCredProvider = masterProvider
+	} else if config.CredentialProcess != "" && os.Getenv("AWS_VAULT_CREDENTIAL_PROCESS") == "" {
+		log.Printf("profile %s: using credential_process %s", config.ProfileName, logSourceDetails(config))
+		sourceCredProvider = &CredentialProcessProvider{
+			Keyring:         keyring,
+			CredentialsName: config.ProfileName,
+			Command:         config.CredentialProcess,
+			CacheTTL:        config.CredentialProcessCacheTTL,
+			ExpiryWindow:    defaultExpirationWindow,
+		}
+	} else if config.HasSSOStartURL() {
+		log.Printf("profile %s: using SSO role credentials", config.ProfileName)
+		sourceCredProvider, err = NewSSORoleCredentialsProvider(keyring, config)
+		if err != nil {
+			return nil, err
+		}
+	} else if config.CredentialSource != "" {
+		log.Printf("profile %s: using credential_source %s", config.ProfileName, config.CredentialSource)
+		sourceCredProvider, err = NewCredentialSourceProvider(config)
+		if err != nil {
+			return nil, err
+		}
 	} else if config.HasSourceProfile() {
+		sourceFromProfile = true
 		sourceCredProvider, err = NewTempCredentialsProvider(config.SourceProfile, keyring)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		return nil, fmt.Errorf("profile %s: credentials missing", config.ProfileName)
+		return nil, fmt.Errorf("profile %s: %w", config.ProfileName, ErrCredentialsMissing)
 	}
 
-	mfaChained := config.MfaAlreadyUsedInSourceProfile()
-	sourceCreds := credentials.NewCredentials(sourceCredProvider)
+	sourceCreds := NewContextCredentials(sourceCredProvider)
 
 	if config.RoleARN == "" {
 		if !UseSession {
@@ -144,7 +527,51 @@ func NewTempCredentialsProvider(config *Config, keyring *CredentialKeyring) (cre
 			return sourceCredProvider, nil
 		}
 
-		if config.IsChained() {
+		switch {
+		case config.GetSessionToken == GetSessionTokenNever:
+			log.Printf("profile %s: not using GetSessionToken because get_session_token is %s", config.ProfileName, GetSessionTokenNever)
+			config.MfaSerial = ""
+			return sourceCredProvider, nil
+		case config.GetSessionToken == GetSessionTokenRoot && sourceFromProfile:
+			log.Printf("profile %s: not using GetSessionToken because it isn't the root of the chain", config.ProfileName)
+			config.MfaSerial = ""
+			return sourceCredProvider, nil
+		}
+
+		if hasStoredCredentials {
+			val, err := keyring.Get(config.ProfileName)
+			if err != nil {
+				return nil, err
+			}
+			if val.SessionToken != "" {
+				log.Printf("profile %s: not using GetSessionToken because the stored credentials are temporary", config.ProfileName)
+				return sourceCredProvider, nil
+			}
+		} else if p, ok := sourceCredProvider.(*FileDescriptorProvider); ok && p.output.SessionToken != "" {
+			log.Printf("profile %s: not using GetSessionToken because the credentials from file descriptor %d are temporary", config.ProfileName, config.SourceFD)
+			return sourceCredProvider, nil
+		} else if _, ok := sourceCredProvider.(*Ec2MetadataProvider); ok {
+			log.Printf("profile %s: not using GetSessionToken because instance role credentials are temporary", config.ProfileName)
+			return sourceCredProvider, nil
+		} else if _, ok := sourceCredProvider.(*SSORoleCredentialsProvider); ok {
+			log.Printf("profile %s: not using GetSessionToken because SSO role credentials are temporary", config.ProfileName)
+			return sourceCredProvider, nil
+		} else if _, ok := sourceCredProvider.(*CredentialProcessProvider); ok {
+			log.Printf("profile %s: not using GetSessionToken because credential_process provides the credentials", config.ProfileName)
+			return sourceCredProvider, nil
+		}
+
+		if config.NoMfa && config.HasMfaSerial() {
+			config.MfaSerial = ""
+			if config.IsChained() {
+				log.Printf("profile %s: not using GetSessionToken because MFA is skipped", config.ProfileName)
+				return sourceCredProvider, nil
+			}
+		}
+
+		if config.IsChained() && config.GetSessionToken == GetSessionTokenRoot {
+			config.GetSessionTokenDuration = config.ChainedGetSessionTokenDuration
+		} else if config.IsChained() {
 			if !config.ChainedFromProfile.HasMfaSerial() {
 				log.Printf("profile %s: not using GetSessionToken because profile '%s' has no MFA serial defined", config.ProfileName, config.ChainedFromProfile.ProfileName)
 				return sourceCredProvider, nil
@@ -159,12 +586,105 @@ func NewTempCredentialsProvider(config *Config, keyring *CredentialKeyring) (cre
 		}
 
 		log.Printf("profile %s: using GetSessionToken %s", config.ProfileName, mfaDetails(false, config))
-		return NewSessionTokenProvider(sourceCreds, keyring, config)
+		return NewSessionTokenProviderWithContext(sourceCreds, keyring, config)
 
 	} else {
-		log.Printf("profile %s: using AssumeRole %s", config.ProfileName, mfaDetails(mfaChained, config))
-		return NewAssumeRoleProvider(sourceCreds, config, mfaChained)
+		noMfa := config.NoMfa || !config.AssumeRoleNeedsMfa()
+		sourceIdentity := config.ProfileName
+		if sourceFromProfile {
+			sourceIdentity = config.SourceProfileName
+		}
+		if len(config.ChainedRoleARNs) > 0 {
+			if sourceCreds, err = newChainedRoleCredentials(sourceCreds, keyring, config, noMfa, sourceIdentity); err != nil {
+				return nil, err
+			}
+			sourceIdentity = config.ChainedRoleARNs[len(config.ChainedRoleARNs)-1]
+			// only the first role in role_arns uses MFA, as AWS rejects an MFA code that's already
+			// been used, and the roles after it keep its MFA context
+			noMfa = true
+		}
+
+		log.Printf("profile %s: using AssumeRole %s", config.ProfileName, mfaDetails(noMfa && config.HasMfaSerial(), config))
+		assumeRoleProvider, err := NewAssumeRoleProviderWithContext(sourceCreds, config, noMfa)
+		if err != nil {
+			return nil, err
+		}
+		return newCachedAssumeRoleProvider(config, keyring, assumeRoleProvider, sourceIdentity)
+	}
+}
+
+// newChainedRoleCredentials assumes the ChainedRoleARNs of the profile in order, each with the
+// credentials of the one before. noMfa and sourceIdentity are for the first role, the rest don't use
+// MFA and are assumed from the role before
+func newChainedRoleCredentials(creds *ContextCredentials, keyring *CredentialKeyring, config *Config, noMfa bool, sourceIdentity string) (*ContextCredentials, error) {
+	for i, roleARN := range config.ChainedRoleARNs {
+		hopConfig := *config
+		hopConfig.RoleARN = roleARN
+		hopConfig.ChainedRoleARNs = nil
+		if i > 0 {
+			noMfa = true
+		}
+
+		log.Printf("profile %s: using AssumeRole for %s in role_arns %s", config.ProfileName, roleARN, mfaDetails(noMfa && config.HasMfaSerial(), &hopConfig))
+		p, err := NewAssumeRoleProviderWithContext(creds, &hopConfig, noMfa)
+		if err != nil {
+			return nil, err
+		}
+		provider, err := newCachedAssumeRoleProvider(&hopConfig, keyring, p, sourceIdentity)
+		if err != nil {
+			return nil, err
+		}
+		creds = NewContextCredentials(provider)
+		sourceIdentity = roleARN
+	}
+	return creds, nil
+}
+
+// newCachedAssumeRoleProvider caches the sessions of assumeRoleProvider in the keyring, unless the
+// session cache is disabled or the session shouldn't be cached. sourceIdentity names the source
+// credentials, see CachedAssumeRoleProvider.SourceIdentity
+func newCachedAssumeRoleProvider(config *Config, keyring *CredentialKeyring, assumeRoleProvider *AssumeRoleProvider, sourceIdentity string) (credentials.Provider, error) {
+	if !UseSessionCache {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, the session cache is disabled", config.ProfileName, ErrNoCachedCredentials)
+		}
+		return assumeRoleProvider, nil
+	}
+
+	if config.NoRoleSessionCache {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, the role session isn't cached", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: not caching the role session", config.ProfileName)
+		return assumeRoleProvider, nil
+	}
+
+	// a session without MFA isn't cached, so later runs that use MFA don't reuse it
+	if config.NoMfa {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, sessions without MFA aren't cached", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: not caching the session, MFA is skipped", config.ProfileName)
+		return assumeRoleProvider, nil
 	}
+
+	if config.NoCacheWithMfa && assumeRoleProvider.MfaSerial != "" {
+		if CacheOnly {
+			return nil, fmt.Errorf("profile %s: %w, no_cache_with_mfa is set", config.ProfileName, ErrNoCachedCredentials)
+		}
+		log.Printf("profile %s: not caching the session, no_cache_with_mfa is set", config.ProfileName)
+		return assumeRoleProvider, nil
+	}
+
+	return &CachedAssumeRoleProvider{
+		Keyring:         keyring,
+		CredentialsName: config.ProfileName,
+		Region:          config.Region,
+		ExpiryWindow:    defaultExpirationWindow,
+		SourceIdentity:  sourceIdentity,
+		Owner:           config.SessionOwner(),
+		Provider:        assumeRoleProvider,
+	}, nil
 }
 
 func logSourceDetails(config *Config) string {
@@ -175,6 +695,12 @@ func logSourceDetails(config *Config) string {
 }
 
 func mfaDetails(mfaChained bool, config *Config) string {
+	if config.NoMfa && config.HasMfaSerial() {
+		return "(skipping MFA)"
+	}
+	if config.RoleARN != "" && config.AssumeRoleMfa == AssumeRoleMfaNone {
+		return "(without MFA)"
+	}
 	if mfaChained {
 		return "(chained MFA)"
 	}
@@ -186,21 +712,40 @@ func mfaDetails(mfaChained bool, config *Config) string {
 
 // NewTempCredentials returns credentials for the given config
 func NewTempCredentials(config *Config, k *CredentialKeyring) (*credentials.Credentials, error) {
+	creds, err := NewTempCredentialsWithContext(config, k)
+	if err != nil {
+		return nil, err
+	}
+	return creds.Credentials, nil
+}
+
+// NewTempCredentialsWithContext is NewTempCredentials, but the credentials can be retrieved with a context
+func NewTempCredentialsWithContext(config *Config, k *CredentialKeyring) (*ContextCredentials, error) {
 	provider, err := NewTempCredentialsProvider(config, k)
 	if err != nil {
 		return nil, err
 	}
 
-	return credentials.NewCredentials(provider), nil
+	return NewContextCredentials(provider), nil
 }
 
 func NewFederationTokenCredentials(profileName string, k *CredentialKeyring, config *Config) (*credentials.Credentials, error) {
+	creds, err := NewFederationTokenCredentialsWithContext(profileName, k, config)
+	if err != nil {
+		return nil, err
+	}
+	return creds.Credentials, nil
+}
+
+// NewFederationTokenCredentialsWithContext is NewFederationTokenCredentials, but the credentials can be
+// retrieved with a context
+func NewFederationTokenCredentialsWithContext(profileName string, k *CredentialKeyring, config *Config) (*ContextCredentials, error) {
 	credentialsName, err := MasterCredentialsFor(profileName, k, config)
 	if err != nil {
 		return nil, err
 	}
 
-	sess, err := NewSession(NewMasterCredentials(k, credentialsName), config.Region)
+	sess, err := NewProfileSession(NewMasterCredentials(k, credentialsName), config)
 	if err != nil {
 		return nil, err
 	}
@@ -211,10 +756,12 @@ func NewFederationTokenCredentials(profileName string, k *CredentialKeyring, con
 	}
 
 	log.Printf("Using GetFederationToken for credentials")
-	return credentials.NewCredentials(&FederationTokenProvider{
+	return NewContextCredentials(&FederationTokenProvider{
 		StsClient: sts.New(sess),
 		Name:      currentUsername,
 		Duration:  config.GetFederationTokenDuration,
+		Hook:      NewHook(config),
+		Policy:    config.FederationPolicy,
 	}), nil
 }
 
@@ -0,0 +1,82 @@
+package vault
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+// defaultWebIdentitySessionName is the RoleSessionName used when the profile doesn't set one, as
+// there are no credentials to look up an identity with
+const defaultWebIdentitySessionName = "aws-vault"
+
+// WebIdentityProvider retrieves temporary credentials from STS using AssumeRoleWithWebIdentity
+type WebIdentityProvider struct {
+	StsClient       *sts.STS
+	RoleARN         string
+	RoleSessionName string
+	Duration        time.Duration
+	ExpiryWindow    time.Duration
+
+	// TokenFile is read for the OIDC token each time credentials are retrieved, as platforms such as
+	// Kubernetes replace it before it expires
+	TokenFile string
+
+	Hook Hook
+	credentials.Expiry
+}
+
+// Retrieve generates a new set of temporary credentials using STS AssumeRoleWithWebIdentity
+func (p *WebIdentityProvider) Retrieve() (credentials.Value, error) {
+	token, err := p.token()
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	sessionName := p.RoleSessionName
+	if sessionName == "" {
+		sessionName = defaultWebIdentitySessionName
+	}
+
+	defer traceStep("sts:AssumeRoleWithWebIdentity %s", p.RoleARN)()
+	resp, err := p.StsClient.AssumeRoleWithWebIdentity(&sts.AssumeRoleWithWebIdentityInput{
+		RoleArn:          aws.String(p.RoleARN),
+		RoleSessionName:  aws.String(sessionName),
+		WebIdentityToken: aws.String(token),
+		DurationSeconds:  aws.Int64(int64(p.Duration.Seconds())),
+	})
+	if err != nil {
+		return credentials.Value{}, err
+	}
+
+	log.Printf("Generated credentials %s using AssumeRoleWithWebIdentity, expires in %s", FormatKeyForDisplay(*resp.Credentials.AccessKeyId), time.Until(*resp.Credentials.Expiration).String())
+	notifyHook(p.Hook, HookEventRefresh)
+
+	p.SetExpiration(*resp.Credentials.Expiration, p.ExpiryWindow)
+	return credentials.Value{
+		AccessKeyID:     *resp.Credentials.AccessKeyId,
+		SecretAccessKey: *resp.Credentials.SecretAccessKey,
+		SessionToken:    *resp.Credentials.SessionToken,
+	}, nil
+}
+
+func (p *WebIdentityProvider) token() (string, error) {
+	log.Printf("Reading web identity token from %s", p.TokenFile)
+	b, err := ioutil.ReadFile(p.TokenFile)
+	if err != nil {
+		return "", fmt.Errorf("Error reading web_identity_token_file: %w", err)
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("web_identity_token_file %s is empty", p.TokenFile)
+	}
+
+	return token, nil
+}
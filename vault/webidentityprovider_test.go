@@ -0,0 +1,48 @@
+package vault_test
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/99designs/aws-vault/vault"
+	"github.com/aws/aws-sdk-go/service/sts"
+)
+
+func TestWebIdentityProviderRereadsTheTokenFile(t *testing.T) {
+	var form url.Values
+	sess, done := newFakeAWSSession(t, "", &form)
+	defer done()
+
+	f, err := ioutil.TempFile("", "aws-vault-web-identity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	p := &vault.WebIdentityProvider{
+		StsClient: sts.New(sess),
+		RoleARN:   "arn:aws:iam::123456789012:role/deploy",
+		Duration:  time.Hour,
+		TokenFile: f.Name(),
+	}
+
+	// the platform replaces the token before it expires, so each refresh must use the current one
+	for _, token := range []string{"first-token", "rotated-token"} {
+		if err = ioutil.WriteFile(f.Name(), []byte(token+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = p.Retrieve(); err != nil {
+			t.Fatal(err)
+		}
+		if actual := form.Get("WebIdentityToken"); actual != token {
+			t.Fatalf("Expected token %q, got %q", token, actual)
+		}
+		if actual := form.Get("RoleSessionName"); actual != "aws-vault" {
+			t.Fatalf("Expected the default session name, got %q", actual)
+		}
+	}
+}